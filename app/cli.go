@@ -0,0 +1,545 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/controller"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/export"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/rest"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/scrapers"
+)
+
+// Exit codes of the commands.
+const (
+	exitError = 1
+	// The arguments of the command are invalid.
+	exitUsage = 2
+	// A grade is below the -min-grade of the command, so it can gate the
+	// deployment pipelines.
+	exitBelowThreshold = 3
+)
+
+// Error of the commands checking the grades when a grade is below -min-grade.
+var errBelowThreshold = errors.New("grade below the threshold")
+
+// usageError - Error of the commands for their invalid arguments.
+type usageError struct {
+	err error
+}
+
+// Method for implementing the error interface.
+func (e usageError) Error() string {
+	return e.err.Error()
+}
+
+// cliEnv - Struct holding what the commands need. The database is only
+// opened when a command asks for the service, after its arguments are parsed.
+type cliEnv struct {
+	stdout io.Writer
+	// Function returning the service over the store of the server.
+	service func() (*controller.Service, error)
+	// Function applying the pending migrations of the database.
+	migrate func(ctx context.Context) error
+}
+
+// command - Struct describing a command of the CLI. args are the arguments
+// after the name of the command.
+type command struct {
+	usage string
+	run   func(ctx context.Context, env *cliEnv, args []string) error
+}
+
+// Commands of the CLI, besides serve, which starts the server.
+var commands = map[string]command{
+	"evaluate": {"evaluate [-json] [-min-grade grade] [-baseline b] [-timeout duration] domain...", evaluateCommand},
+	"history":  {"history [-json] [-last n] domain", historyCommand},
+	"recent":   {"recent [-json] [-min-grade grade] [-domain d] [-grade g] [-since t] [-until t]", recentCommand},
+	"watch":    {"watch add|remove domain... | watch list [-json]", watchCommand},
+	"export":   {"export [-format csv|ndjson|xlsx] [-o file] [-domain d] [-grade g] [-since t] [-until t]", exportCommand},
+	"migrate":  {"migrate", migrateCommand},
+}
+
+// Auxiliar function for writing the usage of the CLI.
+func writeUsage(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(w, "Usage:")
+	fmt.Fprintln(w, "  server [serve]")
+	for _, name := range names {
+		fmt.Fprintln(w, "  server "+commands[name].usage)
+	}
+}
+
+// Function for running the CLI with the arguments of the process, it returns
+// the exit code. Without a command, the server is started like with serve.
+func cliMain(args []string) int {
+	if len(args) == 0 || args[0] == "serve" {
+		if err := run(); err != nil {
+			slog.Error("server stopped", "error", err)
+			return exitError
+		}
+		return 0
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	var db *sql.DB
+	open := func() (*sql.DB, error) {
+		var err error
+		if db == nil {
+			db, err = dao.InitDB()
+		}
+		return db, err
+	}
+	defer func() {
+		if db != nil {
+			db.Close()
+		}
+	}()
+	env := &cliEnv{
+		stdout: os.Stdout,
+		service: func() (*controller.Service, error) {
+			cfg, err := loadConfig()
+			if err != nil {
+				return nil, err
+			}
+			db, err := open()
+			if err != nil {
+				return nil, err
+			}
+			return controller.NewService(dao.NewSQLStore(db), controller.DefaultScrapers(), cfg.service), nil
+		},
+		migrate: func(ctx context.Context) error {
+			db, err := open()
+			if err != nil {
+				return err
+			}
+			return dao.Migrate(ctx, db)
+		},
+	}
+	return exitCode(execute(ctx, env, args), os.Stderr)
+}
+
+// Function for running the command named by the first argument.
+func execute(ctx context.Context, env *cliEnv, args []string) error {
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		writeUsage(env.stdout)
+		return nil
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return usageError{fmt.Errorf("unknown command %q", args[0])}
+	}
+	return cmd.run(ctx, env, args[1:])
+}
+
+// Function for getting the exit code of the error of a command, writing it in stderr.
+func exitCode(err error, stderr io.Writer) int {
+	var usageErr usageError
+	switch {
+	case err == nil || errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errBelowThreshold):
+		fmt.Fprintln(stderr, err)
+		return exitBelowThreshold
+	case errors.As(err, &usageErr):
+		fmt.Fprintln(stderr, err)
+		writeUsage(stderr)
+		return exitUsage
+	}
+	fmt.Fprintln(stderr, err)
+	return exitError
+}
+
+// Auxiliar function for parsing the flags of a command. The parsing errors
+// are usage errors.
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	flags.SetOutput(io.Discard)
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usageError{err}
+	}
+	return nil
+}
+
+// Auxiliar function for adding the -min-grade flag to a command.
+func minGradeFlag(flags *flag.FlagSet) *string {
+	return flags.String("min-grade", "", "fail with exit code 3 when a grade is below this one, like A or B")
+}
+
+// Auxiliar function for checking the -min-grade flag of a command.
+func validateMinGrade(minGrade string) error {
+	if minGrade != "" && scrapers.GradeRank(minGrade) < 0 {
+		return usageError{fmt.Errorf("unknown grade %q", minGrade)}
+	}
+	return nil
+}
+
+// Auxiliar function for checking a grade against the -min-grade flag. The
+// domains without a grade (down, or with servers without a grade) are below
+// any threshold.
+func belowThreshold(grade string, minGrade string) bool {
+	return minGrade != "" && scrapers.GradeRank(grade) < scrapers.GradeRank(minGrade)
+}
+
+// Auxiliar function for writing v as indented json.
+func writeJSONOutput(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// Auxiliar function for writing a table of tab separated rows.
+func writeTable(w io.Writer, header string, rows []string) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, header)
+	for _, row := range rows {
+		fmt.Fprintln(tw, row)
+	}
+	return tw.Flush()
+}
+
+// Auxiliar function for getting the first error of a list of APIErrors
+// failing a command (see controller.HTTPStatus), or nil.
+func commandError(appErrs []controller.APIError) error {
+	for _, appErr := range appErrs {
+		if appErr.Status >= 400 {
+			return fmt.Errorf("%s %s %s", appErr.Code, appErr.Description, appErr.Err)
+		}
+	}
+	return nil
+}
+
+// Auxiliar function for the codes of a list of APIErrors, for the tables.
+func errorCodes(appErrs []controller.APIError) string {
+	codes := make([]string, 0, len(appErrs))
+	for _, appErr := range appErrs {
+		codes = append(codes, appErr.Code)
+	}
+	return strings.Join(codes, ",")
+}
+
+// Evaluation - Struct representing an evaluation in the output of the
+// evaluate command.
+type Evaluation struct {
+	Domain     string                       `json:"domain"`
+	Evaluation dao.DomainEvaluationComplete `json:"evaluation"`
+	APIErrors  []controller.APIError        `json:"errors"`
+}
+
+// Function for the evaluate command: it evaluates the domains, waiting while
+// SSLabs works on each of them for at most -timeout, and prints their grades. It
+// fails when an evaluation fails, and with errBelowThreshold when a grade is
+// below -min-grade.
+func evaluateCommand(ctx context.Context, env *cliEnv, args []string) error {
+	flags := flag.NewFlagSet("evaluate", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the evaluations as json")
+	minGrade := minGradeFlag(flags)
+	timeout := flags.Duration("timeout", time.Minute*10, "time to wait for SSLabs, for each domain")
+	baselineFlag := flags.String("baseline", "", "evaluation compared with: previous, yesterday, hours like 6h "+
+		"or evaluation:ID, BASELINE when it's empty")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	var baseline *dao.Baseline
+	if *baselineFlag != "" {
+		b, err := dao.ParseBaseline(*baselineFlag)
+		if err != nil {
+			return usageError{err}
+		}
+		baseline = &b
+	}
+	if flags.NArg() == 0 {
+		return usageError{errors.New("evaluate needs at least a domain")}
+	}
+	if err := validateMinGrade(*minGrade); err != nil {
+		return err
+	}
+	service, err := env.service()
+	if err != nil {
+		return err
+	}
+	evaluations := make([]Evaluation, 0, flags.NArg())
+	var failed, below error
+	for _, domain := range flags.Args() {
+		dec, appErrs := evaluateUntilReady(ctx, service, domain, *timeout, baseline)
+		evaluations = append(evaluations, Evaluation{Domain: domain, Evaluation: dec, APIErrors: appErrs})
+		if err := commandError(appErrs); err != nil && failed == nil {
+			failed = fmt.Errorf("%s: %v", domain, err)
+		}
+		if belowThreshold(dec.SslGrade, *minGrade) && below == nil {
+			below = fmt.Errorf("%s: %w: %q < %q", domain, errBelowThreshold, dec.SslGrade, *minGrade)
+		}
+	}
+	if *asJSON {
+		err = writeJSONOutput(env.stdout, evaluations)
+	} else {
+		rows := make([]string, 0, len(evaluations))
+		for _, e := range evaluations {
+			rows = append(rows, fmt.Sprintf("%s\t%s\t%s\t%t\t%t\t%s", e.Domain, e.Evaluation.SslGrade,
+				e.Evaluation.PreviousSslGrade, e.Evaluation.ServersChanged, e.Evaluation.IsDown, errorCodes(e.APIErrors)))
+		}
+		err = writeTable(env.stdout, "DOMAIN\tGRADE\tPREVIOUS\tCHANGED\tDOWN\tERRORS", rows)
+	}
+	if err != nil {
+		return err
+	}
+	if failed != nil {
+		return failed
+	}
+	return below
+}
+
+// Auxiliar function for evaluating a domain for the evaluate command, waiting
+// while SSLabs works on it for at most timeout, and comparing it with the
+// baseline when it isn't nil.
+func evaluateUntilReady(ctx context.Context, service *controller.Service, domain string, timeout time.Duration,
+	baseline *dao.Baseline) (dec dao.DomainEvaluationComplete, appErrs []controller.APIError) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		dec, appErrs = service.ScraperTestComplete(ctx, domain, time.Now())
+		if controller.HTTPStatus(appErrs, dec.EvaluationInProgress) != 202 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(service.Config.DomainEvaluationTW):
+			continue
+		}
+		appErrs = append(appErrs, controller.APIErrors.E603(ctx.Err()))
+		break
+	}
+	if baseline != nil && !dec.EvaluationInProgress && !dec.IsDown && commandError(appErrs) == nil {
+		if appErr := service.CompareWithBaseline(ctx, domain, &dec, *baseline); appErr.Code != controller.DefaultAPIError().Code {
+			appErrs = append(appErrs, appErr)
+		}
+	}
+	return
+}
+
+// Function for the history command: it prints the evaluations of a domain,
+// the newest first.
+func historyCommand(ctx context.Context, env *cliEnv, args []string) error {
+	flags := flag.NewFlagSet("history", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the evaluations as json")
+	last := flags.Int("last", 10, "number of evaluations, all of them when it's 0")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return usageError{errors.New("history needs a domain")}
+	}
+	service, err := env.service()
+	if err != nil {
+		return err
+	}
+	history, appErr := service.DomainHistory(ctx, flags.Arg(0), *last)
+	if err := commandError([]controller.APIError{appErr}); err != nil {
+		return err
+	}
+	if *asJSON {
+		return writeJSONOutput(env.stdout, history)
+	}
+	rows := make([]string, 0, len(history))
+	for _, de := range history {
+		rows = append(rows, fmt.Sprintf("%s\t%s\t%t\t%t", de.EvaluationHour, de.SslGrade, de.EvaluationInProgress,
+			de.IsDown))
+	}
+	return writeTable(env.stdout, "HOUR\tGRADE\tIN PROGRESS\tDOWN", rows)
+}
+
+// Function for the recent command: it prints the last evaluation of every
+// domain, with the filters of the list endpoint. It fails with
+// errBelowThreshold when a ready grade is below -min-grade.
+func recentCommand(ctx context.Context, env *cliEnv, args []string) error {
+	flags := flag.NewFlagSet("recent", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the evaluations as json")
+	minGrade := minGradeFlag(flags)
+	q := filterFlags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if err := validateMinGrade(*minGrade); err != nil {
+		return err
+	}
+	filter, err := rest.ParseEvaluationFilter(q)
+	if err != nil {
+		return usageError{err}
+	}
+	service, err := env.service()
+	if err != nil {
+		return err
+	}
+	evaluations, appErrs := service.ListRecentEvaluations(ctx, time.Now())
+	if err := commandError(appErrs); err != nil {
+		return err
+	}
+	evaluations = filter.Filter(evaluations)
+	if *asJSON {
+		err = writeJSONOutput(env.stdout, evaluations)
+	} else {
+		rows := make([]string, 0, len(evaluations))
+		for _, de := range evaluations {
+			rows = append(rows, fmt.Sprintf("%s\t%s\t%s\t%t\t%t", de.Domain, de.EvaluationHour, de.SslGrade,
+				de.EvaluationInProgress, de.IsDown))
+		}
+		err = writeTable(env.stdout, "DOMAIN\tHOUR\tGRADE\tIN PROGRESS\tDOWN", rows)
+	}
+	if err != nil {
+		return err
+	}
+	for _, de := range evaluations {
+		if !de.EvaluationInProgress && belowThreshold(de.SslGrade, *minGrade) {
+			return fmt.Errorf("%s: %w: %q < %q", de.Domain, errBelowThreshold, de.SslGrade, *minGrade)
+		}
+	}
+	return nil
+}
+
+// Function for the watch command: it adds domains to the watched ones,
+// removes them or lists them. The server evaluates the watched domains every
+// WATCH_INTERVAL.
+func watchCommand(ctx context.Context, env *cliEnv, args []string) error {
+	if len(args) == 0 {
+		return usageError{errors.New("watch needs add, remove or list")}
+	}
+	flags := flag.NewFlagSet("watch "+args[0], flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the watched domains as json")
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+	var change func(service *controller.Service, domain string) controller.APIError
+	switch args[0] {
+	case "add":
+		change = func(service *controller.Service, domain string) controller.APIError {
+			return service.WatchDomain(ctx, domain, time.Now())
+		}
+	case "remove":
+		change = func(service *controller.Service, domain string) controller.APIError {
+			return service.UnwatchDomain(ctx, domain)
+		}
+	case "list":
+		if flags.NArg() != 0 {
+			return usageError{errors.New("watch list takes no domains")}
+		}
+	default:
+		return usageError{fmt.Errorf("unknown watch command %q", args[0])}
+	}
+	if change != nil && flags.NArg() == 0 {
+		return usageError{fmt.Errorf("watch %s needs at least a domain", args[0])}
+	}
+	service, err := env.service()
+	if err != nil {
+		return err
+	}
+	if change != nil {
+		for _, domain := range flags.Args() {
+			if err := commandError([]controller.APIError{change(service, domain)}); err != nil {
+				return fmt.Errorf("%s: %v", domain, err)
+			}
+		}
+		return nil
+	}
+	watched, appErr := service.ListWatchedDomains(ctx)
+	if err := commandError([]controller.APIError{appErr}); err != nil {
+		return err
+	}
+	if *asJSON {
+		return writeJSONOutput(env.stdout, watched)
+	}
+	rows := make([]string, 0, len(watched))
+	for _, wd := range watched {
+		rows = append(rows, wd.Domain+"\t"+wd.AddedAt.Format(time.RFC3339))
+	}
+	return writeTable(env.stdout, "DOMAIN\tADDED AT", rows)
+}
+
+// Auxiliar function for adding the filters of the list endpoint (see
+// rest.ParseEvaluationFilter) as flags of a command, like -domain or -since.
+func filterFlags(flags *flag.FlagSet) url.Values {
+	q := url.Values{}
+	for _, name := range rest.FilterParams {
+		name := name
+		flags.Func(name, "filter of the evaluations, as in the list endpoint", func(v string) error {
+			q.Set(name, v)
+			return nil
+		})
+	}
+	return q
+}
+
+// Function for the export command: it writes the stored evaluations, joined
+// with their servers, in the format of the -format flag. The filters are the
+// ones of the list endpoint. A failure closing the -o file fails the command.
+func exportCommand(ctx context.Context, env *cliEnv, args []string) (err error) {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", export.FormatCSV, "format of the export: csv, ndjson or xlsx")
+	output := flags.String("o", "", "file written instead of the standard output")
+	q := filterFlags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	filter, err := rest.ParseEvaluationFilter(q)
+	if err != nil {
+		return usageError{err}
+	}
+	if export.ContentType(*format) == "" {
+		return usageError{errors.New("unknown export format " + strconv.Quote(*format))}
+	}
+	service, err := env.service()
+	if err != nil {
+		return err
+	}
+	out := env.stdout
+	if *output != "" {
+		f, createErr := os.Create(*output)
+		if createErr != nil {
+			return createErr
+		}
+		defer func() {
+			// The file may be truncated when it's not closed cleanly.
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+		out = f
+	}
+	ew, err := export.NewWriter(*format, out)
+	if err != nil {
+		return err
+	}
+	if err := commandError([]controller.APIError{service.ExportEvaluations(ctx, filter, ew.Write)}); err != nil {
+		return err
+	}
+	return ew.Close()
+}
+
+// Function for the migrate command: it applies the pending migrations of the database.
+func migrateCommand(ctx context.Context, env *cliEnv, args []string) error {
+	if len(args) != 0 {
+		return usageError{errors.New("migrate takes no arguments")}
+	}
+	return env.migrate(ctx)
+}
@@ -1,24 +1,525 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 	"github.com/go-chi/chi"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/controller"
 	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/frontend"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/graph"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/logging"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/ratelimit"
 	"github.com/trotsdeveloper/truora_test/truora_test_golang/rest"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/rpc"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/scrapers"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/tracing"
+	"go.opentelemetry.io/otel"
+	"google.golang.org/grpc"
 )
 
-func main() {
+// config - Struct holding the settings of the application.
+type config struct {
+	addr string
+	// Address of the gRPC server, it isn't started when it's empty.
+	grpcAddr string
+	// Whether pending migrations are applied at startup.
+	migrate bool
+	// Time to wait for in-flight requests and evaluations when stopping.
+	shutdownTimeout time.Duration
+	// Time between the evaluations of the watched domains, they aren't
+	// evaluated when it's zero.
+	watchInterval time.Duration
+	// Format (json or logfmt) and minimum level of the logs.
+	logFormat string
+	logLevel  string
+	// Exporter of the traces: none, stdout or otlp.
+	tracesExporter string
+	// Version of the responses for the clients that don't choose one.
+	apiVersion int
+	// Settings of the client fetching the homepages of the domains.
+	homepage scrapers.SafeClientConfig
+	// Whether the domain evaluations endpoints need an API key. By default,
+	// they need it when the admin endpoints are enabled.
+	requireAPIKey bool
+	// Bearer token of the admin endpoints, they are disabled when it's empty.
+	adminToken string
+	// CORS policy of the API.
+	cors rest.CORSConfig
+	// Requests per minute of every client, and the proxies whose
+	// X-Forwarded-For header is honoured for knowing the client.
+	clientRateLimit int
+	trustedProxies  []netip.Prefix
+	// Where the buckets of the rate limiters are kept: memory or database.
+	rateLimitStore string
+	// Whether the embedded frontend is served at /, and its settings.
+	frontend       bool
+	frontendConfig rest.FrontendConfig
+	service        controller.Config
+}
+
+// Function for loading the settings of the application from the environment.
+// Every setting is optional, the defaults are the ones of controller.DefaultConfig.
+func loadConfig() (cfg config, err error) {
+	cfg.addr = ":3000"
+	if v := os.Getenv("ADDR"); v != "" {
+		cfg.addr = v
+	}
+	cfg.grpcAddr = ":3001"
+	if v, ok := os.LookupEnv("GRPC_ADDR"); ok {
+		cfg.grpcAddr = v
+	}
+	cfg.migrate = os.Getenv("MIGRATE") == "true"
+	cfg.logFormat = logging.FormatJSON
+	if v := os.Getenv("LOG_FORMAT"); v != "" {
+		cfg.logFormat = v
+	}
+	cfg.logLevel = "info"
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		cfg.logLevel = v
+	}
+	cfg.tracesExporter = tracing.ExporterNone
+	if v := os.Getenv("TRACES_EXPORTER"); v != "" {
+		cfg.tracesExporter = v
+	}
+	cfg.apiVersion = rest.V1
+	if v := os.Getenv("API_VERSION"); v != "" {
+		if cfg.apiVersion, err = strconv.Atoi(v); err != nil || (cfg.apiVersion != rest.V1 && cfg.apiVersion != rest.V2) {
+			err = fmt.Errorf("API_VERSION: unknown version %q", v)
+			return
+		}
+	}
+	// The API keys are created through the admin endpoints, so they are only
+	// required by default when those endpoints are enabled.
+	cfg.adminToken = os.Getenv("ADMIN_TOKEN")
+	cfg.requireAPIKey = cfg.adminToken != ""
+	if v := os.Getenv("REQUIRE_API_KEY"); v != "" {
+		cfg.requireAPIKey = v == "true"
+	}
+	if cfg.requireAPIKey && cfg.adminToken == "" {
+		err = errors.New("REQUIRE_API_KEY: the API keys can't be created without an ADMIN_TOKEN")
+		return
+	}
+	cfg.shutdownTimeout = time.Second * 30
+	cfg.watchInterval = time.Hour
+	cfg.service = controller.DefaultConfig()
+	durations := map[string]*time.Duration{
+		"SHUTDOWN_TIMEOUT":        &cfg.shutdownTimeout,
+		"WATCH_INTERVAL":          &cfg.watchInterval,
+		"DOMAIN_EVALUATION_TW":    &cfg.service.DomainEvaluationTW,
+		"RECENT_EVALUATIONS_TW":   &cfg.service.RecentEvaluationsTW,
+		"DATABASE_TIMEOUT":        &cfg.service.Timeouts.Database,
+		"EVALUATOR_TIMEOUT":       &cfg.service.Timeouts.Evaluator,
+		"SCRAPER_TIMEOUT":         &cfg.service.Timeouts.Scraper,
+		"EVALUATION_LOCK_TTL":     &cfg.service.EvaluationLockTTL,
+		"EVALUATION_LOCK_POLL":    &cfg.service.EvaluationLockPoll,
+		"EVALUATOR_CHECK_TTL":     &cfg.service.EvaluatorCheckTTL,
+		"EVALUATOR_CHECK_TIMEOUT": &cfg.service.EvaluatorCheckTimeout,
+		"BATCH_ITEM_TIMEOUT":      &cfg.service.BatchItemTimeout,
+		"STREAM_TOKEN_TTL":        &cfg.service.StreamTokenTTL,
+	}
+	for name, d := range durations {
+		if v := os.Getenv(name); v != "" {
+			if *d, err = time.ParseDuration(v); err != nil {
+				err = fmt.Errorf("%s: %v", name, err)
+				return
+			}
+		}
+	}
+	cfg.service.StaleWhileRevalidate = os.Getenv("STALE_WHILE_REVALIDATE") == "true"
+	cfg.service.StreamTokenSecret = os.Getenv("STREAM_TOKEN_SECRET")
+	if v := os.Getenv("BASELINE"); v != "" {
+		if cfg.service.Baseline, err = dao.ParseBaseline(v); err != nil {
+			err = fmt.Errorf("BASELINE: %v", err)
+			return
+		}
+	}
+	cfg.clientRateLimit = 120
+	ints := map[string]*int{
+		"API_KEY_RATE_LIMIT":      &cfg.service.APIKeyRateLimit,
+		"API_KEY_DAILY_QUOTA":     &cfg.service.APIKeyDailyQuota,
+		"CLIENT_RATE_LIMIT":       &cfg.clientRateLimit,
+		"CLIENT_EVALUATION_LIMIT": &cfg.service.ClientEvaluationLimit,
+		"GLOBAL_EVALUATION_LIMIT": &cfg.service.GlobalEvaluationLimit,
+		"BATCH_CONCURRENCY":       &cfg.service.BatchConcurrency,
+		"MAX_BATCH_SIZE":          &cfg.service.MaxBatchSize,
+		"STREAM_MAX_POLLS":        &cfg.service.StreamMaxPolls,
+	}
+	for name, n := range ints {
+		if v := os.Getenv(name); v != "" {
+			if *n, err = strconv.Atoi(v); err != nil {
+				err = fmt.Errorf("%s: %v", name, err)
+				return
+			}
+		}
+	}
+
+	cfg.rateLimitStore = "memory"
+	if v := os.Getenv("RATE_LIMIT_STORE"); v != "" {
+		if v != "memory" && v != "database" {
+			err = fmt.Errorf("RATE_LIMIT_STORE: unknown store %q", v)
+			return
+		}
+		cfg.rateLimitStore = v
+	}
+	if cfg.trustedProxies, err = parsePrefixes(os.Getenv("TRUSTED_PROXIES")); err != nil {
+		err = fmt.Errorf("TRUSTED_PROXIES: %v", err)
+		return
+	}
+
+	cfg.frontend = os.Getenv("FRONTEND") != "false"
+	cfg.frontendConfig.APIBaseURL = apiPrefix
+	if v := os.Getenv("API_BASE_URL"); v != "" {
+		cfg.frontendConfig.APIBaseURL = strings.TrimSuffix(v, "/")
+	}
+	cfg.frontendConfig.APIKey = os.Getenv("FRONTEND_API_KEY")
+
+	cfg.homepage = scrapers.DefaultSafeClientConfig()
+	if cfg.homepage.Allowlist, err = parsePrefixes(os.Getenv("SCRAPER_ALLOWLIST")); err != nil {
+		err = fmt.Errorf("SCRAPER_ALLOWLIST: %v", err)
+		return
+	}
+	if v := os.Getenv("SCRAPER_MAX_REDIRECTS"); v != "" {
+		if cfg.homepage.MaxRedirects, err = strconv.Atoi(v); err != nil {
+			err = fmt.Errorf("SCRAPER_MAX_REDIRECTS: %v", err)
+			return
+		}
+	}
+	if v := os.Getenv("SCRAPER_MAX_BODY_SIZE"); v != "" {
+		if cfg.homepage.MaxBodySize, err = strconv.ParseInt(v, 10, 64); err != nil {
+			err = fmt.Errorf("SCRAPER_MAX_BODY_SIZE: %v", err)
+			return
+		}
+	}
+	cfg.cors = rest.DefaultCORSConfig()
+	lists := map[string]*[]string{
+		"CORS_ALLOWED_ORIGINS": &cfg.cors.AllowedOrigins,
+		"CORS_ALLOWED_METHODS": &cfg.cors.AllowedMethods,
+		"CORS_ALLOWED_HEADERS": &cfg.cors.AllowedHeaders,
+		"CORS_EXPOSED_HEADERS": &cfg.cors.ExposedHeaders,
+	}
+	for name, l := range lists {
+		if v, ok := os.LookupEnv(name); ok {
+			*l = splitList(v)
+		}
+	}
+	cfg.cors.AllowCredentials = os.Getenv("CORS_ALLOW_CREDENTIALS") == "true"
+	if v := os.Getenv("CORS_MAX_AGE"); v != "" {
+		if cfg.cors.MaxAge, err = time.ParseDuration(v); err != nil {
+			err = fmt.Errorf("CORS_MAX_AGE: %v", err)
+			return
+		}
+	}
+	if err = cfg.cors.Validate(); err != nil {
+		err = fmt.Errorf("CORS_ALLOW_CREDENTIALS: %v", err)
+		return
+	}
+	return
+}
+
+// Auxiliar function for parsing a comma separated list of CIDRs.
+func parsePrefixes(v string) (prefixes []netip.Prefix, err error) {
+	for _, cidr := range splitList(v) {
+		var prefix netip.Prefix
+		if prefix, err = netip.ParsePrefix(cidr); err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return
+}
+
+// Auxiliar function for splitting a comma separated setting, ignoring the
+// spaces and the empty values.
+func splitList(v string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// application - Struct owning the store, the scrapers, the caches and the
+// settings of a running instance of the server.
+type application struct {
+	config   config
+	service  *controller.Service
+	api      *rest.API
+	rpc      *rpc.Server
+	frontend http.Handler
+}
+
+// Prefix of the routes of the API used by the frontend.
+const apiPrefix = "/api/v1"
+
+// Default constructor for the application struct.
+func newApplication(cfg config, store dao.Store, scrapers controller.Scrapers) (*application, error) {
+	service := controller.NewService(store, scrapers, cfg.service)
+	api := rest.NewAPI(service)
+	api.DefaultVersion = cfg.apiVersion
+	api.AdminToken = cfg.adminToken
+	api.ClientRateLimit = cfg.clientRateLimit
+	api.TrustedProxies = cfg.trustedProxies
 	var err error
-	dao.DBConf, err = dao.InitDB()
-	if err != nil {
-		fmt.Println("Error initing DB")
+	if api.GraphQL, err = graph.NewSchema(service); err != nil {
+		return nil, err
+	}
+	if cfg.rateLimitStore == "database" {
+		// The buckets are shared by every replica using the same database.
+		service.Limiter = ratelimit.NewStoreLimiter(store)
+	}
+	rpcServer := rpc.NewServer(service)
+	rpcServer.RequireAPIKey = cfg.requireAPIKey
+	app := &application{
+		config:  cfg,
+		service: service,
+		api:     api,
+		rpc:     rpcServer,
+	}
+	if cfg.frontend {
+		if app.frontend, err = rest.FrontendHandler(frontend.Files, cfg.frontendConfig); err != nil {
+			return nil, err
+		}
+	}
+	return app, nil
+}
+
+// Method for building the router of the application.
+func (app *application) routes() http.Handler {
+	r := chi.NewRouter()
+	r.Use(rest.RequestLogger)
+	r.Use(rest.Instrument)
+	r.Use(rest.CORS(app.config.cors))
+	r.Get("/healthz", app.api.HealthEndPoint)
+	r.Get("/readyz", app.api.ReadinessEndPoint)
+	r.Get("/metrics", app.api.MetricsEndPoint)
+	r.Get("/api/openapi.json", app.api.OpenAPIEndPoint)
+	r.Route("/api/v1/domainEvaluations", func(r chi.Router) {
+		r.Use(rest.WithVersion(rest.V1))
+		app.evaluationRoutes(r, app.api.EvaluateDomainEndPoint, app.api.ViewPastEvaluationsEndPoint)
+	})
+	r.Route("/api/v2/domainEvaluations", func(r chi.Router) {
+		r.Use(rest.WithVersion(rest.V2))
+		app.evaluationRoutes(r, app.api.EvaluateDomainV2EndPoint, app.api.ViewPastEvaluationsV2EndPoint)
+	})
+	// Route of the clients written before the versions of the API, the version
+	// of its responses is chosen by the headers of the request.
+	r.Route("/domainEvaluations", func(r chi.Router) {
+		app.evaluationRoutes(r, app.api.EvaluateDomainEndPoint, app.api.ViewPastEvaluationsEndPoint)
+	})
+	for _, prefix := range []string{"/api/v1", "/api/v2", ""} {
+		r.Route(prefix+"/domainEvaluations:batch", app.batchRoutes)
+	}
+	r.Route("/api/graphql", func(r chi.Router) {
+		r.Use(app.api.RateLimit)
+		if app.config.requireAPIKey {
+			// The evaluate mutation counts against the daily quota by itself.
+			r.Use(app.api.RequireAPIKey(false))
+		}
+		r.Get("/", app.api.GraphQLEndPoint)
+		r.Post("/", app.api.GraphQLEndPoint)
+	})
+	r.Route("/admin/apiKeys", func(r chi.Router) {
+		r.Use(app.api.RequireAdmin)
+		r.Post("/", app.api.CreateAPIKeyEndPoint)
+		r.Get("/", app.api.ListAPIKeysEndPoint)
+		r.Delete("/{id}", app.api.RevokeAPIKeyEndPoint)
+		r.Get("/{id}/usage", app.api.APIKeyUsageEndPoint)
+	})
+	if app.frontend != nil {
+		// The frontend gets every path not taken by the API.
+		r.Handle("/*", app.frontend)
+	}
+	return r
+}
+
+// Method for registering the routes of the domain evaluations, given the
+// endpoints of a version of the API. The event streams and their tokens, the
+// exports, the diffs and the approved baselines are the same in every version.
+func (app *application) evaluationRoutes(r chi.Router, evaluate http.HandlerFunc, list http.HandlerFunc) {
+	r.Use(app.api.RateLimit)
+	if app.config.requireAPIKey {
+		// Only the evaluations of a domain count against the daily quota.
+		r.With(app.api.RequireAPIKey(false)).Get("/events", app.api.EventsEndPoint)
+		r.With(app.api.RequireAPIKey(false)).Get("/export", app.api.ExportEndPoint)
+		r.With(app.api.RequireAPIKey(true)).Get("/{domainName}", evaluate)
+		r.With(app.api.RequireAPIKey(true)).Get("/{domainName}/events", app.api.EvaluationEventsEndPoint)
+		r.With(app.api.RequireAPIKey(false)).Post("/streamTokens", app.api.StreamTokenEndPoint)
+		r.With(app.api.RequireAPIKey(false)).Get("/{domainName}/diff", app.api.DiffEndPoint)
+		r.Route("/{domainName}/approvedBaseline", app.approvedBaselineRoutes)
+		r.With(app.api.RequireAPIKey(false)).Get("/", list)
+		return
+	}
+	r.Get("/events", app.api.EventsEndPoint)
+	r.Get("/export", app.api.ExportEndPoint)
+	r.Get("/{domainName}", evaluate)
+	r.Get("/{domainName}/events", app.api.EvaluationEventsEndPoint)
+	r.With(app.api.RequireAPIKey(false)).Post("/streamTokens", app.api.StreamTokenEndPoint)
+	r.Get("/{domainName}/diff", app.api.DiffEndPoint)
+	r.Route("/{domainName}/approvedBaseline", app.approvedBaselineRoutes)
+	r.Get("/", list)
+}
+
+// Method for registering the routes of the approved baseline of a domain.
+// Reading it is like reading the evaluations, while approving or clearing it
+// is only allowed to the admins.
+func (app *application) approvedBaselineRoutes(r chi.Router) {
+	if app.config.requireAPIKey {
+		r.With(app.api.RequireAPIKey(false)).Get("/", app.api.ApprovedBaselineEndPoint)
 	} else {
-		r := chi.NewRouter()
-		r.Route("/domainEvaluations", func(r chi.Router) {
-			r.Get("/{domainName}", rest.EvaluateDomainEndPoint)
-			r.Get("/", rest.ViewPastEvaluationsEndPoint)
-		})
-		http.ListenAndServe(":3000", r)
+		r.Get("/", app.api.ApprovedBaselineEndPoint)
+	}
+	r.With(app.api.RequireAdmin).Put("/", app.api.ApproveBaselineEndPoint)
+	r.With(app.api.RequireAdmin).Delete("/", app.api.ClearApprovedBaselineEndPoint)
+}
+
+// Method for registering the routes of the batches of evaluations. Being new,
+// they answer the same in every version of the API.
+func (app *application) batchRoutes(r chi.Router) {
+	r.Use(app.api.RateLimit)
+	if app.config.requireAPIKey {
+		// Every domain of a batch counts against the daily quota by itself.
+		r.Use(app.api.RequireAPIKey(false))
+	}
+	r.Post("/", app.api.CreateBatchEndPoint)
+	r.Get("/{batchId}", app.api.BatchEndPoint)
+}
+
+// Method for serving the application until ctx is cancelled.
+// The gRPC server, when it has an address, runs alongside the http server,
+// and so do the evaluation of the watched domains and the batches left
+// unfinished by the previous run.
+// On cancellation the servers stop accepting connections, wait for the
+// requests in progress and then drain the evaluations still running.
+func (app *application) serve(ctx context.Context) error {
+	srv := &http.Server{Addr: app.config.addr, Handler: app.routes()}
+	// The event streams don't end by themselves, so they are closed on shutdown.
+	srv.RegisterOnShutdown(app.api.CloseStreams)
+	errs := make(chan error, 2)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+	if app.config.watchInterval > 0 {
+		go app.service.EvaluateWatchedDomains(ctx, app.config.watchInterval)
+	}
+	if err := app.service.ResumeBatches(ctx); err != nil {
+		slog.Error("resuming batches", "error", err)
+	}
+	var grpcSrv *grpc.Server
+	if app.config.grpcAddr != "" {
+		lis, err := net.Listen("tcp", app.config.grpcAddr)
+		if err != nil {
+			srv.Close()
+			return err
+		}
+		grpcSrv = app.rpc.GRPCServer()
+		go func() {
+			if err := grpcSrv.Serve(lis); err != nil {
+				errs <- err
+			}
+		}()
+	}
+
+	select {
+	case err := <-errs:
+		srv.Close()
+		if grpcSrv != nil {
+			grpcSrv.Stop()
+		}
+		return err
+	case <-ctx.Done():
+	}
+	slog.Info("shutting down", "timeout", app.config.shutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), app.config.shutdownTimeout)
+	defer cancel()
+	if grpcSrv != nil {
+		// The watch streams are ended first, the calls still open at the
+		// deadline are cancelled.
+		app.rpc.CloseStreams()
+		stopped := make(chan struct{})
+		go func() {
+			grpcSrv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-shutdownCtx.Done():
+			grpcSrv.Stop()
+		}
 	}
+	err := srv.Shutdown(shutdownCtx)
+	if err != nil {
+		// The requests still running at the deadline are cut.
+		srv.Close()
+	} else if err = <-errs; errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+	// The service is drained anyway, its background jobs are cancelled.
+	if serviceErr := app.service.Shutdown(shutdownCtx); err == nil {
+		err = serviceErr
+	}
+	return err
+}
+
+// Function for starting the server, it returns when the server stops.
+func run() error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("Error loading config: %v", err)
+	}
+	logger, err := logging.NewLogger(os.Stderr, cfg.logFormat, cfg.logLevel)
+	if err != nil {
+		return fmt.Errorf("Error loading config: %v", err)
+	}
+	slog.SetDefault(logger)
+	tp, err := tracing.NewProvider(context.Background(), cfg.tracesExporter)
+	if err != nil {
+		return fmt.Errorf("Error initing traces exporter: %v", err)
+	}
+	if tp != nil {
+		otel.SetTracerProvider(tp)
+		// Flushes the spans still in the batcher before exiting.
+		defer tp.Shutdown(context.Background())
+	}
+	db, err := dao.InitDB()
+	if err != nil {
+		return fmt.Errorf("Error initing DB: %v", err)
+	}
+	defer db.Close()
+	if cfg.migrate {
+		if err = dao.Migrate(context.Background(), db); err != nil {
+			return fmt.Errorf("Error migrating DB: %v", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	scr := controller.DefaultScrapers()
+	homepage := scrapers.NewHomepageScraper(cfg.homepage)
+	scr.Logo = homepage.Logo
+	scr.Title = homepage.Title
+	app, err := newApplication(cfg, dao.NewSQLStore(db), scr)
+	if err != nil {
+		return fmt.Errorf("Error building application: %v", err)
+	}
+	slog.Info("listening", "addr", cfg.addr, "grpcAddr", cfg.grpcAddr)
+	return app.serve(ctx)
+}
+
+func main() {
+	os.Exit(cliMain(os.Args[1:]))
 }
@@ -1,13 +1,42 @@
 package main
 
 import (
-	"database/sql"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+	"github.com/go-chi/chi"
 	"github.com/google/go-cmp/cmp"
   "github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+  pb "github.com/trotsdeveloper/truora_test/truora_test_golang/evaluationspb"
+  "github.com/trotsdeveloper/truora_test/truora_test_golang/export"
   "github.com/trotsdeveloper/truora_test/truora_test_golang/controller"
+  "github.com/trotsdeveloper/truora_test/truora_test_golang/ratelimit"
+  "github.com/trotsdeveloper/truora_test/truora_test_golang/rest"
+  "github.com/trotsdeveloper/truora_test/truora_test_golang/rpc"
+  "github.com/trotsdeveloper/truora_test/truora_test_golang/scrapers"
+  "github.com/trotsdeveloper/truora_test/truora_test_golang/validation"
+  "go.opentelemetry.io/otel"
+  sdktrace "go.opentelemetry.io/otel/sdk/trace"
+  "go.opentelemetry.io/otel/sdk/trace/tracetest"
+  "google.golang.org/grpc"
+  "google.golang.org/grpc/codes"
+  "google.golang.org/grpc/credentials/insecure"
+  "google.golang.org/grpc/metadata"
+  "google.golang.org/grpc/status"
 )
 
 func TestEvaluateDomain(t *testing.T) {
@@ -19,74 +48,77 @@ func TestEvaluateDomain(t *testing.T) {
 	}
 	dao.DropServerTable(db)
 	dao.DropDomainEvaluationTable(db)
+	dao.DropEvaluationLockTable(db)
 	dao.InitDomainEvaluationTable(db)
 	dao.InitServerTable(db)
+	dao.InitEvaluationLockTable(db)
 	dao.CleanDataInDB(db)
+	service := controller.NewService(dao.NewSQLStore(db), controller.DefaultScrapers(), controller.DefaultConfig())
 
 	domainName := `prueba1.com`
 	currentHour1, _ := time.Parse(time.RFC3339, `2016-01-01T15:00:00+02:00`)
-	expected1 := dao.DomainEvaluation{1, domainName, `2016-01-01T15:00:00+02:00`, true, make([]dao.Server, 0), ``, ``, ``, false}
-	makeEvalCase1 := func(t time.Time, s string) (dao.DomainEvaluation, error) {
+	expected1 := dao.DomainEvaluation{1, domainName, `2016-01-01T15:00:00+02:00`, true, make([]dao.Server, 0), ``, ``, ``, false, ``}
+	makeEvalCase1 := func(ctx context.Context, t time.Time, s string) (dao.DomainEvaluation, error) {
 		return expected1, nil
 	}
 	t.Run("CASE 1: NO PENDING EVALUATION AND NO PAST EVALUATION HOUR ",
-		testEvaluateDomainFunc(domainName, currentHour1, makeEvalCase1, db, expected1))
+		testEvaluateDomainFunc(service, domainName, currentHour1, makeEvalCase1, expected1))
 
 	domainName = `prueba1.com`
 	currentHour2, _ := time.Parse(time.RFC3339, `2016-01-01T15:00:15+02:00`)
 	expected2 := expected1
-	makeEvalCase2 := func(t time.Time, s string) (dao.DomainEvaluation, error) {
-		return dao.DomainEvaluation{2, domainName, `2016-01-01T15:00:15+02:00`, true, make([]dao.Server, 0), ``, ``, ``, false}, nil
+	makeEvalCase2 := func(ctx context.Context, t time.Time, s string) (dao.DomainEvaluation, error) {
+		return dao.DomainEvaluation{2, domainName, `2016-01-01T15:00:15+02:00`, true, make([]dao.Server, 0), ``, ``, ``, false, ``}, nil
 	}
 
 	t.Run("CASE 2: PENDING EVALUATION, CURRENT EVALUATION HOUR < PENDING EVALUATION HOUR + 20S",
-		testEvaluateDomainFunc(domainName, currentHour2, makeEvalCase2, db, expected2))
+		testEvaluateDomainFunc(service, domainName, currentHour2, makeEvalCase2, expected2))
 
 	domainName = `prueba1.com`
 	currentHour3, _ := time.Parse(time.RFC3339, `2016-01-01T15:00:25+02:00`)
-	expected3 := dao.DomainEvaluation{3, domainName, `2016-01-01T15:00:25+02:00`, true, make([]dao.Server, 0), ``, ``, ``, false}
-	makeEvalCase3 := func(t time.Time, s string) (dao.DomainEvaluation, error) {
+	expected3 := dao.DomainEvaluation{3, domainName, `2016-01-01T15:00:25+02:00`, true, make([]dao.Server, 0), ``, ``, ``, false, ``}
+	makeEvalCase3 := func(ctx context.Context, t time.Time, s string) (dao.DomainEvaluation, error) {
 		return expected3, nil
 	}
 
 	t.Run("CASE 3: PENDING EVALUATION, CURRENT HOUR > PENDING EVALUATION HOUR + 20 | CURRENT EVALUATION IN PROGRESS",
-		testEvaluateDomainFunc(domainName, currentHour3, makeEvalCase3, db, expected3))
+		testEvaluateDomainFunc(service, domainName, currentHour3, makeEvalCase3, expected3))
 
 	domainName = `prueba1.com`
 	currentHour4, _ := time.Parse(time.RFC3339, `2016-01-01T15:00:48+02:00`)
-	expected4 := dao.DomainEvaluation{4, domainName, `2016-01-01T15:00:48+02:00`, false, make([]dao.Server, 0), `A+`, ``, ``,false}
-	makeEvalCase4 := func(t time.Time, s string) (dao.DomainEvaluation, error) {
+	expected4 := dao.DomainEvaluation{4, domainName, `2016-01-01T15:00:48+02:00`, false, make([]dao.Server, 0), `A+`, ``, ``,false, ``}
+	makeEvalCase4 := func(ctx context.Context, t time.Time, s string) (dao.DomainEvaluation, error) {
 		return expected4, nil
 	}
 	t.Run("CASE 4: PENDING EVALUATION, CURRENT HOUR > PENDING EVALUATION HOUR + 20 | !CURRENT EVALUATION IN PROGRESS ",
-		testEvaluateDomainFunc(domainName, currentHour4, makeEvalCase4, db, expected4))
+		testEvaluateDomainFunc(service, domainName, currentHour4, makeEvalCase4, expected4))
 
 	domainName = `prueba1.com`
 	currentHour5, _ := time.Parse(time.RFC3339, `2016-01-01T15:01:01+02:00`)
 	expected5 := expected4
-	makeEvalCase5 := func(t time.Time, s string) (dao.DomainEvaluation, error) {
-		return dao.DomainEvaluation{5, domainName, `2016-01-01T15:01:01+02:00`, false, make([]dao.Server, 0), `B+`, ``, ``,false}, nil
+	makeEvalCase5 := func(ctx context.Context, t time.Time, s string) (dao.DomainEvaluation, error) {
+		return dao.DomainEvaluation{5, domainName, `2016-01-01T15:01:01+02:00`, false, make([]dao.Server, 0), `B+`, ``, ``,false, ``}, nil
 	}
 	t.Run("CASE 5: PAST EVALUATION, CURRENT HOUR < PAST EVALUATION HOUR + 20",
-		testEvaluateDomainFunc(domainName, currentHour5, makeEvalCase5, db, expected5))
+		testEvaluateDomainFunc(service, domainName, currentHour5, makeEvalCase5, expected5))
 
 	domainName = `prueba1.com`
 	currentHour6, _ := time.Parse(time.RFC3339, `2016-01-01T15:01:18+02:00`)
-	expected6 := dao.DomainEvaluation{6, domainName, `2016-01-01T15:01:18+02:00`, false, make([]dao.Server, 0), `B+`, ``, ``,false}
-	makeEvalCase6 := func(t time.Time, s string) (dao.DomainEvaluation, error) {
-		return dao.DomainEvaluation{6, domainName, `2016-01-01T15:01:18+02:00`, false, make([]dao.Server, 0), `B+`, ``, ``,false}, nil
+	expected6 := dao.DomainEvaluation{6, domainName, `2016-01-01T15:01:18+02:00`, false, make([]dao.Server, 0), `B+`, ``, ``,false, ``}
+	makeEvalCase6 := func(ctx context.Context, t time.Time, s string) (dao.DomainEvaluation, error) {
+		return dao.DomainEvaluation{6, domainName, `2016-01-01T15:01:18+02:00`, false, make([]dao.Server, 0), `B+`, ``, ``,false, ``}, nil
 	}
 	t.Run("CASE 6: PAST EVALUATION, CURRENT HOUR > PAST EVALUATION HOUR + 20",
-		testEvaluateDomainFunc(domainName, currentHour6, makeEvalCase6, db, expected6))
+		testEvaluateDomainFunc(service, domainName, currentHour6, makeEvalCase6, expected6))
 
 	dao.CleanDataInDB(db)
 	db.Close()
 }
 
-func testEvaluateDomainFunc(domainName string, currentHour time.Time, evaluator func(time.Time, string) (dao.DomainEvaluation, error),
-	db *sql.DB, expected dao.DomainEvaluation) func(*testing.T) {
+func testEvaluateDomainFunc(service *controller.Service, domainName string, currentHour time.Time,
+	evaluator controller.Evaluator, expected dao.DomainEvaluation) func(*testing.T) {
 	return func(t *testing.T) {
-		actual, _, apiErr := controller.EvaluateDomain(domainName, currentHour, evaluator, db)
+		actual, _, apiErr := service.EvaluateDomain(context.Background(), domainName, currentHour, evaluator)
 		if apiErr != controller.DefaultAPIError() {
 			t.Error(fmt.Sprintf("Exception: %v", apiErr))
 		}
@@ -108,64 +140,66 @@ func TestDBFunctions(t *testing.T) {
 		t.Error(fmt.Sprintf("Exception: %v", err))
 	}
 	dao.CleanDataInDB(db)
+	store := dao.NewSQLStore(db)
+	service := controller.NewService(store, controller.DefaultScrapers(), controller.DefaultConfig())
 
 	domainName := `prueba1.com`
 	currentHour1, _ := time.Parse(time.RFC3339, `2016-01-01T15:00:00+02:00`)
 
-	makeEvalCase1 := func(t time.Time, s string) (dao.DomainEvaluation, error) {
+	makeEvalCase1 := func(ctx context.Context, t time.Time, s string) (dao.DomainEvaluation, error) {
 		servers1 := []dao.Server{dao.Server{Address: `128.30.20.10`}, dao.Server{Address: `128.28.20.10`}}
-		return dao.DomainEvaluation{1, s, `2016-01-01T15:00:00+02:00`, false, servers1, `A+`, ``, ``, false}, nil
+		return dao.DomainEvaluation{1, s, `2016-01-01T15:00:00+02:00`, false, servers1, `A+`, ``, ``, false, ``}, nil
 	}
-	se1, _, _:= controller.EvaluateDomain(domainName, currentHour1, makeEvalCase1, db)
+	se1, _, _:= service.EvaluateDomain(context.Background(), domainName, currentHour1, makeEvalCase1)
 	t.Run("ServersChanged | CASE 1: NO PAST DOMAIN EVALUATIONS IN DATABASE",
-		testHaveServersChangedFunc(se1, db, dao.SLStatus.NoPastEvaluation))
+		testHaveServersChangedFunc(se1, store, dao.SLStatus.NoPastEvaluation))
 	t.Run("PreviousSSlGrade | CASE 1: NO PAST DOMAIN EVALUATIONS IN DATABASE",
-		testPreviousSSLGradeFunc(se1, db, "NO EVALUATION"))
+		testPreviousSSLGradeFunc(se1, store, "NO EVALUATION"))
 
 	domainName = `prueba1.com`
 	currentHour2, _ := time.Parse(time.RFC3339, `2016-01-01T15:30:00+02:00`)
-	makeEvalCase2 := func(t time.Time, s string) (dao.DomainEvaluation, error) {
+	makeEvalCase2 := func(ctx context.Context, t time.Time, s string) (dao.DomainEvaluation, error) {
 		servers2 := []dao.Server{dao.Server{Address: `128.30.20.10`}, dao.Server{Address: `128.28.20.10`}}
-		return dao.DomainEvaluation{1, s, `2016-01-01T15:30:00+02:00`, false, servers2, `A+`, ``, ``, false}, nil
+		return dao.DomainEvaluation{1, s, `2016-01-01T15:30:00+02:00`, false, servers2, `A+`, ``, ``, false, ``}, nil
 	}
-	se2, _, _:= controller.EvaluateDomain(domainName, currentHour2, makeEvalCase2, db)
+	se2, _, _:= service.EvaluateDomain(context.Background(), domainName, currentHour2, makeEvalCase2)
 	t.Run("ServersChanged | CASE 2: NO PAST DOMAIN EVALUATIONS ONE HOUR BEFORE",
-		testHaveServersChangedFunc(se2, db, dao.SLStatus.NoPastEvaluation))
+		testHaveServersChangedFunc(se2, store, dao.SLStatus.NoPastEvaluation))
 	t.Run("PreviousSSlGrade | CASE 2: NO PAST DOMAIN EVALUATIONS ONE HOUR BEFORE",
-		testPreviousSSLGradeFunc(se2, db, "NO EVALUATION"))
+		testPreviousSSLGradeFunc(se2, store, "NO EVALUATION"))
 
 	domainName = `prueba1.com`
 	currentHour3, _ := time.Parse(time.RFC3339, `2016-01-01T16:20:00+02:00`)
-	makeEvalCase3 := func(t time.Time, s string) (dao.DomainEvaluation, error) {
+	makeEvalCase3 := func(ctx context.Context, t time.Time, s string) (dao.DomainEvaluation, error) {
 		servers3 := []dao.Server{dao.Server{Address: `128.30.20.10`}, dao.Server{Address: `128.28.20.10`}}
-		return dao.DomainEvaluation{1, s, `2016-01-01T16:20:00+02:00`, false, servers3, `A+`, ``, ``, false}, nil
+		return dao.DomainEvaluation{1, s, `2016-01-01T16:20:00+02:00`, false, servers3, `A+`, ``, ``, false, ``}, nil
 	}
 
-	se3, _, _ := controller.EvaluateDomain(domainName, currentHour3, makeEvalCase3, db)
+	se3, _, _ := service.EvaluateDomain(context.Background(), domainName, currentHour3, makeEvalCase3)
 	t.Run("ServersChanged | CASE 3: PAST SERVER EVALUATION IN DATABASE | SERVER LIST UNCHANGED",
-		testHaveServersChangedFunc(se3, db, dao.SLStatus.Unchanged))
+		testHaveServersChangedFunc(se3, store, dao.SLStatus.Unchanged))
 	t.Run("PreviousSSlGrade | CASE 3: PAST SERVER EVALUATION IN DATABASE | PREVIOUS SSL GRADE UNCHANGED",
-		testPreviousSSLGradeFunc(se3, db, "A+"))
+		testPreviousSSLGradeFunc(se3, store, "A+"))
 
 	domainName = `prueba1.com`
 	currentHour4, _ := time.Parse(time.RFC3339, `2016-01-01T16:25:00+02:00`)
-	makeEvalCase4 := func(t time.Time, s string) (dao.DomainEvaluation, error) {
+	makeEvalCase4 := func(ctx context.Context, t time.Time, s string) (dao.DomainEvaluation, error) {
 		servers4 := []dao.Server{dao.Server{Address: `128.30.28.10`}, dao.Server{Address: `128.28.20.10`}}
-		return dao.DomainEvaluation{1, s, `2016-01-01T16:25:00+02:00`, false, servers4, `B+`, ``, ``, false}, nil
+		return dao.DomainEvaluation{1, s, `2016-01-01T16:25:00+02:00`, false, servers4, `B+`, ``, ``, false, ``}, nil
 	}
-	se4, _, _ := controller.EvaluateDomain(domainName, currentHour4, makeEvalCase4, db)
+	se4, _, _ := service.EvaluateDomain(context.Background(), domainName, currentHour4, makeEvalCase4)
 	t.Run("ServersChanged | CASE 4: PAST SERVER EVALUATION IN DATABASE | SERVER LIST CHANGED",
-		testHaveServersChangedFunc(se4, db, dao.SLStatus.Changed))
+		testHaveServersChangedFunc(se4, store, dao.SLStatus.Changed))
 	t.Run("PreviousSSlGrade | CASE 4: PAST SERVER EVALUATION IN DATABASE | PREVIOUS SSL GRADE CHANGED",
-		testPreviousSSLGradeFunc(se4, db, "A+"))
+		testPreviousSSLGradeFunc(se4, store, "A+"))
 
 	dao.CleanDataInDB(db)
 	db.Close()
 }
 
-func testHaveServersChangedFunc(se dao.DomainEvaluation, db *sql.DB, expected int) func(*testing.T) {
+func testHaveServersChangedFunc(se dao.DomainEvaluation, store dao.Store, expected int) func(*testing.T) {
 	return func(t *testing.T) {
-		actual, err := se.HaveServersChanged(db)
+		actual, err := se.HaveServersChanged(context.Background(), store)
 		if err != nil {
 			t.Error(fmt.Sprintf("Exception: %v", err))
 		}
@@ -175,9 +209,9 @@ func testHaveServersChangedFunc(se dao.DomainEvaluation, db *sql.DB, expected in
 	}
 }
 
-func testPreviousSSLGradeFunc(se dao.DomainEvaluation, db *sql.DB, expected string) func(*testing.T) {
+func testPreviousSSLGradeFunc(se dao.DomainEvaluation, store dao.Store, expected string) func(*testing.T) {
 	return func(t *testing.T) {
-		actual, err := se.PreviousSSLgrade(db)
+		actual, err := se.PreviousSSLgrade(context.Background(), store)
 		if err != nil {
 			t.Error(fmt.Sprintf("Exception: %v", err))
 		}
@@ -186,3 +220,2098 @@ func testPreviousSSLGradeFunc(se dao.DomainEvaluation, db *sql.DB, expected stri
 		}
 	}
 }
+
+// FUNCTION BLOCK
+// EvaluationsCache
+func TestEvaluationsCache(t *testing.T) {
+	loads := 0
+	load := func(ctx context.Context) ([]dao.DomainEvaluation, error) {
+		loads++
+		return []dao.DomainEvaluation{dao.DomainEvaluation{Id: loads, Domain: `prueba1.com`}}, nil
+	}
+	cache := controller.NewEvaluationsCache(time.Second*20, false)
+	currentHour, _ := time.Parse(time.RFC3339, `2016-01-01T15:00:00+02:00`)
+
+	t.Run("CASE 1: EMPTY CACHE", testEvaluationsCacheFunc(cache, currentHour, load, 1))
+	t.Run("CASE 2: CURRENT HOUR < LAST LOAD + TTL",
+		testEvaluationsCacheFunc(cache, currentHour.Add(time.Second*10), load, 1))
+	t.Run("CASE 3: CURRENT HOUR > LAST LOAD + TTL",
+		testEvaluationsCacheFunc(cache, currentHour.Add(time.Second*25), load, 2))
+	cache.Invalidate()
+	t.Run("CASE 4: INVALIDATED CACHE",
+		testEvaluationsCacheFunc(cache, currentHour.Add(time.Second*26), load, 3))
+}
+
+func testEvaluationsCacheFunc(cache *controller.EvaluationsCache, currentHour time.Time,
+	load func(context.Context) ([]dao.DomainEvaluation, error), expected int) func(*testing.T) {
+	return func(t *testing.T) {
+		actual, err := cache.Get(context.Background(), `recent`, currentHour, load)
+		if err != nil {
+			t.Error(fmt.Sprintf("Exception: %v", err))
+		}
+		if len(actual) != 1 || actual[0].Id != expected {
+			t.Error(fmt.Sprintf("Expected load: %v, Actual: %v", expected, actual))
+		}
+	}
+}
+
+// Function for building scrapers that don't leave the process.
+// The evaluator returns a ready evaluation with the given grade.
+func fakeScrapers(grade string) controller.Scrapers {
+	scrap := func(ctx context.Context, s string) (string, error) {
+		return `fake ` + s, nil
+	}
+	return controller.Scrapers{
+		Evaluator: func(ctx context.Context, t time.Time, s string) (dao.DomainEvaluation, error) {
+			servers := []dao.Server{dao.Server{Address: `128.30.20.10`, SslGrade: grade}}
+			return dao.DomainEvaluation{Domain: s, EvaluationHour: t.Format(time.RFC3339),
+				Servers: servers, SslGrade: grade}, nil
+		},
+		Logo:    scrap,
+		Title:   scrap,
+		Country: scrap,
+		Owner:   scrap,
+	}
+}
+
+// Function for starting an application with an in-memory store in a test server.
+// The API keys aren't required, see TestAPIKeys for them.
+func newTestApplication(t *testing.T, scrapers controller.Scrapers) *httptest.Server {
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	cfg.requireAPIKey = false
+	return newTestServer(t, cfg, scrapers)
+}
+
+// Function for serving an application with the given settings in a test server.
+func newTestServer(t *testing.T, cfg config, scrapers controller.Scrapers) *httptest.Server {
+	app, err := newApplication(cfg, dao.NewMemoryStore(), scrapers)
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	ts := httptest.NewServer(app.routes())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// Function for doing a GET request against a test server and decoding its json.
+func getJSON(t *testing.T, url string, v interface{}) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	defer resp.Body.Close()
+	if err = json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+}
+
+// FUNCTION BLOCK
+// Independent application instances
+func TestApplicationInstances(t *testing.T) {
+	ts1 := newTestApplication(t, fakeScrapers(`A+`))
+	ts2 := newTestApplication(t, fakeScrapers(`B`))
+
+	var evaluation rest.EvaluationResponse
+	getJSON(t, ts1.URL+`/domainEvaluations/prueba1.com`, &evaluation)
+	if len(evaluation.APIErrors) != 0 {
+		t.Error(fmt.Sprintf("Exception: %v", evaluation.APIErrors))
+	}
+	if evaluation.Evaluation.SslGrade != `A+` || evaluation.Evaluation.Title != `fake prueba1.com` ||
+		len(evaluation.Evaluation.Servers) != 1 || evaluation.Evaluation.Servers[0].Owner != `fake 128.30.20.10` {
+		t.Error(fmt.Sprintf("Unexpected evaluation: %v", evaluation.Evaluation))
+	}
+
+	var past1, past2 rest.PastEvaluationsResponse
+	getJSON(t, ts1.URL+`/domainEvaluations/`, &past1)
+	getJSON(t, ts2.URL+`/domainEvaluations/`, &past2)
+	if len(past1.Evaluations) != 1 || past1.Evaluations[0].Title != `fake prueba1.com` {
+		t.Error(fmt.Sprintf("Expected 1 evaluation in the first instance, Actual: %v", past1.Evaluations))
+	}
+	if len(past2.Evaluations) != 0 {
+		t.Error(fmt.Sprintf("Expected 0 evaluations in the second instance, Actual: %v", past2.Evaluations))
+	}
+}
+
+// FUNCTION BLOCK
+// Health endpoints
+func TestHealthEndpoints(t *testing.T) {
+	ts := newTestApplication(t, fakeScrapers(`A+`))
+	for _, path := range []string{`/healthz`, `/readyz`} {
+		var health rest.HealthResponse
+		getJSON(t, ts.URL+path, &health)
+		if health.Status != `ok` {
+			t.Error(fmt.Sprintf("%v | Expected: ok, Actual: %v", path, health))
+		}
+	}
+}
+
+// FUNCTION BLOCK
+// Checks of the evaluator in the readiness probes
+func TestReadinessEvaluatorCheck(t *testing.T) {
+	cfg := controller.DefaultConfig()
+	cfg.EvaluatorCheckTimeout = time.Millisecond * 50
+	var calls int32
+	scrap := fakeScrapers(`A`)
+	scrap.EvaluatorInfo = func(ctx context.Context) (scrapers.SSLabsInfo, error) {
+		atomic.AddInt32(&calls, 1)
+		<-ctx.Done()
+		return scrapers.SSLabsInfo{}, ctx.Err()
+	}
+	s := controller.NewService(dao.NewMemoryStore(), scrap, cfg)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if ready, checks := s.Readiness(context.Background()); ready {
+			t.Error(fmt.Sprintf("Expected the service not to be ready, Actual: %v", checks))
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Error(fmt.Sprintf("Expected the checks to time out quickly, Actual: %v", elapsed))
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Error(fmt.Sprintf("Expected a single check of the evaluator, Actual: %v", n))
+	}
+}
+
+// FUNCTION BLOCK
+// Metrics endpoint
+func TestMetricsEndpoint(t *testing.T) {
+	ts := newTestApplication(t, fakeScrapers(`A+`))
+	var evaluation rest.EvaluationResponse
+	getJSON(t, ts.URL+`/domainEvaluations/prueba1.com`, &evaluation)
+
+	resp, err := http.Get(ts.URL + `/metrics`)
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	for _, expected := range []string{`route="/domainEvaluations/{domainName}"`, `outcome="fresh"`,
+		`grade="A+"`} {
+		if !strings.Contains(string(body), expected) {
+			t.Error(fmt.Sprintf("Expected %v in the metrics", expected))
+		}
+	}
+}
+
+// FUNCTION BLOCK
+// Request IDs
+func TestRequestID(t *testing.T) {
+	ts := newTestApplication(t, fakeScrapers(`A+`))
+	req, err := http.NewRequest(http.MethodGet, ts.URL+`/domainEvaluations/prueba1.com`, nil)
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	req.Header.Set(rest.RequestIDHeader, `test-request-1`)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	resp.Body.Close()
+	if id := resp.Header.Get(rest.RequestIDHeader); id != `test-request-1` {
+		t.Error(fmt.Sprintf("Expected: test-request-1, Actual: %v", id))
+	}
+
+	// The evaluation stored by the request keeps its request ID.
+	var past rest.PastEvaluationsResponse
+	getJSON(t, ts.URL+`/domainEvaluations/`, &past)
+	if len(past.Evaluations) != 1 || past.Evaluations[0].RequestId != `test-request-1` {
+		t.Error(fmt.Sprintf("Unexpected evaluations: %v", past.Evaluations))
+	}
+
+	// Invalid request IDs are replaced by a generated one.
+	req.Header.Set(rest.RequestIDHeader, `bad id!`)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	resp.Body.Close()
+	if id := resp.Header.Get(rest.RequestIDHeader); id == `` || id == `bad id!` {
+		t.Error(fmt.Sprintf("Unexpected request ID: %q", id))
+	}
+}
+
+// FUNCTION BLOCK
+// Tracing of the evaluation pipeline
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	ts := newTestApplication(t, fakeScrapers(`A+`))
+	var evaluation rest.EvaluationResponse
+	getJSON(t, ts.URL+`/domainEvaluations/prueba1.com`, &evaluation)
+
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	attr := func(span tracetest.SpanStub, key string) string {
+		for _, kv := range span.Attributes {
+			if string(kv.Key) == key {
+				return kv.Value.AsString()
+			}
+		}
+		return ``
+	}
+	// name of the span: name of its parent
+	parents := map[string]string{
+		`EvaluateDomainTW`:                  `ScraperTestComplete`,
+		`EvaluateDomainTW.createEvaluation`: `EvaluateDomainTW`,
+		`evaluator`:                         `EvaluateDomainTW.createEvaluation`,
+		`scraper.logo`:                      `ScraperTestComplete`,
+		`scraper.title`:                     `ScraperTestComplete`,
+		`scraper.country`:                   `ScraperTestComplete`,
+		`scraper.owner`:                     `ScraperTestComplete`,
+	}
+	for name, parent := range parents {
+		span, ok := spans[name]
+		if !ok {
+			t.Error(fmt.Sprintf("Expected span %v", name))
+			continue
+		}
+		if span.Parent.SpanID() != spans[parent].SpanContext.SpanID() {
+			t.Error(fmt.Sprintf("Expected %v as parent of %v", parent, name))
+		}
+	}
+	if branch := attr(spans[`EvaluateDomainTW`], `evaluation.branch`); branch != `1.2.2` {
+		t.Error(fmt.Sprintf("Branch | Expected: 1.2.2, Actual: %v", branch))
+	}
+	if domain := attr(spans[`evaluator`], `domain`); domain != `prueba1.com` {
+		t.Error(fmt.Sprintf("Domain | Expected: prueba1.com, Actual: %v", domain))
+	}
+	if ip := attr(spans[`scraper.country`], `server.ip`); ip != `128.30.20.10` {
+		t.Error(fmt.Sprintf("Server IP | Expected: 128.30.20.10, Actual: %v", ip))
+	}
+}
+
+// Function for doing a GET request choosing the version of the responses.
+func getVersion(t *testing.T, url string, version string) *http.Response {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	req.Header.Set(rest.VersionHeader, version)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	return resp
+}
+
+// FUNCTION BLOCK
+// HTTP status codes and problem responses
+func TestHTTPStatus(t *testing.T) {
+	failing := fakeScrapers(`A+`)
+	failing.Evaluator = func(ctx context.Context, t time.Time, s string) (dao.DomainEvaluation, error) {
+		return dao.DomainEvaluation{}, fmt.Errorf("SSLabs is down")
+	}
+	inProgress := fakeScrapers(``)
+	inProgress.Evaluator = func(ctx context.Context, t time.Time, s string) (dao.DomainEvaluation, error) {
+		return dao.DomainEvaluation{Domain: s, EvaluationHour: t.Format(time.RFC3339), EvaluationInProgress: true}, nil
+	}
+
+	cases := []struct {
+		scrapers    controller.Scrapers
+		path        string
+		version     string
+		status      int
+		contentType string
+	}{
+		{fakeScrapers(`A+`), `/domainEvaluations/prueba1.com`, `2`, http.StatusOK, `application/json; charset=utf-8`},
+		{inProgress, `/domainEvaluations/prueba1.com`, `2`, http.StatusAccepted, `application/json; charset=utf-8`},
+		{failing, `/domainEvaluations/prueba1.com`, `2`, http.StatusBadGateway, rest.ProblemContentType},
+		{failing, `/domainEvaluations/prueba1.com`, `1`, http.StatusOK, `application/json; charset=utf-8`},
+		{fakeScrapers(`A+`), `/domainEvaluations/bad%20domain`, `2`, http.StatusBadRequest, rest.ProblemContentType},
+	}
+	for i, c := range cases {
+		ts := newTestApplication(t, c.scrapers)
+		resp := getVersion(t, ts.URL+c.path, c.version)
+		resp.Body.Close()
+		if resp.StatusCode != c.status || resp.Header.Get("Content-Type") != c.contentType {
+			t.Error(fmt.Sprintf("Case %v | Expected: %v %v, Actual: %v %v", i, c.status, c.contentType,
+				resp.StatusCode, resp.Header.Get("Content-Type")))
+		}
+	}
+
+	// The problem keeps the APIErrors of the request.
+	ts := newTestApplication(t, failing)
+	resp := getVersion(t, ts.URL+`/domainEvaluations/prueba1.com`, `2`)
+	defer resp.Body.Close()
+	var problem rest.Problem
+	if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	if problem.Status != http.StatusBadGateway || len(problem.Errors) != 1 || problem.Errors[0].Code != `602` {
+		t.Error(fmt.Sprintf("Unexpected problem: %v", problem))
+	}
+}
+
+// FUNCTION BLOCK
+// Domain name validation and normalization
+func TestNormalizeDomain(t *testing.T) {
+	valid := map[string]string{
+		`prueba1.com`:       `prueba1.com`,
+		`PRUEBA1.Com`:       `prueba1.com`,
+		`prueba1.com.`:      `prueba1.com`,
+		`www.prueba1.co.uk`: `www.prueba1.co.uk`,
+		`bücher.com`:        `xn--bcher-kva.com`,
+	}
+	for domain, expected := range valid {
+		normalized, err := validation.NormalizeDomain(domain)
+		if err != nil || normalized != expected {
+			t.Error(fmt.Sprintf("%v | Expected: %v, Actual: %v %v", domain, expected, normalized, err))
+		}
+	}
+	invalid := []string{``, `.`, `prueba1.com/../x`, `prueba1.com?a=1`, `user@prueba1.com`,
+		`prueba1.com:443`, `128.30.20.10`, `[::1]`, `com`, `co.uk`, `prueba1.invalidtld`,
+		`-prueba1.com`, `prueba 1.com`, strings.Repeat(`a`, 63) + `.` + strings.Repeat(`b`, 40) + `.com`}
+	for _, domain := range invalid {
+		if normalized, err := validation.NormalizeDomain(domain); err == nil {
+			t.Error(fmt.Sprintf("%v | Expected an error, Actual: %v", domain, normalized))
+		}
+	}
+
+	// The normalized name is the one evaluated and stored.
+	ts := newTestApplication(t, fakeScrapers(`A+`))
+	var evaluation rest.EvaluationResponse
+	getJSON(t, ts.URL+`/domainEvaluations/PRUEBA1.com.`, &evaluation)
+	var past rest.PastEvaluationsResponse
+	getJSON(t, ts.URL+`/domainEvaluations/`, &past)
+	if len(past.Evaluations) != 1 || past.Evaluations[0].Domain != `prueba1.com` {
+		t.Error(fmt.Sprintf("Unexpected evaluations: %v", past.Evaluations))
+	}
+}
+
+// FUNCTION BLOCK
+// Grade of a domain from the grades of its servers
+func TestLowestGrade(t *testing.T) {
+	cases := []struct {
+		grades   []string
+		expected string
+	}{
+		{[]string{`A`, `A-`}, `A-`},
+		{[]string{`A-`, `A`}, `A-`},
+		{[]string{`A+`, `A`}, `A`},
+		{[]string{`A`, `B`, `A+`}, `B`},
+		{[]string{`T`, `M`}, `M`},
+		{[]string{`A`, ``, `B`}, `NaN`},
+		{[]string{}, `A+`},
+	}
+	for _, c := range cases {
+		servers := make([]dao.Server, 0, len(c.grades))
+		for _, grade := range c.grades {
+			servers = append(servers, dao.Server{Address: `128.30.20.10`, SslGrade: grade})
+		}
+		if grade := scrapers.LowestGrade(servers); grade != c.expected {
+			t.Error(fmt.Sprintf("%v | Expected: %v, Actual: %v", c.grades, c.expected, grade))
+		}
+	}
+}
+
+// FUNCTION BLOCK
+// SSRF protection of the homepage fetches
+func TestSafeClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get(`loop`) != `` {
+			http.Redirect(w, r, `/?loop=1`, http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, `<html><head><title>Prueba</title></head></html>`)
+	}))
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, `http://`)
+	ctx := context.Background()
+
+	// Loopback addresses are blocked by default.
+	_, err := scrapers.NewHomepageScraper(scrapers.DefaultSafeClientConfig()).Title(ctx, host)
+	var blocked *scrapers.BlockedError
+	if !errors.As(err, &blocked) || blocked.Reason != `loopback address` {
+		t.Error(fmt.Sprintf("Expected a blocked loopback address, Actual: %v", err))
+	}
+
+	// So are the addresses of "this network", not only the unspecified one.
+	_, err = scrapers.NewHomepageScraper(scrapers.DefaultSafeClientConfig()).Title(ctx, `0.1.2.3`)
+	if !errors.As(err, &blocked) || blocked.Reason != `this network` {
+		t.Error(fmt.Sprintf("Expected a blocked address of this network, Actual: %v", err))
+	}
+
+	// Allowlisted ranges can be reached.
+	cfg := scrapers.DefaultSafeClientConfig()
+	cfg.Allowlist = []netip.Prefix{netip.MustParsePrefix(`127.0.0.0/8`)}
+	title, err := scrapers.NewHomepageScraper(cfg).Title(ctx, host)
+	if err != nil || title != `Prueba` {
+		t.Error(fmt.Sprintf("Expected: Prueba, Actual: %v %v", title, err))
+	}
+
+	// Redirects and bodies are limited.
+	if _, err = scrapers.NewHomepageScraper(cfg).Title(ctx, host+`/?loop=1`); err == nil {
+		t.Error("Expected an error after too many redirects")
+	}
+	cfg.MaxBodySize = 10
+	if _, err = scrapers.NewHomepageScraper(cfg).Title(ctx, host); !errors.Is(err, scrapers.ErrBodyTooLarge) {
+		t.Error(fmt.Sprintf("Expected: %v, Actual: %v", scrapers.ErrBodyTooLarge, err))
+	}
+
+	// Blocked fetches are reported with their own APIError.
+	blockedScrapers := fakeScrapers(`A+`)
+	blockedScrapers.Logo = func(ctx context.Context, s string) (string, error) {
+		return ``, &scrapers.BlockedError{Address: netip.MustParseAddr(`169.254.169.254`), Reason: `link-local address`}
+	}
+	app := newTestApplication(t, blockedScrapers)
+	var evaluation rest.EvaluationResponse
+	getJSON(t, app.URL+`/domainEvaluations/prueba1.com`, &evaluation)
+	if len(evaluation.APIErrors) != 1 || evaluation.APIErrors[0].Code != `703` {
+		t.Error(fmt.Sprintf("Expected a 703 error, Actual: %v", evaluation.APIErrors))
+	}
+}
+
+// Function for doing a request against a test server with the given headers.
+func doRequest(t *testing.T, method string, url string, body string, headers map[string]string) *http.Response {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	return resp
+}
+
+// FUNCTION BLOCK
+// Default of the requirement of API keys
+func TestAPIKeyRequirement(t *testing.T) {
+	cases := []struct {
+		adminToken, requireAPIKey string
+		expected                  bool
+		fails                     bool
+	}{
+		{``, ``, false, false},
+		{`secreto`, ``, true, false},
+		{`secreto`, `false`, false, false},
+		{``, `true`, false, true},
+	}
+	for _, c := range cases {
+		t.Setenv(`ADMIN_TOKEN`, c.adminToken)
+		t.Setenv(`REQUIRE_API_KEY`, c.requireAPIKey)
+		cfg, err := loadConfig()
+		if (err != nil) != c.fails || (err == nil && cfg.requireAPIKey != c.expected) {
+			t.Error(fmt.Sprintf("%+v | Actual: %v %v", c, cfg.requireAPIKey, err))
+		}
+	}
+}
+
+// FUNCTION BLOCK
+// API keys, rate limits and daily quotas
+func TestAPIKeys(t *testing.T) {
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	cfg.requireAPIKey = true
+	cfg.adminToken = `secreto`
+	ts := newTestServer(t, cfg, fakeScrapers(`A+`))
+	admin := map[string]string{`Authorization`: `Bearer secreto`}
+
+	// The admin endpoints need the admin token.
+	resp := doRequest(t, http.MethodGet, ts.URL+`/admin/apiKeys/`, ``, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Error(fmt.Sprintf("Expected: 401, Actual: %v", resp.StatusCode))
+	}
+
+	resp = doRequest(t, http.MethodPost, ts.URL+`/admin/apiKeys/`,
+		`{"name": "prueba", "rate_limit": 3, "daily_quota": 1}`, admin)
+	var created rest.CreateAPIKeyResponse
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || !strings.HasPrefix(created.APIKey, created.Key.Prefix) {
+		t.Fatal(fmt.Sprintf("Unexpected key: %v %v", resp.StatusCode, created))
+	}
+	key := map[string]string{rest.APIKeyHeader: created.APIKey}
+
+	// Requests without a valid key are rejected.
+	for _, headers := range []map[string]string{nil, {rest.APIKeyHeader: `dek_falsa`}} {
+		resp = doRequest(t, http.MethodGet, ts.URL+`/domainEvaluations/`, ``, headers)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Error(fmt.Sprintf("Expected: 401, Actual: %v", resp.StatusCode))
+		}
+	}
+
+	// The first evaluation is allowed, the second one goes over the daily quota
+	// and the fourth request goes over the rate limit.
+	expected := []int{http.StatusOK, http.StatusTooManyRequests, http.StatusOK, http.StatusTooManyRequests}
+	urls := []string{`/domainEvaluations/prueba1.com`, `/domainEvaluations/prueba2.com`,
+		`/domainEvaluations/`, `/domainEvaluations/`}
+	for i, url := range urls {
+		resp = doRequest(t, http.MethodGet, ts.URL+url, ``, key)
+		resp.Body.Close()
+		if resp.StatusCode != expected[i] {
+			t.Error(fmt.Sprintf("%v Expected: %v, Actual: %v", url, expected[i], resp.StatusCode))
+		}
+		if resp.StatusCode == http.StatusTooManyRequests && resp.Header.Get(`Retry-After`) == `` {
+			t.Error(fmt.Sprintf("%v Expected a Retry-After header", url))
+		}
+	}
+
+	// The usage is visible to the admins.
+	var keys rest.APIKeysResponse
+	resp = doRequest(t, http.MethodGet, ts.URL+`/admin/apiKeys/`, ``, admin)
+	json.NewDecoder(resp.Body).Decode(&keys)
+	resp.Body.Close()
+	if len(keys.Keys) != 1 || keys.Keys[0].Today.Requests != 3 || keys.Keys[0].Today.Evaluations != 1 {
+		t.Error(fmt.Sprintf("Unexpected keys: %v", keys.Keys))
+	}
+
+	// Revoked keys are rejected.
+	resp = doRequest(t, http.MethodDelete, fmt.Sprintf(`%v/admin/apiKeys/%d`, ts.URL, created.Key.Id), ``, admin)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Error(fmt.Sprintf("Expected: 204, Actual: %v", resp.StatusCode))
+	}
+	resp = doRequest(t, http.MethodDelete, ts.URL+`/admin/apiKeys/999`, ``, admin)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Error(fmt.Sprintf("Expected: 404, Actual: %v", resp.StatusCode))
+	}
+}
+
+// FUNCTION BLOCK
+// CORS policy and preflight requests
+func TestCORS(t *testing.T) {
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	cfg.requireAPIKey = false
+	cfg.cors.AllowedOrigins = []string{`https://app.example.com`}
+	cfg.cors.AllowCredentials = true
+	ts := newTestServer(t, cfg, fakeScrapers(`A+`))
+
+	// Allowed preflight.
+	resp := doRequest(t, http.MethodOptions, ts.URL+`/domainEvaluations/prueba1.com`, ``, map[string]string{
+		`Origin`: `https://app.example.com`, `Access-Control-Request-Method`: `GET`,
+		`Access-Control-Request-Headers`: `x-api-key`})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent ||
+		resp.Header.Get(`Access-Control-Allow-Origin`) != `https://app.example.com` ||
+		resp.Header.Get(`Access-Control-Allow-Credentials`) != `true` {
+		t.Error(fmt.Sprintf("Unexpected preflight: %v %v", resp.StatusCode, resp.Header))
+	}
+
+	// Preflights from other origins or for other methods are rejected.
+	for _, headers := range []map[string]string{
+		{`Origin`: `https://evil.example.com`, `Access-Control-Request-Method`: `GET`},
+		{`Origin`: `https://app.example.com`, `Access-Control-Request-Method`: `PUT`},
+	} {
+		resp = doRequest(t, http.MethodOptions, ts.URL+`/domainEvaluations/`, ``, headers)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden || resp.Header.Get(`Access-Control-Allow-Origin`) != `` {
+			t.Error(fmt.Sprintf("Unexpected preflight: %v %v", resp.StatusCode, resp.Header))
+		}
+	}
+
+	// Simple requests get the headers only for the allowed origins, and vary on them.
+	for origin, expected := range map[string]string{`https://app.example.com`: `https://app.example.com`,
+		`https://evil.example.com`: ``} {
+		resp = doRequest(t, http.MethodGet, ts.URL+`/domainEvaluations/`, ``, map[string]string{`Origin`: origin})
+		resp.Body.Close()
+		if resp.Header.Get(`Access-Control-Allow-Origin`) != expected || resp.Header.Get(`Vary`) != `Origin` {
+			t.Error(fmt.Sprintf("Unexpected CORS headers for %v: %v", origin, resp.Header))
+		}
+	}
+
+	// The wildcard can't be combined with credentials.
+	cfg.cors = rest.DefaultCORSConfig()
+	cfg.cors.AllowCredentials = true
+	if cfg.cors.Validate() == nil {
+		t.Error("Expected an error allowing credentials for every origin")
+	}
+}
+
+// FUNCTION BLOCK
+// Rate limits per client and of the new evaluations
+func TestRateLimit(t *testing.T) {
+	// The client is only taken from X-Forwarded-For behind a trusted proxy.
+	proxies := []netip.Prefix{netip.MustParsePrefix(`10.0.0.0/8`)}
+	clientTests := []struct {
+		remoteAddr, forwardedFor, expected string
+	}{
+		{`203.0.113.5:1234`, ``, `203.0.113.5`},
+		{`203.0.113.5:1234`, `198.51.100.7`, `203.0.113.5`},
+		{`10.0.0.2:1234`, `198.51.100.7`, `198.51.100.7`},
+		{`10.0.0.2:1234`, `1.2.3.4, 198.51.100.7, 10.0.0.3`, `198.51.100.7`},
+		{`10.0.0.2:1234`, ``, `10.0.0.2`},
+	}
+	for _, ct := range clientTests {
+		r := httptest.NewRequest(http.MethodGet, `/`, nil)
+		r.RemoteAddr = ct.remoteAddr
+		if ct.forwardedFor != `` {
+			r.Header.Set(`X-Forwarded-For`, ct.forwardedFor)
+		}
+		if actual := rest.ClientIP(r, proxies); actual != ct.expected {
+			t.Error(fmt.Sprintf("%v %v Expected: %v, Actual: %v", ct.remoteAddr, ct.forwardedFor, ct.expected, actual))
+		}
+	}
+
+	// The buckets kept in the store are refilled with the time.
+	now := time.Now()
+	limiter := ratelimit.NewStoreLimiter(dao.NewMemoryStore())
+	limiter.Now = func() time.Time { return now }
+	rate := ratelimit.Rate{Limit: 1, Per: time.Minute}
+	for i, expected := range []bool{true, false} {
+		if d, _ := limiter.Allow(context.Background(), `prueba`, rate); d.Allowed != expected {
+			t.Error(fmt.Sprintf("Request %v Expected: %v, Actual: %v", i, expected, d))
+		}
+	}
+	now = now.Add(time.Minute)
+	if d, _ := limiter.Allow(context.Background(), `prueba`, rate); !d.Allowed {
+		t.Error(fmt.Sprintf("Expected a refilled bucket, Actual: %v", d))
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	cfg.requireAPIKey = false
+	cfg.clientRateLimit = 3
+	cfg.service.ClientEvaluationLimit = 1
+	ts := newTestServer(t, cfg, fakeScrapers(`A+`))
+
+	// The second new evaluation of the client is rejected.
+	var evaluation rest.EvaluationResponse
+	getJSON(t, ts.URL+`/domainEvaluations/prueba1.com`, &evaluation)
+	if len(evaluation.APIErrors) != 0 {
+		t.Error(fmt.Sprintf("Exception: %v", evaluation.APIErrors))
+	}
+	resp := doRequest(t, http.MethodGet, ts.URL+`/domainEvaluations/prueba2.com`, ``, nil)
+	json.NewDecoder(resp.Body).Decode(&evaluation)
+	resp.Body.Close()
+	if len(evaluation.APIErrors) != 1 || evaluation.APIErrors[0].Code != `909` || resp.Header.Get(`Retry-After`) == `` {
+		t.Error(fmt.Sprintf("Expected a 909 error, Actual: %v %v", evaluation.APIErrors, resp.Header))
+	}
+
+	// The fourth request of the client is rejected.
+	resp = doRequest(t, http.MethodGet, ts.URL+`/domainEvaluations/`, ``, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Error(fmt.Sprintf("Expected: 200, Actual: %v", resp.StatusCode))
+	}
+	resp = doRequest(t, http.MethodGet, ts.URL+`/domainEvaluations/`, ``, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get(`Retry-After`) == `` {
+		t.Error(fmt.Sprintf("Expected: 429, Actual: %v %v", resp.StatusCode, resp.Header))
+	}
+}
+
+// FUNCTION BLOCK
+// Polls of an evaluation in progress aren't limited
+func TestEvaluationPollsNotLimited(t *testing.T) {
+	cfg := controller.DefaultConfig()
+	cfg.DomainEvaluationTW = time.Second
+	cfg.ClientEvaluationLimit = 1
+	scrap := fakeScrapers(`A`)
+	evaluator := scrap.Evaluator
+	scrap.Evaluator = func(ctx context.Context, currentHour time.Time, domain string) (dao.DomainEvaluation, error) {
+		de, err := evaluator(ctx, currentHour, domain)
+		de.EvaluationInProgress = true
+		return de, err
+	}
+	s := controller.NewService(dao.NewMemoryStore(), scrap, cfg)
+	ctx := ratelimit.WithClient(context.Background(), `prueba`)
+	now := time.Now().UTC().Truncate(time.Second)
+	for i := 0; i < 4; i++ {
+		de, _, appErr := s.EvaluateDomain(ctx, `prueba1.com`, now.Add(time.Second*time.Duration(2*i)), scrap.Evaluator)
+		if appErr.Code != controller.DefaultAPIError().Code || !de.EvaluationInProgress {
+			t.Error(fmt.Sprintf("Poll %v | Expected an evaluation in progress, Actual: %v %v", i, de, appErr))
+		}
+	}
+	// New evaluations are still limited.
+	_, _, appErr := s.EvaluateDomain(ctx, `prueba2.com`, now.Add(time.Second*8), scrap.Evaluator)
+	if appErr.Code != `909` {
+		t.Error(fmt.Sprintf("Expected a 909 error, Actual: %v", appErr))
+	}
+}
+
+// FUNCTION BLOCK
+// Embedded frontend and prefix of the API
+func TestFrontend(t *testing.T) {
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	cfg.requireAPIKey = false
+	cfg.frontendConfig.APIKey = `dek_publica`
+	ts := newTestServer(t, cfg, fakeScrapers(`A+`))
+
+	frontendTests := []struct {
+		path, contains, cacheControl string
+	}{
+		{`/`, `<title>Truora Test</title>`, `no-cache`},
+		{`/evaluate_domain.html`, `src="config.js"`, `no-cache`},
+		{`/config.js`, `window.APP_CONFIG = {"apiBaseURL":"/api/v1","apiKey":"dek_publica"};`, `no-cache`},
+		{`/js/evaluate_domain.js`, `APP_CONFIG.apiBaseURL`, `no-cache`},
+		{`/assets/css/style.css`, ``, `public, max-age=604800`},
+	}
+	for _, ft := range frontendTests {
+		resp := doRequest(t, http.MethodGet, ts.URL+ft.path, ``, nil)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), ft.contains) ||
+			resp.Header.Get(`Cache-Control`) != ft.cacheControl {
+			t.Error(fmt.Sprintf("%v Unexpected response: %v %v", ft.path, resp.StatusCode, resp.Header))
+		}
+		// The browsers revalidate the files with their ETag.
+		resp = doRequest(t, http.MethodGet, ts.URL+ft.path, ``, map[string]string{`If-None-Match`: resp.Header.Get(`ETag`)})
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotModified {
+			t.Error(fmt.Sprintf("%v Expected: 304, Actual: %v", ft.path, resp.StatusCode))
+		}
+	}
+
+	resp := doRequest(t, http.MethodGet, ts.URL+`/missing.html`, ``, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Error(fmt.Sprintf("Expected: 404, Actual: %v", resp.StatusCode))
+	}
+
+	// The API is served under its prefix, and under the old route.
+	for _, path := range []string{`/api/v1/domainEvaluations/prueba1.com`, `/domainEvaluations/prueba1.com`} {
+		var evaluation rest.EvaluationResponse
+		getJSON(t, ts.URL+path, &evaluation)
+		if evaluation.Evaluation.SslGrade != `A+` {
+			t.Error(fmt.Sprintf("%v Unexpected evaluation: %v", path, evaluation.Evaluation))
+		}
+	}
+}
+
+// Function for validating a decoded json value against a schema of the
+// OpenAPI document doc. It supports the subset of the schemas generated by rest.OpenAPIDocument.
+func validateSchema(doc map[string]interface{}, schema map[string]interface{}, v interface{}, at string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		return validateSchema(doc, doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})[name].(map[string]interface{}), v, at)
+	}
+	if v == nil {
+		if schema["nullable"] == true {
+			return nil
+		}
+		return fmt.Errorf("%v: unexpected null", at)
+	}
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		return validateSchema(doc, allOf[0].(map[string]interface{}), v, at)
+	}
+	switch schema["type"] {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%v: expected an object, actual %v", at, v)
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := obj[name.(string)]; !ok {
+				return fmt.Errorf("%v: missing property %v", at, name)
+			}
+		}
+		for name, value := range obj {
+			propertySchema, ok := properties[name].(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%v: undocumented property %v", at, name)
+			}
+			if err := validateSchema(doc, propertySchema, value, at+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("%v: expected an array, actual %v", at, v)
+		}
+		for i, item := range items {
+			if err := validateSchema(doc, schema["items"].(map[string]interface{}), item, fmt.Sprintf("%v[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf("%v: expected a string, actual %v", at, v)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%v: expected a boolean, actual %v", at, v)
+		}
+	case "integer", "number":
+		if _, ok := v.(float64); !ok {
+			return fmt.Errorf("%v: expected a number, actual %v", at, v)
+		}
+	}
+	return nil
+}
+
+// FUNCTION BLOCK
+// The handlers of the versioned API follow the OpenAPI document
+func TestOpenAPI(t *testing.T) {
+	ts := newTestApplication(t, fakeScrapers(`A+`))
+	var doc map[string]interface{}
+	getJSON(t, ts.URL+`/api/openapi.json`, &doc)
+	paths := doc[`paths`].(map[string]interface{})
+
+	// Every route of the API is documented, and the legacy routes are the ones of v1.
+	documented := make(map[string]bool)
+	for _, op := range rest.Operations() {
+		documented[op.Method+` `+strings.TrimSuffix(op.Path, `/`)] = true
+	}
+	chi.Walk(ts.Config.Handler.(chi.Routes), func(method string, route string, handler http.Handler,
+		middlewares ...func(http.Handler) http.Handler) error {
+		path := strings.TrimSuffix(route, `/`)
+		if strings.HasPrefix(path, `/domainEvaluations`) {
+			path = `/api/v1` + path
+		}
+		if (strings.HasPrefix(path, `/api/`) || strings.HasPrefix(path, `/admin/`)) && path != `/api/openapi.json` &&
+			!documented[method+` `+path] {
+			t.Error(fmt.Sprintf("Undocumented route: %v %v", method, route))
+		}
+		return nil
+	})
+
+	// Every documented operation is requested with a valid and with an invalid domain.
+	for _, op := range rest.Operations() {
+		for _, domain := range []string{`prueba1.com`, `1.2.3.4`} {
+			url := strings.Replace(op.Path, `{domainName}`, domain, 1)
+			// The event stream of every domain doesn't end by itself.
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			req, _ := http.NewRequestWithContext(ctx, op.Method, ts.URL+url, nil)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				cancel()
+				t.Fatal(fmt.Sprintf("Exception: %v", err))
+			}
+			responses := paths[op.Path].(map[string]interface{})[strings.ToLower(op.Method)].(map[string]interface{})[`responses`].(map[string]interface{})
+			response, ok := responses[fmt.Sprint(resp.StatusCode)].(map[string]interface{})
+			if !ok {
+				t.Error(fmt.Sprintf("%v %v: undocumented status %v", op.Method, url, resp.StatusCode))
+			}
+			content, _ := response[`content`].(map[string]interface{})
+			for contentType, c := range content {
+				if !strings.HasPrefix(resp.Header.Get(`Content-Type`), contentType) {
+					t.Error(fmt.Sprintf("%v %v: Expected: %v, Actual: %v", op.Method, url, contentType, resp.Header.Get(`Content-Type`)))
+				}
+				if !strings.HasSuffix(contentType, `json`) {
+					continue
+				}
+				var body interface{}
+				if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+					t.Error(fmt.Sprintf("%v %v: Exception: %v", op.Method, url, err))
+					continue
+				}
+				schema := c.(map[string]interface{})[`schema`].(map[string]interface{})
+				if err := validateSchema(doc, schema, body, `body`); err != nil {
+					t.Error(fmt.Sprintf("%v %v: %v", op.Method, url, err))
+				}
+			}
+			resp.Body.Close()
+			cancel()
+		}
+	}
+
+	// The version of the responses is fixed by the route, whatever the headers say.
+	failing := fakeScrapers(`A+`)
+	failing.Evaluator = func(ctx context.Context, currentHour time.Time, domain string) (dao.DomainEvaluation, error) {
+		return dao.DomainEvaluation{}, errors.New(`SSLabs is down`)
+	}
+	failingTs := newTestApplication(t, failing)
+	for path, expected := range map[string]int{`/api/v1/domainEvaluations/prueba1.com`: http.StatusOK,
+		`/api/v2/domainEvaluations/prueba1.com`: http.StatusBadGateway} {
+		resp := getVersion(t, failingTs.URL+path, `1`)
+		resp.Body.Close()
+		if resp.StatusCode != expected {
+			t.Error(fmt.Sprintf("%v Expected: %v, Actual: %v", path, expected, resp.StatusCode))
+		}
+	}
+	var evaluation rest.EvaluationResponseV2
+	getJSON(t, ts.URL+`/api/v2/domainEvaluations/prueba1.com`, &evaluation)
+	if evaluation.Evaluation.Domain != `prueba1.com` || evaluation.Evaluation.SslGrade != `A+` {
+		t.Error(fmt.Sprintf("Unexpected evaluation: %v", evaluation.Evaluation))
+	}
+}
+
+// countingStore - MemoryStore counting the queries for the servers.
+type countingStore struct {
+	*dao.MemoryStore
+	serverQueries int
+}
+
+func (s *countingStore) ListServers(ctx context.Context, idDomainEvaluation int) ([]dao.Server, error) {
+	s.serverQueries++
+	return s.MemoryStore.ListServers(ctx, idDomainEvaluation)
+}
+
+func (s *countingStore) ListServersByEvaluations(ctx context.Context, ids []int) (map[int][]dao.Server, error) {
+	s.serverQueries++
+	return s.MemoryStore.ListServersByEvaluations(ctx, ids)
+}
+
+// Function for posting a GraphQL request to a test server.
+func postGraphQL(t *testing.T, url string, query string) (result struct {
+	Data   map[string]interface{}   `json:"data"`
+	Errors []map[string]interface{} `json:"errors"`
+}) {
+	body, _ := json.Marshal(map[string]string{`query`: query})
+	resp := doRequest(t, http.MethodPost, url+`/api/graphql/`, string(body), nil)
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	return
+}
+
+// FUNCTION BLOCK
+// GraphQL endpoint and batched loaders
+func TestGraphQL(t *testing.T) {
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	cfg.requireAPIKey = false
+	store := &countingStore{MemoryStore: dao.NewMemoryStore()}
+	grades := map[string][]string{`prueba1.com`: {`B`, `A`, `A`, `A+`}, `prueba2.com`: {`A`}, `prueba3.com`: {`C`}}
+	for domain, list := range grades {
+		for i, grade := range list {
+			de := dao.DomainEvaluation{Domain: domain, SslGrade: grade,
+				EvaluationHour: fmt.Sprintf(`2020-01-01T1%d:00:00Z`, i),
+				Servers:        []dao.Server{{Address: `128.30.20.1` + fmt.Sprint(i), SslGrade: grade}}}
+			store.CreateEvaluation(context.Background(), &de)
+		}
+	}
+	app, err := newApplication(cfg, store, fakeScrapers(`A+`))
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	ts := httptest.NewServer(app.routes())
+	t.Cleanup(ts.Close)
+
+	// The servers of every domain are loaded with a single query.
+	result := postGraphQL(t, ts.URL, `{ domains { name latestEvaluation { sslGrade servers { address } } } }`)
+	domains, _ := result.Data[`domains`].([]interface{})
+	if len(result.Errors) > 0 || len(domains) != 3 || store.serverQueries != 1 {
+		t.Error(fmt.Sprintf("Unexpected result: %v %v, server queries: %v", result.Data, result.Errors,
+			store.serverQueries))
+	}
+
+	result = postGraphQL(t, ts.URL, `{ domain(name: "PRUEBA1.com") { history(last: 2) { hour sslGrade }
+		gradeChanges { from to } } }`)
+	expected := map[string]interface{}{`domain`: map[string]interface{}{
+		`history`: []interface{}{
+			map[string]interface{}{`hour`: `2020-01-01T13:00:00Z`, `sslGrade`: `A+`},
+			map[string]interface{}{`hour`: `2020-01-01T12:00:00Z`, `sslGrade`: `A`},
+		},
+		`gradeChanges`: []interface{}{
+			map[string]interface{}{`from`: `A`, `to`: `A+`},
+			map[string]interface{}{`from`: `B`, `to`: `A`},
+		},
+	}}
+	if diff := cmp.Diff(expected, result.Data); diff != `` || len(result.Errors) > 0 {
+		t.Error(fmt.Sprintf("Unexpected result: %v %v", diff, result.Errors))
+	}
+
+	// The mutations are only allowed in POST requests.
+	resp := doRequest(t, http.MethodGet, ts.URL+`/api/graphql/?query=`+
+		`mutation%7Bevaluate(domain:%22prueba4.com%22)%7BinProgress%7D%7D`, ``, nil)
+	var rejected map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&rejected)
+	resp.Body.Close()
+	if rejected[`data`] != nil || rejected[`errors`] == nil {
+		t.Error(fmt.Sprintf("Unexpected result: %v", rejected))
+	}
+
+	result = postGraphQL(t, ts.URL, `mutation { evaluate(domain: "prueba4.com") { errors { code }
+		domain { name latestEvaluation { sslGrade servers { country } } } } }`)
+	expected = map[string]interface{}{`evaluate`: map[string]interface{}{
+		`errors`: []interface{}{},
+		`domain`: map[string]interface{}{`name`: `prueba4.com`, `latestEvaluation`: map[string]interface{}{
+			`sslGrade`: `A+`, `servers`: []interface{}{map[string]interface{}{`country`: `fake 128.30.20.10`}},
+		}},
+	}}
+	if diff := cmp.Diff(expected, result.Data); diff != `` || len(result.Errors) > 0 {
+		t.Error(fmt.Sprintf("Unexpected result: %v %v", diff, result.Errors))
+	}
+}
+
+// FUNCTION BLOCK
+// gRPC service
+func TestGRPC(t *testing.T) {
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	cfg.requireAPIKey = false
+	app, err := newApplication(cfg, dao.NewMemoryStore(), fakeScrapers(`A+`))
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	app.rpc.WatchInterval = time.Millisecond * 10
+	lis, err := net.Listen(`tcp`, `127.0.0.1:0`)
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	srv := app.rpc.GRPCServer()
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient(`passthrough:///`+lis.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := pb.NewEvaluationsClient(conn)
+	ctx := context.Background()
+
+	evaluation, err := client.EvaluateDomain(ctx, &pb.EvaluateDomainRequest{Domain: `PRUEBA1.com`})
+	if err != nil || evaluation.Domain != `prueba1.com` || evaluation.Evaluation.SslGrade != `A+` ||
+		len(evaluation.Evaluation.Servers) != 1 || len(evaluation.Errors) != 0 {
+		t.Error(fmt.Sprintf("Unexpected evaluation: %v %v", evaluation, err))
+	}
+	if _, err = client.EvaluateDomain(ctx, &pb.EvaluateDomainRequest{Domain: `1.2.3.4`}); status.Code(err) != codes.InvalidArgument {
+		t.Error(fmt.Sprintf("Expected: InvalidArgument, Actual: %v", err))
+	}
+
+	stored, err := client.GetEvaluation(ctx, &pb.GetEvaluationRequest{Domain: `prueba1.com`})
+	if err != nil || stored.Evaluation.GetSslGrade() != `A+` || len(stored.Evaluation.GetServers()) != 1 {
+		t.Error(fmt.Sprintf("Unexpected evaluation: %v %v", stored, err))
+	}
+	stored, err = client.GetEvaluation(ctx, &pb.GetEvaluationRequest{Domain: `prueba2.com`})
+	if err != nil || stored.Evaluation != nil {
+		t.Error(fmt.Sprintf("Unexpected evaluation: %v %v", stored, err))
+	}
+	recent, err := client.ListRecent(ctx, &pb.ListRecentRequest{})
+	if err != nil || len(recent.Evaluations) != 1 || len(recent.Evaluations[0].Servers) != 1 {
+		t.Error(fmt.Sprintf("Unexpected evaluations: %v %v", recent, err))
+	}
+
+	// The watch sends the evaluation once, it doesn't change afterwards.
+	watchCtx, cancel := context.WithTimeout(ctx, time.Millisecond*200)
+	defer cancel()
+	stream, err := client.WatchDomain(watchCtx, &pb.WatchDomainRequest{Domain: `prueba1.com`})
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	received := 0
+	for {
+		if _, err = stream.Recv(); err != nil {
+			break
+		}
+		received++
+	}
+	if received != 1 || status.Code(err) != codes.DeadlineExceeded {
+		t.Error(fmt.Sprintf("Expected: 1 message, Actual: %v %v", received, err))
+	}
+}
+
+// FUNCTION BLOCK
+// Quota and shutdown of the watch streams of the gRPC API
+func TestGRPCWatchStreams(t *testing.T) {
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	cfg.requireAPIKey = true
+	cfg.adminToken = `secreto`
+	// Every poll of the watch starts a new evaluation.
+	cfg.service.DomainEvaluationTW = time.Nanosecond
+	app, err := newApplication(cfg, dao.NewMemoryStore(), fakeScrapers(`A+`))
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	app.rpc.WatchInterval = time.Millisecond * 10
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	resp := doRequest(t, http.MethodPost, ts.URL+`/admin/apiKeys/`,
+		`{"name": "prueba", "rate_limit": 100, "daily_quota": 3}`, map[string]string{`Authorization`: `Bearer secreto`})
+	var created rest.CreateAPIKeyResponse
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+
+	lis, err := net.Listen(`tcp`, `127.0.0.1:0`)
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	srv := app.rpc.GRPCServer()
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient(`passthrough:///`+lis.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := pb.NewEvaluationsClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, rpc.APIKeyMetadata, created.APIKey)
+
+	// The watch ends once the new evaluations spend the quota.
+	stream, err := client.WatchDomain(ctx, &pb.WatchDomainRequest{Domain: `prueba1.com`})
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	for err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.ResourceExhausted || !strings.Contains(err.Error(), `904`) {
+		t.Error(fmt.Sprintf("Expected: ResourceExhausted, Actual: %v", err))
+	}
+
+	// The watches open end when the streams are closed.
+	app.service.Config.DomainEvaluationTW = time.Hour
+	other := metadata.AppendToOutgoingContext(context.Background(), rpc.APIKeyMetadata, created.APIKey)
+	other, cancel = context.WithTimeout(other, time.Second*5)
+	defer cancel()
+	stream, err = client.WatchDomain(other, &pb.WatchDomainRequest{Domain: `prueba1.com`})
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	if _, err = stream.Recv(); err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	app.rpc.CloseStreams()
+	if _, err = stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Error(fmt.Sprintf("Expected: Unavailable, Actual: %v", err))
+	}
+}
+
+// Function for reading the names of the events of a Server-Sent Events
+// stream, until the stream ends or the last event is named last.
+func readEvents(t *testing.T, body io.Reader, last string) (names []string, data []string) {
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, `event: `); ok {
+			names = append(names, name)
+		}
+		if d, ok := strings.CutPrefix(line, `data: `); ok {
+			data = append(data, d)
+			if names[len(names)-1] == last {
+				return
+			}
+		}
+	}
+	return
+}
+
+// FUNCTION BLOCK
+// Server-Sent Events of the evaluations
+func TestEvents(t *testing.T) {
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	cfg.requireAPIKey = false
+	cfg.service.DomainEvaluationTW = time.Millisecond * 10
+	// SSLabs is working on the domain in the first evaluation.
+	var calls int32
+	scrap := fakeScrapers(`A+`)
+	ready := scrap.Evaluator
+	scrap.Evaluator = func(ctx context.Context, t time.Time, s string) (dao.DomainEvaluation, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return dao.DomainEvaluation{Domain: s, EvaluationHour: t.Format(time.RFC3339), EvaluationInProgress: true}, nil
+		}
+		return ready(ctx, t, s)
+	}
+	ts := newTestServer(t, cfg, scrap)
+
+	all, err := http.Get(ts.URL + `/domainEvaluations/events`)
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	defer all.Body.Close()
+
+	resp, err := http.Get(ts.URL + `/domainEvaluations/PRUEBA1.com/events`)
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != rest.EventStreamContentType {
+		t.Error(fmt.Sprintf("Expected: %v, Actual: %v", rest.EventStreamContentType, resp.Header.Get("Content-Type")))
+	}
+	names, data := readEvents(t, resp.Body, controller.StageReady)
+	expected := []string{controller.StageInProgress, controller.StageEnrichment, controller.StageReady}
+	if diff := cmp.Diff(expected, names); diff != "" {
+		t.Error(fmt.Sprintf("Unexpected events: %v", diff))
+	}
+	var ev controller.EvaluationEvent
+	if err = json.Unmarshal([]byte(data[len(data)-1]), &ev); err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	if ev.Domain != `prueba1.com` || ev.Evaluation == nil || ev.Evaluation.SslGrade != `A+` {
+		t.Error(fmt.Sprintf("Unexpected event: %v", ev))
+	}
+
+	// The stream of every domain has the new evaluation too.
+	names, _ = readEvents(t, all.Body, controller.StageReady)
+	if diff := cmp.Diff(expected, names); diff != "" {
+		t.Error(fmt.Sprintf("Unexpected events: %v", diff))
+	}
+
+	resp, err = http.Get(ts.URL + `/domainEvaluations/bad%20domain/events`)
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Error(fmt.Sprintf("Expected: %v, Actual: %v", http.StatusBadRequest, resp.StatusCode))
+	}
+}
+
+// FUNCTION BLOCK
+// Stream tokens, closing and polls of the event streams
+func TestEventStreams(t *testing.T) {
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	cfg.requireAPIKey = true
+	cfg.adminToken = `secreto`
+	cfg.service.DomainEvaluationTW = time.Millisecond * 10
+	cfg.service.StreamMaxPolls = 3
+	// SSLabs never finishes prueba2.com.
+	scrap := fakeScrapers(`A+`)
+	ready := scrap.Evaluator
+	scrap.Evaluator = func(ctx context.Context, t time.Time, s string) (dao.DomainEvaluation, error) {
+		de, err := ready(ctx, t, s)
+		de.EvaluationInProgress = s == `prueba2.com`
+		return de, err
+	}
+	app, err := newApplication(cfg, dao.NewMemoryStore(), scrap)
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	resp := doRequest(t, http.MethodPost, ts.URL+`/admin/apiKeys/`, `{"name": "prueba"}`,
+		map[string]string{`Authorization`: `Bearer secreto`})
+	var created rest.CreateAPIKeyResponse
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	stream := map[string]string{`Accept`: rest.EventStreamContentType}
+
+	// The keys aren't accepted in the URLs, the stream tokens are.
+	resp = doRequest(t, http.MethodGet, ts.URL+`/domainEvaluations/prueba1.com/events?api_key=`+created.APIKey, ``, stream)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Error(fmt.Sprintf("Expected: 401, Actual: %v", resp.StatusCode))
+	}
+	resp = doRequest(t, http.MethodPost, ts.URL+`/api/v2/domainEvaluations/streamTokens`, ``,
+		map[string]string{rest.APIKeyHeader: created.APIKey})
+	var token controller.StreamToken
+	json.NewDecoder(resp.Body).Decode(&token)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || token.Token == `` {
+		t.Fatal(fmt.Sprintf("Unexpected stream token: %v %+v", resp.StatusCode, token))
+	}
+	// The token ends in URLs, so it has the id of the key instead of its hash.
+	if !strings.HasPrefix(token.Token, fmt.Sprintf("%d.", created.Key.Id)) ||
+		strings.Contains(token.Token, dao.HashAPIKey(created.APIKey)) {
+		t.Error(fmt.Sprintf("Unexpected stream token: %v", token.Token))
+	}
+	for _, c := range []struct {
+		token  string
+		status int
+	}{
+		{token.Token, http.StatusOK},
+		{token.Token + `0`, http.StatusUnauthorized},
+		{strings.Replace(token.Token, `.`, `.1`, 1), http.StatusUnauthorized},
+	} {
+		resp = doRequest(t, http.MethodGet, ts.URL+`/domainEvaluations/prueba1.com/events?stream_token=`+c.token, ``, stream)
+		resp.Body.Close()
+		if resp.StatusCode != c.status {
+			t.Error(fmt.Sprintf("%v | Expected: %v, Actual: %v", c.token, c.status, resp.StatusCode))
+		}
+	}
+	_, _, appErr := app.service.AuthorizeStreamToken(context.Background(), token.Token, false, token.ExpiresAt.Add(time.Second))
+	if appErr.Code != `902` {
+		t.Error(fmt.Sprintf("Expected a 902 error for an expired token, Actual: %v", appErr))
+	}
+
+	// A domain that is never ready ends the stream after StreamMaxPolls.
+	key := map[string]string{rest.APIKeyHeader: created.APIKey}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+`/domainEvaluations/prueba2.com/events`, nil)
+	req.Header.Set(rest.APIKeyHeader, created.APIKey)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	names, data := readEvents(t, resp.Body, controller.StageError)
+	resp.Body.Close()
+	var ev controller.EvaluationEvent
+	if len(data) > 0 {
+		json.Unmarshal([]byte(data[len(data)-1]), &ev)
+	}
+	if polls := strings.Count(strings.Join(names, ` `), controller.StageInProgress); polls != 3 ||
+		len(ev.Errors) != 1 || ev.Errors[0].Code != `603` {
+		t.Error(fmt.Sprintf("Unexpected events: %v %+v", names, ev))
+	}
+
+	// The streams open are closed on shutdown.
+	resp = doRequest(t, http.MethodGet, ts.URL+`/domainEvaluations/events`, ``, key)
+	defer resp.Body.Close()
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, resp.Body)
+		close(closed)
+	}()
+	app.api.CloseStreams()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Error("Expected the event stream to be closed")
+	}
+}
+
+// FUNCTION BLOCK
+// Batches of evaluations
+func TestBatches(t *testing.T) {
+	ts := newTestApplication(t, fakeScrapers(`A+`))
+	resp := doRequest(t, http.MethodPost, ts.URL+`/api/v2/domainEvaluations:batch`,
+		`["prueba1.com", "PRUEBA1.com", "bad domain", "prueba2.com"]`, map[string]string{"Content-Type": "application/json"})
+	var batch controller.BatchResult
+	err := json.NewDecoder(resp.Body).Decode(&batch)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	location := resp.Header.Get("Location")
+	if resp.StatusCode != http.StatusAccepted || location != `/api/v2/domainEvaluations:batch/`+batch.Id {
+		t.Fatal(fmt.Sprintf("Unexpected response: %v %v", resp.StatusCode, location))
+	}
+	// The duplicated domain is dropped, and the invalid one fails right away.
+	if batch.Total != 3 || batch.Failed != 1 || batch.Items[1].Status != controller.BatchFailed ||
+		len(batch.Items[1].APIErrors) != 1 || batch.Items[1].APIErrors[0].Code != `901` {
+		t.Error(fmt.Sprintf("Unexpected batch: %v", batch))
+	}
+
+	deadline := time.Now().Add(time.Second * 5)
+	for !batch.Done && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+		getJSON(t, ts.URL+location, &batch)
+	}
+	if !batch.Done || batch.Succeeded != 2 || batch.Items[0].Domain != `prueba1.com` ||
+		batch.Items[0].SslGrade != `A+` || batch.Items[2].Status != controller.BatchDone {
+		t.Error(fmt.Sprintf("Unexpected batch: %v", batch))
+	}
+
+	// The domains can be sent as CSV, with or without a header.
+	resp = doRequest(t, http.MethodPost, ts.URL+`/domainEvaluations:batch`, "domain\nprueba3.com\n",
+		map[string]string{"Content-Type": "text/csv"})
+	err = json.NewDecoder(resp.Body).Decode(&batch)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusAccepted || batch.Total != 1 || batch.Items[0].Domain != `prueba3.com` {
+		t.Error(fmt.Sprintf("Unexpected batch: %v %v %v", resp.StatusCode, batch, err))
+	}
+
+	for _, c := range []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{http.MethodPost, `/api/v2/domainEvaluations:batch`, `[]`, http.StatusBadRequest},
+		{http.MethodPost, `/api/v2/domainEvaluations:batch`, `{"domains": 1}`, http.StatusBadRequest},
+		{http.MethodGet, `/api/v2/domainEvaluations:batch/unknown`, ``, http.StatusNotFound},
+	} {
+		resp = doRequest(t, c.method, ts.URL+c.path, c.body, nil)
+		resp.Body.Close()
+		if resp.StatusCode != c.status || resp.Header.Get("Content-Type") != rest.ProblemContentType {
+			t.Error(fmt.Sprintf("%v %v | Expected: %v, Actual: %v", c.method, c.path, c.status, resp.StatusCode))
+		}
+	}
+}
+
+// Function for waiting until the batch with the given id is done, or a
+// second passes.
+func waitBatch(t *testing.T, s *controller.Service, id string) controller.BatchResult {
+	deadline := time.Now().Add(time.Second)
+	for {
+		batch, appErr := s.FindBatch(context.Background(), id)
+		if appErr.Code != controller.DefaultAPIError().Code {
+			t.Fatal(fmt.Sprintf("Exception: %v", appErr))
+		}
+		if batch.Done || time.Now().After(deadline) {
+			return batch
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+// FUNCTION BLOCK
+// Cancellation, deadline and resumption of the batches
+func TestBatchLifecycle(t *testing.T) {
+	inProgress := fakeScrapers(`A`)
+	evaluator := inProgress.Evaluator
+	inProgress.Evaluator = func(ctx context.Context, currentHour time.Time, domain string) (dao.DomainEvaluation, error) {
+		de, err := evaluator(ctx, currentHour, domain)
+		de.EvaluationInProgress = true
+		return de, err
+	}
+	store := dao.NewMemoryStore()
+	ctx := context.Background()
+
+	// A domain SSLabs never finishes fails at BatchItemTimeout.
+	cfg := controller.DefaultConfig()
+	cfg.DomainEvaluationTW = time.Millisecond * 20
+	cfg.BatchItemTimeout = time.Millisecond * 100
+	s := controller.NewService(store, inProgress, cfg)
+	batch, appErrs := s.CreateBatch(ctx, []string{`prueba1.com`}, time.Now())
+	if len(appErrs) != 0 {
+		t.Fatal(fmt.Sprintf("Exception: %v", appErrs))
+	}
+	batch = waitBatch(t, s, batch.Id)
+	if batch.Failed != 1 || len(batch.Items[0].APIErrors) != 1 || batch.Items[0].APIErrors[0].Code != `603` {
+		t.Error(fmt.Sprintf("Expected a 603 error, Actual: %+v", batch))
+	}
+
+	// Shutdown cancels the batches, leaving their domains pending.
+	cfg.DomainEvaluationTW = time.Hour
+	cfg.BatchItemTimeout = 0
+	s = controller.NewService(store, inProgress, cfg)
+	batch, _ = s.CreateBatch(ctx, []string{`prueba2.com`}, time.Now())
+	for batch.Items[0].Status != controller.BatchRunning {
+		time.Sleep(time.Millisecond * 10)
+		batch, _ = s.FindBatch(ctx, batch.Id)
+	}
+	shutdownCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	if batch, _ = s.FindBatch(ctx, batch.Id); batch.Items[0].Status != controller.BatchPending {
+		t.Error(fmt.Sprintf("Expected a pending domain after the shutdown, Actual: %+v", batch))
+	}
+
+	// The next run resumes them.
+	cfg.DomainEvaluationTW = time.Millisecond * 20
+	s = controller.NewService(store, fakeScrapers(`A`), cfg)
+	if err := s.ResumeBatches(ctx); err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	if batch = waitBatch(t, s, batch.Id); batch.Succeeded != 1 || batch.Items[0].SslGrade != `A` {
+		t.Error(fmt.Sprintf("Expected a resumed batch, Actual: %+v", batch))
+	}
+}
+
+// FUNCTION BLOCK
+// Exports of the evaluations
+func TestExport(t *testing.T) {
+	ts := newTestApplication(t, fakeScrapers(`A+`))
+	for _, domain := range []string{`prueba1.com`, `prueba2.com`} {
+		resp := doRequest(t, http.MethodGet, ts.URL+`/domainEvaluations/`+domain, ``, nil)
+		resp.Body.Close()
+	}
+
+	resp := doRequest(t, http.MethodGet, ts.URL+`/api/v2/domainEvaluations/export?domain=PRUEBA1.com`, ``, nil)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	expected := strings.Join(export.Columns, ",") + "\n1,prueba1.com,"
+	if resp.Header.Get("Content-Type") != export.ContentType(export.FormatCSV) ||
+		!strings.HasPrefix(string(body), expected) || strings.Count(string(body), "\n") != 2 ||
+		!strings.Contains(string(body), `128.30.20.10,A+,fake 128.30.20.10,fake 128.30.20.10`) {
+		t.Error(fmt.Sprintf("Unexpected export: %v %q", resp.Header.Get("Content-Type"), body))
+	}
+
+	resp = doRequest(t, http.MethodGet, ts.URL+`/domainEvaluations/export?format=ndjson&grade=A%2B`, ``, nil)
+	decoder := json.NewDecoder(resp.Body)
+	domains := make([]string, 0)
+	for decoder.More() {
+		var ev export.Evaluation
+		if err := decoder.Decode(&ev); err != nil {
+			t.Fatal(fmt.Sprintf("Exception: %v", err))
+		}
+		if ev.Id == 0 || len(ev.Servers) != 1 {
+			t.Error(fmt.Sprintf("Unexpected evaluation: %v", ev))
+		}
+		domains = append(domains, ev.Domain)
+	}
+	resp.Body.Close()
+	if diff := cmp.Diff([]string{`prueba1.com`, `prueba2.com`}, domains); diff != "" {
+		t.Error(fmt.Sprintf("Unexpected export: %v", diff))
+	}
+
+	resp = doRequest(t, http.MethodGet, ts.URL+`/domainEvaluations/export?format=xlsx`, ``, nil)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	workbook, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	var sheet []byte
+	for _, f := range workbook.File {
+		if f.Name == `xl/worksheets/sheet1.xml` {
+			rc, _ := f.Open()
+			sheet, _ = io.ReadAll(rc)
+			rc.Close()
+		}
+	}
+	if strings.Count(string(sheet), `<row `) != 3 || !strings.Contains(string(sheet), `<t>prueba2.com</t>`) {
+		t.Error(fmt.Sprintf("Unexpected sheet: %s", sheet))
+	}
+
+	// The list endpoints have the same filters.
+	var list rest.PastEvaluationsResponseV2
+	getJSON(t, ts.URL+`/api/v2/domainEvaluations/?domain=prueba2.com`, &list)
+	if len(list.Evaluations) != 1 || list.Evaluations[0].Domain != `prueba2.com` {
+		t.Error(fmt.Sprintf("Unexpected evaluations: %v", list.Evaluations))
+	}
+	for _, path := range []string{`/domainEvaluations/export?format=pdf`, `/domainEvaluations/export?since=yesterday`,
+		`/api/v1/domainEvaluations/?in_progress=maybe`} {
+		resp = doRequest(t, http.MethodGet, ts.URL+path, ``, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Error(fmt.Sprintf("%v | Expected: %v, Actual: %v", path, http.StatusBadRequest, resp.StatusCode))
+		}
+	}
+
+	// The export command writes the same files.
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	store := dao.NewMemoryStore()
+	service := controller.NewService(store, fakeScrapers(`B`), cfg.service)
+	service.ScraperTestComplete(context.Background(), `prueba1.com`, time.Now())
+	var out bytes.Buffer
+	env := testCLIEnv(service, &out)
+	if err = exportCommand(context.Background(), env, []string{`-format`, `ndjson`, `-grade`, `B`}); err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	if strings.Count(out.String(), "\n") != 1 || !strings.Contains(out.String(), `"domain":"prueba1.com"`) {
+		t.Error(fmt.Sprintf("Unexpected export: %v", out.String()))
+	}
+	if err = exportCommand(context.Background(), env, []string{`-format`, `pdf`}); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+// Function for getting an environment of the commands over service, writing
+// in out, and without a database for migrating.
+func testCLIEnv(service *controller.Service, out io.Writer) *cliEnv {
+	return &cliEnv{
+		stdout: out,
+		service: func() (*controller.Service, error) {
+			return service, nil
+		},
+		migrate: func(ctx context.Context) error {
+			return errors.New("no database")
+		},
+	}
+}
+
+// FUNCTION BLOCK
+// Command-line interface
+func TestCLI(t *testing.T) {
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	service := controller.NewService(dao.NewMemoryStore(), fakeScrapers(`A-`), cfg.service)
+	var out bytes.Buffer
+	env := testCLIEnv(service, &out)
+	ctx := context.Background()
+
+	// A- is below A, but not below B.
+	cases := []struct {
+		args []string
+		code int
+	}{
+		{[]string{`evaluate`, `-min-grade`, `B`, `prueba1.com`}, 0},
+		{[]string{`evaluate`, `-min-grade`, `A`, `prueba1.com`}, exitBelowThreshold},
+		{[]string{`recent`, `-min-grade`, `A+`}, exitBelowThreshold},
+		{[]string{`evaluate`, `-min-grade`, `Z`, `prueba1.com`}, exitUsage},
+		{[]string{`evaluate`}, exitUsage},
+		{[]string{`history`, `-last`, `x`, `prueba1.com`}, exitUsage},
+		{[]string{`unknown`}, exitUsage},
+		{[]string{`watch`, `remove`, `prueba1.com`}, exitError},
+		{[]string{`migrate`}, exitError},
+	}
+	for _, c := range cases {
+		if code := exitCode(execute(ctx, env, c.args), io.Discard); code != c.code {
+			t.Error(fmt.Sprintf("Unexpected exit code of %v: %v, expected %v", c.args, code, c.code))
+		}
+	}
+
+	out.Reset()
+	if err = execute(ctx, env, []string{`history`, `-json`, `prueba1.com`}); err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	var history []dao.DomainEvaluation
+	if err = json.Unmarshal(out.Bytes(), &history); err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	if len(history) != 1 || history[0].SslGrade != `A-` {
+		t.Error(fmt.Sprintf("Unexpected history: %v", out.String()))
+	}
+
+	for _, args := range [][]string{{`watch`, `add`, `Prueba2.com`, `prueba3.com`}, {`watch`, `remove`, `prueba3.com`}} {
+		if err = execute(ctx, env, args); err != nil {
+			t.Fatal(fmt.Sprintf("Exception: %v", err))
+		}
+	}
+	out.Reset()
+	if err = execute(ctx, env, []string{`watch`, `list`}); err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], `prueba2.com `) {
+		t.Error(fmt.Sprintf("Unexpected watched domains: %v", out.String()))
+	}
+}
+
+// FUNCTION BLOCK
+// Shutdown of the evaluation of the watched domains
+func TestWatchedDomainsShutdown(t *testing.T) {
+	var cancelled int32
+	blocking := fakeScrapers(`A`)
+	blocking.Evaluator = func(ctx context.Context, currentHour time.Time, domain string) (dao.DomainEvaluation, error) {
+		<-ctx.Done()
+		atomic.AddInt32(&cancelled, 1)
+		return dao.DomainEvaluation{}, ctx.Err()
+	}
+	s := controller.NewService(dao.NewMemoryStore(), blocking, controller.DefaultConfig())
+	ctx := context.Background()
+	if appErr := s.WatchDomain(ctx, `prueba1.com`, time.Now()); appErr.Code != controller.DefaultAPIError().Code {
+		t.Fatal(fmt.Sprintf("Exception: %v", appErr))
+	}
+	stopped := make(chan struct{})
+	go func() {
+		s.EvaluateWatchedDomains(ctx, time.Millisecond*10)
+		close(stopped)
+	}()
+	time.Sleep(time.Millisecond * 50)
+
+	// Shutdown stops the evaluations of the watched domains, and waits for them.
+	shutdownCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Millisecond * 100):
+		t.Error("Expected the evaluation of the watched domains to be stopped")
+	}
+	if n := atomic.LoadInt32(&cancelled); n != 1 {
+		t.Error(fmt.Sprintf("Expected a cancelled evaluation, Actual: %v", n))
+	}
+}
+
+// FUNCTION BLOCK
+// Timeout of the evaluate command
+func TestCLIEvaluateTimeout(t *testing.T) {
+	slow := fakeScrapers(`A`)
+	evaluator := slow.Evaluator
+	slow.Evaluator = func(ctx context.Context, currentHour time.Time, domain string) (dao.DomainEvaluation, error) {
+		select {
+		case <-ctx.Done():
+			return dao.DomainEvaluation{}, ctx.Err()
+		case <-time.After(time.Millisecond * 150):
+		}
+		return evaluator(ctx, currentHour, domain)
+	}
+	service := controller.NewService(dao.NewMemoryStore(), slow, controller.DefaultConfig())
+	env := testCLIEnv(service, io.Discard)
+
+	// The timeout applies to each domain, not to all of them together.
+	args := []string{`evaluate`, `-timeout`, `250ms`, `prueba1.com`, `prueba2.com`}
+	if err := execute(context.Background(), env, args); err != nil {
+		t.Error(fmt.Sprintf("Exception: %v", err))
+	}
+}
+
+// FUNCTION BLOCK
+// Diff of two evaluations of a domain
+func TestDiff(t *testing.T) {
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	cfg.requireAPIKey = false
+	store := dao.NewMemoryStore()
+	evaluations := []dao.DomainEvaluation{
+		{Domain: `prueba1.com`, EvaluationHour: `2016-01-01T10:00:00Z`, SslGrade: `A`, Title: `Prueba`,
+			Servers: []dao.Server{{Address: `10.0.0.1`, SslGrade: `A`, Owner: `Owner 1`}, {Address: `10.0.0.2`, SslGrade: `A`}}},
+		// The same servers in another order.
+		{Domain: `prueba1.com`, EvaluationHour: `2016-01-01T11:30:00Z`, SslGrade: `A`, Title: `Prueba`,
+			Servers: []dao.Server{{Address: `10.0.0.2`, SslGrade: `A`}, {Address: `10.0.0.1`, SslGrade: `A`, Owner: `Owner 1`}}},
+		{Domain: `prueba1.com`, EvaluationHour: `2016-01-01T12:00:00Z`, SslGrade: `B`, Title: `Prueba 2`,
+			Servers: []dao.Server{{Address: `10.0.0.3`, SslGrade: `B`}, {Address: `10.0.0.1`, SslGrade: `B`, Owner: `Owner 2`}}},
+		{Domain: `prueba2.com`, EvaluationHour: `2016-01-01T12:00:00Z`, SslGrade: `A`},
+	}
+	for i := range evaluations {
+		if err = store.CreateEvaluation(context.Background(), &evaluations[i]); err != nil {
+			t.Fatal(fmt.Sprintf("Exception: %v", err))
+		}
+	}
+	changed, err := evaluations[1].HaveServersChanged(context.Background(), store)
+	if err != nil || changed != dao.SLStatus.Unchanged {
+		t.Error(fmt.Sprintf("Expected: %v, Actual: %v %v", dao.SLStatus.Unchanged, changed, err))
+	}
+
+	app, err := newApplication(cfg, store, fakeScrapers(`A`))
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+
+	// Without ids, the last two evaluations are compared.
+	var diff dao.EvaluationDiff
+	getJSON(t, ts.URL+`/api/v2/domainEvaluations/prueba1.com/diff`, &diff)
+	expected := dao.EvaluationDiff{
+		Domain:   `prueba1.com`,
+		From:     dao.EvaluationRef{Id: 2, Hour: `2016-01-01T11:30:00Z`},
+		To:       dao.EvaluationRef{Id: 3, Hour: `2016-01-01T12:00:00Z`},
+		SslGrade: &dao.Change{From: `A`, To: `B`},
+		Title:    &dao.Change{From: `Prueba`, To: `Prueba 2`},
+		Servers: dao.ServersDiff{
+			Added:   []dao.Server{{Address: `10.0.0.3`, SslGrade: `B`}},
+			Removed: []dao.Server{{Address: `10.0.0.2`, SslGrade: `A`}},
+			Modified: []dao.ServerChange{{Address: `10.0.0.1`, SslGrade: &dao.Change{From: `A`, To: `B`},
+				Owner: &dao.Change{From: `Owner 1`, To: `Owner 2`}}},
+		},
+	}
+	if !cmp.Equal(diff, expected) {
+		t.Error(fmt.Sprintf("Expected: %+v, Actual: %+v", expected, diff))
+	}
+
+	diff = dao.EvaluationDiff{}
+	getJSON(t, ts.URL+`/domainEvaluations/prueba1.com/diff?from=1&to=2`, &diff)
+	if diff.SslGrade != nil || diff.Title != nil || diff.Servers.Changed() {
+		t.Error(fmt.Sprintf("Unexpected diff of reordered servers: %+v", diff))
+	}
+
+	for url, status := range map[string]int{
+		`/domainEvaluations/prueba1.com/diff?from=99`: http.StatusNotFound,
+		`/domainEvaluations/prueba1.com/diff?to=4`:    http.StatusNotFound,
+		`/domainEvaluations/prueba1.com/diff?from=x`:  http.StatusBadRequest,
+		`/domainEvaluations/prueba2.com/diff`:         http.StatusNotFound,
+	} {
+		resp := doRequest(t, http.MethodGet, ts.URL+url, ``, nil)
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Error(fmt.Sprintf("%v Expected: %v, Actual: %v", url, status, resp.StatusCode))
+		}
+	}
+}
+
+// FUNCTION BLOCK
+// Comparison baselines of the evaluations
+func TestBaselines(t *testing.T) {
+	t.Setenv(`BASELINE`, `tomorrow`)
+	if _, err := loadConfig(); err == nil {
+		t.Error("Expected an error for an unknown baseline")
+	}
+	t.Setenv(`BASELINE`, ``)
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	cfg.requireAPIKey = false
+	store := dao.NewMemoryStore()
+	now := time.Now().UTC()
+	server := dao.Server{Address: `128.30.20.10`, SslGrade: `A`, Country: `fake 128.30.20.10`, Owner: `fake 128.30.20.10`}
+	evaluations := []dao.DomainEvaluation{
+		{Domain: `prueba1.com`, EvaluationHour: now.AddDate(0, 0, -1).Add(-time.Minute * 10).Format(time.RFC3339),
+			SslGrade: `D`, Servers: []dao.Server{server}},
+		{Domain: `prueba1.com`, EvaluationHour: now.Add(-time.Hour * 3).Format(time.RFC3339), SslGrade: `C`,
+			Servers: []dao.Server{server}},
+		{Domain: `prueba1.com`, EvaluationHour: now.Add(-time.Minute * 30).Format(time.RFC3339), SslGrade: `B`,
+			Servers: []dao.Server{{Address: `10.0.0.9`, SslGrade: `B`}}},
+		// The evaluations of the domain while it was down can't be pinned.
+		{Domain: `prueba1.com`, EvaluationHour: now.AddDate(0, 0, -2).Format(time.RFC3339), IsDown: true},
+	}
+	for i := range evaluations {
+		if err = store.CreateEvaluation(context.Background(), &evaluations[i]); err != nil {
+			t.Fatal(fmt.Sprintf("Exception: %v", err))
+		}
+	}
+	app, err := newApplication(cfg, store, fakeScrapers(`A`))
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+
+	// The first request evaluates the domain, the rest compare the same evaluation.
+	cases := []struct {
+		baseline string
+		id       int
+		grade    string
+		changed  bool
+	}{
+		{``, 2, `C`, false},
+		{`previous`, 3, `B`, true},
+		{`2h`, 2, `C`, false},
+		{`yesterday`, 1, `D`, false},
+		{`evaluation:3`, 3, `B`, true},
+		{`evaluation:99`, 0, dao.NoEvaluation, false},
+		{`evaluation:4`, 0, dao.NoEvaluation, false},
+	}
+	for _, c := range cases {
+		var response rest.EvaluationResponseV2
+		getJSON(t, ts.URL+`/api/v2/domainEvaluations/prueba1.com?baseline=`+c.baseline, &response)
+		ev := response.Evaluation
+		if ev.PreviousSslGrade != c.grade || ev.ServersChanged != c.changed || (c.id == 0) != (ev.Baseline == nil) ||
+			(ev.Baseline != nil && (ev.Baseline.Id != c.id || ev.Baseline.Hour != evaluations[c.id-1].EvaluationHour)) {
+			t.Error(fmt.Sprintf("%v: Unexpected comparison: %v %v %+v", c.baseline, ev.PreviousSslGrade,
+				ev.ServersChanged, ev.Baseline))
+		}
+	}
+
+	resp := doRequest(t, http.MethodGet, ts.URL+`/domainEvaluations/prueba1.com?baseline=0h`, ``, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Error(fmt.Sprintf("Expected: %v, Actual: %v", http.StatusBadRequest, resp.StatusCode))
+	}
+}
+
+// FUNCTION BLOCK
+// Approved baselines and drift of the evaluations
+func TestApprovedBaselines(t *testing.T) {
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	cfg.requireAPIKey = false
+	cfg.adminToken = `secreto`
+	admin := map[string]string{`Authorization`: `Bearer secreto`}
+	store := dao.NewMemoryStore()
+	app, err := newApplication(cfg, store, fakeScrapers(`A`))
+	if err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+	url := ts.URL + `/api/v2/domainEvaluations/prueba1.com`
+
+	var response rest.EvaluationResponseV2
+	getJSON(t, url, &response)
+	if response.Evaluation.Drift != nil {
+		t.Error(fmt.Sprintf("Unexpected drift without approved baseline: %+v", response.Evaluation.Drift))
+	}
+
+	// Approving a baseline needs the admin token.
+	resp := doRequest(t, http.MethodPut, url+`/approvedBaseline`, `{"min_grade": "A-"}`, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Error(fmt.Sprintf("Expected: %v, Actual: %v", http.StatusUnauthorized, resp.StatusCode))
+	}
+	resp = doRequest(t, http.MethodPut, url+`/approvedBaseline`, `{"min_grade": "A-"}`, admin)
+	var ab dao.ApprovedBaseline
+	json.NewDecoder(resp.Body).Decode(&ab)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || ab.EvaluationId != 1 || ab.MinGrade != `A-` || len(ab.Servers) != 1 {
+		t.Error(fmt.Sprintf("Unexpected approved baseline: %v %+v", resp.StatusCode, ab))
+	}
+	getJSON(t, url, &response)
+	if drift := response.Evaluation.Drift; drift == nil || drift.Drifted || drift.EvaluationId != 1 {
+		t.Error(fmt.Sprintf("Unexpected drift: %+v", drift))
+	}
+
+	// The approved configuration expects another server, another country and a better grade.
+	ab.MinGrade = `A+`
+	ab.Servers = []dao.Server{{Address: `128.30.20.10`, Country: `CO`, Owner: `fake 128.30.20.10`},
+		{Address: `10.0.0.1`}}
+	if err = store.SetApprovedBaseline(context.Background(), ab); err != nil {
+		t.Fatal(fmt.Sprintf("Exception: %v", err))
+	}
+	getJSON(t, url, &response)
+	expected := &dao.Drift{Drifted: true, EvaluationId: 1, MinGrade: `A+`, GradeBelowMinimum: true,
+		UnexpectedAddresses: []string{}, MissingAddresses: []string{`10.0.0.1`},
+		Servers: []dao.ServerChange{{Address: `128.30.20.10`,
+			Country: &dao.Change{From: `CO`, To: `fake 128.30.20.10`}}}}
+	if !cmp.Equal(response.Evaluation.Drift, expected) {
+		t.Error(fmt.Sprintf("Expected: %+v, Actual: %+v", expected, response.Evaluation.Drift))
+	}
+	drift := controller.DriftFrom(ab, `A+`, append(ab.Servers, dao.Server{Address: `10.0.0.2`}))
+	if !drift.Drifted || drift.GradeBelowMinimum || !cmp.Equal(drift.UnexpectedAddresses, []string{`10.0.0.2`}) {
+		t.Error(fmt.Sprintf("Unexpected drift: %+v", drift))
+	}
+
+	for _, c := range []struct {
+		method string
+		body   string
+		status int
+	}{
+		{http.MethodDelete, ``, http.StatusUnauthorized},
+		{http.MethodPut, `{"min_grade": "Z"}`, http.StatusBadRequest},
+		{http.MethodPut, `{"evaluation_id": 99}`, http.StatusNotFound},
+		{http.MethodPut, `[`, http.StatusBadRequest},
+		{http.MethodGet, ``, http.StatusOK},
+		{http.MethodDelete, ``, http.StatusNoContent},
+		{http.MethodDelete, ``, http.StatusNotFound},
+		{http.MethodGet, ``, http.StatusNotFound},
+	} {
+		headers := admin
+		if c.status == http.StatusUnauthorized {
+			headers = nil
+		}
+		resp := doRequest(t, c.method, url+`/approvedBaseline`, c.body, headers)
+		resp.Body.Close()
+		if resp.StatusCode != c.status {
+			t.Error(fmt.Sprintf("%v %v Expected: %v, Actual: %v", c.method, c.body, c.status, resp.StatusCode))
+		}
+	}
+	response.Evaluation.Drift = nil
+	getJSON(t, url, &response)
+	if response.Evaluation.Drift != nil {
+		t.Error(fmt.Sprintf("Unexpected drift after clearing the approved baseline: %+v", response.Evaluation.Drift))
+	}
+}
+
+// FUNCTION BLOCK
+// Drift of the grades without trust (T) or with a name mismatch (M)
+func TestGradeDrift(t *testing.T) {
+	for _, c := range []struct {
+		grade    string
+		minGrade string
+		below    bool
+	}{
+		{`T`, `B`, true},
+		{`M`, `F`, true},
+		{`M`, `T`, true},
+		{`T`, `T`, false},
+		{`T`, `M`, false},
+		{`A`, `T`, false},
+		{`NaN`, `M`, true},
+	} {
+		drift := controller.DriftFrom(dao.ApprovedBaseline{MinGrade: c.minGrade}, c.grade, nil)
+		if drift.GradeBelowMinimum != c.below || drift.Drifted != c.below {
+			t.Error(fmt.Sprintf("%v, minimum %v | Expected: %v, Actual: %+v", c.grade, c.minGrade, c.below, drift))
+		}
+	}
+}
+
+// FUNCTION BLOCK
+// Renewal of the evaluation lock of a domain
+func TestEvaluationLockRenewal(t *testing.T) {
+	cfg := controller.DefaultConfig()
+	cfg.EvaluationLockTTL = time.Millisecond * 150
+	cfg.EvaluationLockPoll = time.Millisecond * 20
+	store := dao.NewMemoryStore()
+	var evaluations int32
+	slow := fakeScrapers(`A`)
+	evaluator := slow.Evaluator
+	slow.Evaluator = func(ctx context.Context, currentHour time.Time, domain string) (dao.DomainEvaluation, error) {
+		atomic.AddInt32(&evaluations, 1)
+		time.Sleep(time.Millisecond * 500)
+		return evaluator(ctx, currentHour, domain)
+	}
+	// Two replicas sharing the store: the second waits for the lock of the
+	// first, which outlasts its TTL, and then reads its evaluation.
+	replicas := []*controller.Service{controller.NewService(store, slow, cfg), controller.NewService(store, slow, cfg)}
+	var wg sync.WaitGroup
+	for i, replica := range replicas {
+		wg.Add(1)
+		go func(replica *controller.Service) {
+			defer wg.Done()
+			if _, appErrs := replica.ScraperTestComplete(context.Background(), `prueba1.com`, time.Now()); len(appErrs) > 0 {
+				t.Error(fmt.Sprintf("Unexpected errors: %v", appErrs))
+			}
+		}(replica)
+		if i == 0 {
+			time.Sleep(time.Millisecond * 50)
+		}
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&evaluations); n != 1 {
+		t.Error(fmt.Sprintf("Expected a single evaluation, Actual: %v", n))
+	}
+}
+
+// FUNCTION BLOCK
+// Cancelled evaluations shared between callers
+func TestCancelledFlight(t *testing.T) {
+	release := make(chan struct{})
+	var calls int32
+	scrapers := fakeScrapers(`A`)
+	evaluator := scrapers.Evaluator
+	scrapers.Evaluator = func(ctx context.Context, currentHour time.Time, domain string) (dao.DomainEvaluation, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// The first evaluation outlives its only caller.
+			<-ctx.Done()
+			<-release
+			return dao.DomainEvaluation{}, ctx.Err()
+		}
+		return evaluator(ctx, currentHour, domain)
+	}
+	cfg := controller.DefaultConfig()
+	cfg.EvaluationLockPoll = time.Millisecond * 20
+	service := controller.NewService(dao.NewMemoryStore(), scrapers, cfg)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	service.ScraperTestComplete(ctx, `prueba1.com`, time.Now())
+
+	// A caller arriving before the cancelled evaluation ends starts a new one.
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		close(release)
+	}()
+	dec, appErrs := service.ScraperTestComplete(context.Background(), `prueba1.com`, time.Now())
+	if len(appErrs) > 0 || dec.SslGrade != `A` {
+		t.Error(fmt.Sprintf("Unexpected evaluation: %v %v", dec, appErrs))
+	}
+}
+
+// FUNCTION BLOCK
+// Concurrent evaluations of a domain in a Service
+func TestCoalescedEvaluations(t *testing.T) {
+	release := make(chan struct{})
+	var calls int32
+	scrap := fakeScrapers(`A`)
+	evaluator := scrap.Evaluator
+	scrap.Evaluator = func(ctx context.Context, currentHour time.Time, domain string) (dao.DomainEvaluation, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return evaluator(ctx, currentHour, domain)
+	}
+	service := controller.NewService(dao.NewMemoryStore(), scrap, controller.DefaultConfig())
+	const callers = 10
+	results := make([]dao.DomainEvaluationComplete, callers)
+	errs := make([][]controller.APIError, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = service.ScraperTestComplete(context.Background(), `prueba1.com`, time.Now())
+		}(i)
+	}
+	// Every caller joins the evaluation before it ends.
+	time.Sleep(time.Millisecond * 100)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Error(fmt.Sprintf("Expected: 1 evaluator call, Actual: %v", n))
+	}
+	for i := range results {
+		if len(errs[i]) > 0 || results[i].SslGrade != `A` {
+			t.Error(fmt.Sprintf("Unexpected evaluation: %v %v", results[i], errs[i]))
+		}
+		if diff := cmp.Diff(results[0], results[i]); diff != "" {
+			t.Error(fmt.Sprintf("Unexpected evaluation %v: %v", i, diff))
+		}
+	}
+}
@@ -1,54 +1,84 @@
 // Package for the declaration of the api controller.
-// The package contains the functions and the global variables
+// The package contains the Service and the functions
 // neccesary for handling the behaviour of the server during a http request.
 package controller
 
 import (
+  "errors"
+  "net/http"
   "time"
-  "github.com/trotsdeveloper/truora_test/truora_test_golang/scrapers"
   "github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
-  "github.com/cockroachdb/cockroach-go/crdb"
-  "database/sql"
   "context"
+  "log/slog"
+  "github.com/trotsdeveloper/truora_test/truora_test_golang/logging"
+  "github.com/trotsdeveloper/truora_test/truora_test_golang/ratelimit"
+  "github.com/trotsdeveloper/truora_test/truora_test_golang/scrapers"
+  "github.com/trotsdeveloper/truora_test/truora_test_golang/tracing"
+  "github.com/trotsdeveloper/truora_test/truora_test_golang/validation"
 )
 
-// Var representing the time to wait between different domain evaluations.
-var DomainEvaluationTW time.Duration = time.Second * 20
-
-// Var representing the time to wait for getting the list of recent evaluations.
-var RecentEvaluationsTW time.Duration = time.Second * 20
-// Var representing the last hour in which the list of recent evaluations was requested.
-var RecentEvaluationsLQ time.Time
-
-// Var for storing the recent evaluations each time the list of recent evaluations
-// is requested. The var is useful for returning the last consult when the difference
-// between the current hour and the RecentEvaluationsLQ is > RecentEvaluationsTW.
-var RecentEvaluations = make([]dao.DomainEvaluation, 0)
-
 // Var simulating a "enum" in other languages. The var handle the different APIErrors
 var APIErrors = newAPIErrorsRegistry()
 func newAPIErrorsRegistry() *apiErrorsRegistry {
-	E601v := makeAPIError("601", "Error in database.")
-	E602v := makeAPIError("602", "Error in SSLabs API.")
-	E701v := makeAPIError("701", "Error getting Icon")
-	E702v := makeAPIError("702", "Error getting HTML Title")
-	E801v := makeAPIError("801", "Error getting country from WHOIS")
-	E802v := makeAPIError("802", "Error getting owner from WHOIS")
+	E601v := makeAPIError("601", "Error in database.", http.StatusServiceUnavailable)
+	E602v := makeAPIError("602", "Error in SSLabs API.", http.StatusBadGateway)
+	E603v := makeAPIError("603", "Evaluation cancelled or timed out.", http.StatusGatewayTimeout)
+	// The scraping errors don't fail the evaluation, so they keep the 200 status.
+	E701v := makeAPIError("701", "Error getting Icon", http.StatusOK)
+	E702v := makeAPIError("702", "Error getting HTML Title", http.StatusOK)
+	E703v := makeAPIError("703", "Homepage fetch blocked", http.StatusOK)
+	E801v := makeAPIError("801", "Error getting country from WHOIS", http.StatusOK)
+	E802v := makeAPIError("802", "Error getting owner from WHOIS", http.StatusOK)
+	E901v := makeAPIError("901", "Invalid domain name.", http.StatusBadRequest)
+	E902v := makeAPIError("902", "Missing or invalid API key.", http.StatusUnauthorized)
+	E903v := makeAPIError("903", "API key rate limit exceeded.", http.StatusTooManyRequests)
+	E904v := makeAPIError("904", "API key daily quota exceeded.", http.StatusTooManyRequests)
+	E905v := makeAPIError("905", "Invalid request.", http.StatusBadRequest)
+	E906v := makeAPIError("906", "API key not found.", http.StatusNotFound)
+	E907v := makeAPIError("907", "Missing or invalid admin token.", http.StatusUnauthorized)
+	E908v := makeAPIError("908", "Rate limit exceeded.", http.StatusTooManyRequests)
+	E909v := makeAPIError("909", "Too many new evaluations.", http.StatusTooManyRequests)
+	E910v := makeAPIError("910", "Batch not found.", http.StatusNotFound)
+	E911v := makeAPIError("911", "Domain not watched.", http.StatusNotFound)
+	E912v := makeAPIError("912", "Evaluation not found.", http.StatusNotFound)
+	E913v := makeAPIError("913", "Approved baseline not found.", http.StatusNotFound)
 
 	return &apiErrorsRegistry{
 		E601: E601v,
 		E602: E602v,
+		E603: E603v,
 		E701: E701v,
 		E702: E702v,
+		E703: E703v,
 		E801: E801v,
 		E802: E802v,
+		E901: E901v,
+		E902: E902v,
+		E903: E903v,
+		E904: E904v,
+		E905: E905v,
+		E906: E906v,
+		E907: E907v,
+		E908: E908v,
+		E909: E909v,
+		E910: E910v,
+		E911: E911v,
+		E912: E912v,
+		E913: E913v,
 	}
 }
 
 // Auxiliar function for the APIErrors var.
-func makeAPIError(code string, description string) func(error) (APIError) {
+// status is the http status code of the responses failing with the error.
+// When err comes from a rate limiter, the error keeps the time to wait.
+func makeAPIError(code string, description string, status int) func(error) (APIError) {
 	return func(err error) (APIError) {
-		return APIError{code, description, err.Error()}
+		appErr := APIError{Code: code, Description: description, Err: err.Error(), Status: status}
+		var limitErr *ratelimit.LimitError
+		if errors.As(err, &limitErr) {
+			appErr.RetryAfter = limitErr.RetryAfter
+		}
+		return appErr
 	}
 }
 
@@ -56,10 +86,25 @@ func makeAPIError(code string, description string) func(error) (APIError) {
 type apiErrorsRegistry struct {
 	E601 func(error) (APIError) //
 	E602 func(error) (APIError) //
+	E603 func(error) (APIError) //
 	E701 func(error) (APIError) //
 	E702 func(error) (APIError) //
+	E703 func(error) (APIError) //
 	E801 func(error) (APIError) //
 	E802 func(error) (APIError) //
+	E901 func(error) (APIError) //
+	E902 func(error) (APIError) //
+	E903 func(error) (APIError) //
+	E904 func(error) (APIError) //
+	E905 func(error) (APIError) //
+	E906 func(error) (APIError) //
+	E907 func(error) (APIError) //
+	E908 func(error) (APIError) //
+	E909 func(error) (APIError) //
+	E910 func(error) (APIError) //
+	E911 func(error) (APIError) //
+	E912 func(error) (APIError) //
+	E913 func(error) (APIError) //
 }
 
 // APIError - Struct for handling different API Errors.
@@ -69,6 +114,8 @@ type APIError struct {
 	Code string `json:"code"`
 	Description string `json:"description"`
 	Err string `json:"error_message"`
+	Status int `json:"-"` // http status code of the error
+	RetryAfter time.Duration `json:"-"` // time to wait before retrying, for the rate limit errors
 }
 
 // Default constructor for the APIError struct.
@@ -76,6 +123,22 @@ func DefaultAPIError() APIError {
   return APIError{Code: "600"}
 }
 
+// Function for getting the http status code of a response given its APIErrors.
+// The most severe error decides the status. Without errors, the status is 202
+// while the evaluation is still in progress in SSLabs, and 200 otherwise.
+func HTTPStatus(appErrs []APIError, inProgress bool) int {
+  status := http.StatusOK
+  for _, appErr := range appErrs {
+    if appErr.Status > status {
+      status = appErr.Status
+    }
+  }
+  if status == http.StatusOK && inProgress {
+    status = http.StatusAccepted
+  }
+  return status
+}
+
 // Method for detecting if the given APIError is in the given array of APIError.
 // The method only compares the code.
 func (x *APIError) IsInArray(a []APIError) bool {
@@ -87,15 +150,15 @@ func (x *APIError) IsInArray(a []APIError) bool {
   return false
 }
 
-// One of the main functions for the api controller.
-// The current function receives:
+// One of the main methods for the api controller.
+// The current method receives:
+// -ctx, context of the request, every query and evaluator call is bound to it
 // -waitTime, indicating the time to wait
 //- domainName, name of the domain to evaluate
 //- currentHour, current hour of the evaluation
-//- evaluator, function which receives a time representing the current hour
+//- evaluator, function which receives a context, a time representing the current hour
 // a string, representing the domain to evaluate, and returns a domainevaluation.
 // normally, evaluator is a scraper
-//- db, a pointer representing the database controller to use for db queries.
 
 // and returns:
 // -de, domain evaluation representing the result of the function.
@@ -105,7 +168,7 @@ func (x *APIError) IsInArray(a []APIError) bool {
 // - appErr, if there aren't errors, appErr is the result of calling DefaultAPIError,
 // if there are errors, appErr is going to be one of the possible values APIErrors
 
-// The function implements the next algorithm:
+// The method implements the next algorithm:
 // 1) In the database, is there a Domain Evaluation in process
 // with the same given domain?
 // 1.1) YES: Is difference between the current hour
@@ -128,8 +191,13 @@ func (x *APIError) IsInArray(a []APIError) bool {
 // Changed is now true.
 
 
-func EvaluateDomainTW(waitTime time.Duration, domainName string, currentHour time.Time,
-  evaluator func(time.Time, string) (dao.DomainEvaluation, error), db *sql.DB) (de dao.DomainEvaluation, changed bool, appErr APIError) {
+func (s *Service) EvaluateDomainTW(ctx context.Context, waitTime time.Duration, domainName string, currentHour time.Time,
+  evaluator Evaluator) (de dao.DomainEvaluation, changed bool, appErr APIError) {
+  ctx, span := tracing.Start(ctx, "EvaluateDomainTW", tracing.DomainKey.String(domainName))
+  defer func() {
+    observeEvaluation(ctx, domainName, de, changed, appErr)
+    span.End()
+  }()
 
   de.Servers = make([]dao.Server, 0)
   // 1) In the database, is there a Domain Evaluation in process
@@ -140,7 +208,10 @@ func EvaluateDomainTW(waitTime time.Duration, domainName string, currentHour tim
   var err error
 	pendingEvaluation := dao.DomainEvaluation{}
 
-	err = pendingEvaluation.SearchLastEvaluation(domainName, true, currentHour, db)
+	err = s.query(ctx, func(ctx context.Context) (err error) {
+		pendingEvaluation, err = s.Store.SearchLastEvaluation(ctx, domainName, true, currentHour)
+		return
+	})
 	if err != nil {
     appErr = APIErrors.E601(err)
 		return
@@ -159,21 +230,27 @@ func EvaluateDomainTW(waitTime time.Duration, domainName string, currentHour tim
 		if pendingEvaluationHourA20.After(currentHour) {
 			// 1.1.1) YES: In the database, data will remain unchanged
 			// return the pending evaluation
+			_, branch := startBranch(ctx, "1.1.1", "returnPendingEvaluation")
+			defer branch.End()
 			de = pendingEvaluation
 			return
 		} else {
 			// 1.1.2) NO: Update the hour of the pending Evaluation with the current hour
+			ctx, branch := startBranch(ctx, "1.1.2", "refreshPendingEvaluation")
+			defer branch.End()
 			pendingEvaluation.EvaluationHour = currentHour.Format(time.RFC3339)
-			err = pendingEvaluation.UpdateHourInDb(db)
+			err = s.write(ctx, func(ctx context.Context) error {
+				return s.Store.UpdateEvaluationHour(ctx, &pendingEvaluation)
+			})
 			if err != nil {
         appErr = APIErrors.E601(err)
 				return
 			}
 
 			var currentEvaluation dao.DomainEvaluation
-			currentEvaluation, err = evaluator(currentHour, domainName)
+			currentEvaluation, err = s.evaluate(ctx, evaluator, currentHour, domainName, false)
 			if err != nil {
-        appErr = APIErrors.E602(err)
+        appErr = evaluationError(err)
 				return
 			}
 			// 1.1.2) In SSLabs, Is the Domain Evaluation in process?
@@ -185,8 +262,8 @@ func EvaluateDomainTW(waitTime time.Duration, domainName string, currentHour tim
 				// 1.1.2.2) NO: Update the pending evaluation in the database, with
 				// the information of the current evaluation. Changed var is now true.
 				currentEvaluation.Id = pendingEvaluation.Id
-        err = crdb.ExecuteTx(context.Background(), db, nil, func(tx *sql.Tx) error {
-          return currentEvaluation.UpdateInDB(tx)
+        err = s.write(ctx, func(ctx context.Context) error {
+          return s.Store.UpdateEvaluation(ctx, &currentEvaluation)
         })
         if err != nil {
           appErr = APIErrors.E601(err)
@@ -200,7 +277,10 @@ func EvaluateDomainTW(waitTime time.Duration, domainName string, currentHour tim
 	} else {
 		// 1.2) NO: Is there a past Domain Evaluation, ready, with the same given domain?
 		pastEvaluation := dao.DomainEvaluation{}
-		err = pastEvaluation.SearchLastEvaluation(domainName, false, currentHour, db)
+		err = s.query(ctx, func(ctx context.Context) (err error) {
+			pastEvaluation, err = s.Store.SearchLastEvaluation(ctx, domainName, false, currentHour)
+			return
+		})
     if err != nil {
       appErr = APIErrors.E601(err)
       return
@@ -218,19 +298,23 @@ func EvaluateDomainTW(waitTime time.Duration, domainName string, currentHour tim
 			if pastEvaluationHourA20.After(currentHour) {
 				// 1.2.1.1) YES: In the database, data will remain unchanged,
 				// return the past evaluation
+				_, branch := startBranch(ctx, "1.2.1.1", "returnPastEvaluation")
+				defer branch.End()
 				de = pastEvaluation
 				return
 			} else {
 				// 1.2.1.2) NO: Make a Domain Evaluation using the SSLabs API, save it in DB.
         // Changed is now true.
+				ctx, branch := startBranch(ctx, "1.2.1.2", "replacePastEvaluation")
+				defer branch.End()
 				var currentEvaluation dao.DomainEvaluation
-				currentEvaluation, err = evaluator(currentHour, domainName)
+				currentEvaluation, err = s.evaluate(ctx, evaluator, currentHour, domainName, true)
 				if err != nil {
-          appErr = APIErrors.E602(err)
+          appErr = evaluationError(err)
 					return
 				}
-        err = crdb.ExecuteTx(context.Background(), db, nil, func(tx *sql.Tx) error {
-          return currentEvaluation.CreateInDB(tx)
+        err = s.write(ctx, func(ctx context.Context) error {
+          return s.Store.CreateEvaluation(ctx, &currentEvaluation)
         })
         if err != nil {
           appErr =  APIErrors.E601(err)
@@ -243,14 +327,16 @@ func EvaluateDomainTW(waitTime time.Duration, domainName string, currentHour tim
 		} else {
 			// 1.2.2) NO: Make a Domain Evaluation using the SSLabs API, save it in DB.
       // Changed is now true.
+			ctx, branch := startBranch(ctx, "1.2.2", "createEvaluation")
+			defer branch.End()
 			var currentEvaluation dao.DomainEvaluation
-			currentEvaluation, err = evaluator(currentHour, domainName)
+			currentEvaluation, err = s.evaluate(ctx, evaluator, currentHour, domainName, true)
 			if err != nil {
-        appErr = APIErrors.E602(err)
+        appErr = evaluationError(err)
 				return
 			}
-      err = crdb.ExecuteTx(context.Background(), db, nil, func(tx *sql.Tx) error {
-        return currentEvaluation.CreateInDB(tx)
+      err = s.write(ctx, func(ctx context.Context) error {
+        return s.Store.CreateEvaluation(ctx, &currentEvaluation)
       })
       if err != nil {
         appErr = APIErrors.E601(err)
@@ -263,128 +349,352 @@ func EvaluateDomainTW(waitTime time.Duration, domainName string, currentHour tim
 	}
 }
 
-// Main function for evaluating domains, the function use the EvaluateDomainTW,
-// passing it the global var DomainEvaluationTW containing the waiting time between
+// Auxiliar method for calling the evaluator under the evaluator deadline.
+// The evaluation is tagged with the request ID of ctx, so the stored row can
+// be traced back to the request (and its log lines) that produced it.
+// The calls starting a new assessment upstream are limited per client and
+// globally, see allowEvaluation, while the polls of an assessment in progress
+// aren't. They are also counted against the daily quota of the API key when
+// ctx asks so, see WithEvaluationCharges. The progress reported by the
+// evaluator is published in the Events of the service.
+func (s *Service) evaluate(ctx context.Context, evaluator Evaluator, currentHour time.Time,
+	domainName string, newAssessment bool) (de dao.DomainEvaluation, err error) {
+	ctx, span := tracing.Start(ctx, "evaluator", tracing.DomainKey.String(domainName))
+	defer tracing.End(span, &err)
+	if newAssessment {
+		if err = s.allowEvaluation(ctx); err != nil {
+			return
+		}
+		if chargesEachEvaluation(ctx) {
+			if appErr := s.ChargeEvaluation(ctx, time.Now()); appErr.Code != DefaultAPIError().Code {
+				err = &quotaError{appErr}
+				return
+			}
+		}
+	}
+	ctx = scrapers.WithProgressReporter(ctx, s.progressReporter(domainName))
+	err = withTimeout(ctx, s.Config.Timeouts.Evaluator, func(ctx context.Context) (err error) {
+		de, err = evaluator(ctx, currentHour, domainName)
+		return
+	})
+	de.RequestId = logging.RequestID(ctx)
+	return
+}
+
+// Auxiliar method for taking a token from the buckets of new evaluations: the
+// one of the client of the request (see ratelimit.WithClient) and the global one.
+func (s *Service) allowEvaluation(ctx context.Context) error {
+	perMinute := func(limit int) ratelimit.Rate {
+		return ratelimit.Rate{Limit: limit, Per: time.Minute}
+	}
+	if client := ratelimit.Client(ctx); client != "" {
+		err := ratelimit.Check(ctx, s.Limiter, "evaluations:"+client, perMinute(s.Config.ClientEvaluationLimit))
+		if err != nil {
+			return err
+		}
+	}
+	return ratelimit.Check(ctx, s.Limiter, "evaluations", perMinute(s.Config.GlobalEvaluationLimit))
+}
+
+// Auxiliar function for the errors of the evaluator. The evaluations rejected
+// by the limits of new evaluations are reported as E909, and the ones rejected
+// by the daily quota keep their error.
+func evaluationError(err error) APIError {
+  var limitErr *ratelimit.LimitError
+  if errors.As(err, &limitErr) {
+    return APIErrors.E909(limitErr)
+  }
+  var qErr *quotaError
+  if errors.As(err, &qErr) {
+    return qErr.appErr
+  }
+  return APIErrors.E602(err)
+}
+
+// Main method for evaluating domains, the method use the EvaluateDomainTW,
+// passing it the DomainEvaluationTW setting containing the waiting time between
 // evaluation of domains.
-func EvaluateDomain(domainName string, currentHour time.Time, evaluator func(time.Time, string) (dao.DomainEvaluation, error),
-	db *sql.DB) (de dao.DomainEvaluation, changed bool, appErr APIError) {
-    return EvaluateDomainTW(DomainEvaluationTW, domainName, currentHour, evaluator, db)
+func (s *Service) EvaluateDomain(ctx context.Context, domainName string, currentHour time.Time,
+	evaluator Evaluator) (de dao.DomainEvaluation, changed bool, appErr APIError) {
+    return s.EvaluateDomainTW(ctx, s.Config.DomainEvaluationTW, domainName, currentHour, evaluator)
 }
 
-// Main function for evaluating domains and scrapping the info about domains.
-// The ScraperTestComplete function receives the domainName, the currentHour, and the
-// global database controller db.
+// Main method for evaluating domains and scrapping the info about domains.
+// The ScraperTestComplete method receives the context of the request, the domainName
+// and the currentHour.
 
 // and returns
 // dec, a structure representing DomainEvaluationComplete
 // appErrs, multiple errs scraping the web or getting info from the database.
 
-// This function is used for displaying all the information about a specific domain
+// This method is used for displaying all the information about a specific domain
 // including the information from the different scrapers. And servers_changed,
-// previous_ssl_grade. Internally, the function uses the EvaluateDomain function for
-// getting a specific DomainEvaluation structure, after that, if the EvaluateDomain function
+// previous_ssl_grade. Internally, the method uses the EvaluateDomain method for
+// getting a specific DomainEvaluation structure, after that, if the EvaluateDomain method
 // returns true, then ScraperTestComplete updates all info about the domain using scrapers.
-func ScraperTestComplete(domain string, currentHour time.Time, db *sql.DB) (dec dao.DomainEvaluationComplete, appErrs []APIError) {
+// The scraped info is written in a single transaction, so a cancelled request
+// doesn't leave the evaluation partially updated.
+
+// Concurrent calls for the same domain are coalesced: only one evaluation runs
+// in the process and every caller receives its result. Between API replicas,
+// the evaluationLock table guarantees that only one of them evaluates the domain
+// at a time, the others wait for the lock and then read the stored evaluation.
+
+// The domain is normalized (see validation.NormalizeDomain) before anything
+// else, and invalid domains are rejected with an E901 error.
+func (s *Service) ScraperTestComplete(ctx context.Context, domain string, currentHour time.Time) (dec dao.DomainEvaluationComplete, appErrs []APIError) {
+	ctx, span := tracing.Start(ctx, "ScraperTestComplete", tracing.DomainKey.String(domain))
+	defer span.End()
+	var err error
+	if domain, err = validation.NormalizeDomain(domain); err != nil {
+		dec.Servers = make([]dao.Server, 0)
+		appErrs = []APIError{APIErrors.E901(err)}
+		return
+	}
+	dec, appErrs, err = s.evaluations.do(ctx, domain, func(ctx context.Context) (dao.DomainEvaluationComplete, []APIError) {
+		return s.lockedScraperTestComplete(ctx, domain, currentHour)
+	})
+	if err != nil {
+		dec.Servers = make([]dao.Server, 0)
+		appErrs = []APIError{APIErrors.E603(err)}
+	}
+	return
+}
+
+// Auxiliar method for running scraperTestComplete while holding the
+// evaluation lock of the domain in the store.
+func (s *Service) lockedScraperTestComplete(ctx context.Context, domain string, currentHour time.Time) (dec dao.DomainEvaluationComplete, appErrs []APIError) {
+	dec.Servers = make([]dao.Server, 0)
+	start := time.Now()
+	for {
+		var acquired bool
+		err := s.query(ctx, func(ctx context.Context) (err error) {
+			acquired, err = s.Store.AcquireEvaluationLock(ctx, domain, s.instanceID, s.Config.EvaluationLockTTL)
+			return
+		})
+		if err != nil {
+			appErrs = []APIError{APIErrors.E601(err)}
+			return
+		}
+		if acquired {
+			break
+		}
+		slog.DebugContext(ctx, "waiting for the evaluation lock", "domain", domain)
+		select {
+		case <-ctx.Done():
+			appErrs = []APIError{APIErrors.E603(ctx.Err())}
+			return
+		case <-time.After(s.Config.EvaluationLockPoll):
+		}
+	}
+	defer func() {
+		// The lock is released even if the evaluation was cancelled, otherwise the
+		// domain would stay blocked until the lock expires.
+		s.query(context.WithoutCancel(ctx), func(ctx context.Context) error {
+			return s.Store.ReleaseEvaluationLock(ctx, domain, s.instanceID)
+		})
+	}()
+	// The evaluation may outlast the TTL of the lock (the evaluator, and the
+	// scrapers of every server), so the lock is renewed while it runs. The
+	// heartbeat stops before the lock is released.
+	heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		s.renewEvaluationLock(heartbeatCtx, domain)
+	}()
+	defer func() {
+		stopHeartbeat()
+		<-heartbeatDone
+	}()
+	// While waiting for the lock another replica may have stored an evaluation
+	// after currentHour, so the hour moves forward by the time spent waiting.
+	return s.scraperTestComplete(ctx, domain, currentHour.Add(time.Since(start)))
+}
+
+// Auxiliar method for renewing the evaluation lock of a domain every third of
+// its TTL, until ctx is done.
+func (s *Service) renewEvaluationLock(ctx context.Context, domain string) {
+	if s.Config.EvaluationLockTTL < 3 {
+		return
+	}
+	ticker := time.NewTicker(s.Config.EvaluationLockTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var renewed bool
+		err := s.query(ctx, func(ctx context.Context) (err error) {
+			renewed, err = s.Store.AcquireEvaluationLock(ctx, domain, s.instanceID, s.Config.EvaluationLockTTL)
+			return
+		})
+		if err == nil && !renewed {
+			err = errors.New("the lock is held by another replica")
+		}
+		if err != nil && ctx.Err() == nil {
+			slog.WarnContext(ctx, "evaluation lock not renewed", "domain", domain, "error", err)
+		}
+	}
+}
+
+// Auxiliar function for the errors fetching the homepage of a domain. The
+// fetches blocked by the safe client of the scrapers (because the domain
+// resolves to a private, loopback or link-local address) are reported as E703.
+func homepageError(err error, apiError func(error) APIError) APIError {
+  var blocked *scrapers.BlockedError
+  if errors.As(err, &blocked) {
+    return APIErrors.E703(blocked)
+  }
+  return apiError(err)
+}
+
+// Auxiliar method doing the evaluation and the scraping of ScraperTestComplete.
+func (s *Service) scraperTestComplete(ctx context.Context, domain string, currentHour time.Time) (dec dao.DomainEvaluationComplete, appErrs []APIError) {
 	dec = dao.DomainEvaluationComplete{}
   dec.Servers = make([]dao.Server, 0)
 
 	appErrs = make([]APIError, 0)
 
-	de, changed, appErr := EvaluateDomain(domain, currentHour, scrapers.ScraperSSLabs, db)
+	de, changed, appErr := s.EvaluateDomain(ctx, domain, currentHour, s.Scrapers.Evaluator)
   defaultCode := DefaultAPIError()
 	if !(appErr.Code == defaultCode.Code) {
 		appErrs = append(appErrs, appErr)
 	}
   var err error
 	dec.Copy(de)
+  // The changes are published once the enrichment ends, as do the failures.
+  defer func() {
+    if ev := resultEvent(domain, dec, appErrs); changed || ev.Stage == StageError {
+      s.Events.Publish(ev)
+    }
+  }()
 
   if changed {
+    // The servers are only enriched once SSLabs ends the evaluation.
+    if !de.EvaluationInProgress {
+      s.Events.Publish(EvaluationEvent{Domain: domain, Stage: StageEnrichment})
+    }
     if !de.IsDown {
-      dec.Logo, err = scrapers.ScraperLogo(domain)
+      err = s.scrape(ctx, "logo", tracing.DomainKey.String(domain), func(ctx context.Context) (err error) {
+        dec.Logo, err = s.Scrapers.Logo(ctx, domain)
+        return
+      })
       if err != nil {
-        appErrs = append(appErrs, APIErrors.E701(err))
+        appErrs = append(appErrs, homepageError(err, APIErrors.E701))
       }
       de.Logo = dec.Logo
-      err = de.UpdateLogoInDb(db)
-      if err != nil {
-        appErrs = append(appErrs, APIErrors.E601(err))
-      }
 
-      dec.Title, err = scrapers.ScraperTitle(domain)
-      if err != nil {
-        appErrs = append(appErrs, APIErrors.E702(err))
-      }
-      de.Logo = dec.Title
-      err = de.UpdateTitleInDb(db)
+      err = s.scrape(ctx, "title", tracing.DomainKey.String(domain), func(ctx context.Context) (err error) {
+        dec.Title, err = s.Scrapers.Title(ctx, domain)
+        return
+      })
       if err != nil {
-        appErrs = append(appErrs, APIErrors.E601(err))
+        appErrs = append(appErrs, homepageError(err, APIErrors.E702))
       }
+      de.Title = dec.Title
     }
     if !de.EvaluationInProgress && !de.IsDown {
       for i := range dec.Servers {
         ip := dec.Servers[i].Address
-        dec.Servers[i].Country, err = scrapers.ScraperCountry(ip)
+        err = s.scrape(ctx, "country", tracing.ServerIPKey.String(ip), func(ctx context.Context) (err error) {
+          dec.Servers[i].Country, err = s.Scrapers.Country(ctx, ip)
+          return
+        })
         if err != nil {
           appErrs = append(appErrs, APIErrors.E801(err))
         }
-        dec.Servers[i].Owner, err = scrapers.ScraperOwner(ip)
+        err = s.scrape(ctx, "owner", tracing.ServerIPKey.String(ip), func(ctx context.Context) (err error) {
+          dec.Servers[i].Owner, err = s.Scrapers.Owner(ctx, ip)
+          return
+        })
         if err != nil {
           appErrs = append(appErrs, APIErrors.E802(err))
         }
-        err = dec.Servers[i].UpdateInDB(db)
-        if err != nil {
-    			appErrs = append(appErrs, APIErrors.E601(err))
-    			return
-    		}
       }
-      var serversChangedI int
-      serversChangedI, err = de.HaveServersChanged(db)
+    }
+    if !de.IsDown {
+      de.Servers = dec.Servers
+      err = s.write(ctx, func(ctx context.Context) error {
+        return s.Store.UpdateEnrichment(ctx, &de)
+      })
       if err != nil {
         appErrs = append(appErrs, APIErrors.E601(err))
         return
       }
-      dec.ServersChanged = (serversChangedI == dao.SLStatus.Changed)
-      dec.PreviousSslGrade, err = de.PreviousSSLgrade(db)
-      if err != nil {
-        appErrs = append(appErrs, APIErrors.E601(err))
+    }
+    if !de.EvaluationInProgress && !de.IsDown {
+      if appErr := s.CompareWithBaseline(ctx, domain, &dec, s.Config.Baseline); appErr.Code != defaultCode.Code {
+        appErrs = append(appErrs, appErr)
         return
       }
     }
   }
 
+  // Every ready evaluation reports its drift, not only the new ones.
+  if de.Id != 0 && !de.EvaluationInProgress {
+    if appErr := s.checkDrift(ctx, domain, &dec); appErr.Code != defaultCode.Code {
+      appErrs = append(appErrs, appErr)
+    }
+  }
+
 	return
 }
 
-// Main function for listing recent evaluations.
-// The function gets the recent domain evaluations, but using a time limiter to
-// avoid overloading the server.
-// The time limiter is present in the global vars RecentEvaluations,
-// RecentEvaluationsLQ
-
-func ListRecentEvaluations(currentHour time.Time, db *sql.DB) (apiErrs []APIError) {
-
-  if len(RecentEvaluations) == 0 {
-    var err error
-    RecentEvaluations, err = dao.ListRecentDomainEvaluations(dao.DBConf)
-  	apiErrs = make([]APIError,0)
-  	if err != nil {
-  		apiErrs = append(apiErrs, APIErrors.E601(err))
-  	}
-    RecentEvaluationsLQ = currentHour
-    return
+// Method for comparing a ready evaluation of a domain, as returned by
+// ScraperTestComplete, with its baseline (see dao.Baseline), setting its
+// servers_changed, previous_ssl_grade and baseline. The evaluations are
+// compared with the baseline of the Config when they are done, so this is
+// only needed for comparing them with another one.
+func (s *Service) CompareWithBaseline(ctx context.Context, domain string, dec *dao.DomainEvaluationComplete,
+  baseline dao.Baseline) APIError {
+  domain, err := validation.NormalizeDomain(domain)
+  if err != nil {
+    return APIErrors.E901(err)
   }
-
-  if RecentEvaluationsLQ.Add(RecentEvaluationsTW).Before(currentHour) {
-    var err error
-    RecentEvaluations, err = dao.ListRecentDomainEvaluations(dao.DBConf)
-  	apiErrs = make([]APIError,0)
-  	if err != nil {
-  		apiErrs = append(apiErrs, APIErrors.E601(err))
-  	}
-    RecentEvaluationsLQ = currentHour
+  de := dao.DomainEvaluation{Id: dec.EvaluationId, Domain: domain, EvaluationHour: dec.EvaluationHour}
+  var found dao.DomainEvaluation
+  err = s.query(ctx, func(ctx context.Context) (err error) {
+    // The evaluations read again from the store come without their servers.
+    if de.Servers, err = s.Store.ListServers(ctx, de.Id); err != nil {
+      return
+    }
+    found, err = de.SearchBaseline(ctx, s.Store, baseline)
     return
+  })
+  if err != nil {
+    return APIErrors.E601(err)
   }
+  dec.CompareWith(de.Servers, found)
+  return DefaultAPIError()
+}
+
+// Key of the list of recent evaluations in the RecentEvaluations cache.
+const recentEvaluationsKey = "recent"
 
+// Main method for listing recent evaluations.
+// The method gets the recent domain evaluations, but using the
+// RecentEvaluations cache of the service to avoid overloading the server.
+func (s *Service) ListRecentEvaluations(ctx context.Context, currentHour time.Time) (evaluations []dao.DomainEvaluation, apiErrs []APIError) {
   apiErrs = make([]APIError, 0)
+  evaluations, err := s.RecentEvaluations.Get(ctx, recentEvaluationsKey, currentHour,
+    func(ctx context.Context) (del []dao.DomainEvaluation, err error) {
+      err = s.query(ctx, func(ctx context.Context) (err error) {
+        del, err = s.Store.ListRecentEvaluations(ctx)
+        return
+      })
+      if err == nil {
+        observeGrades(del)
+      }
+      return
+    })
+  if err != nil {
+    apiErrs = append(apiErrs, APIErrors.E601(err))
+  }
+  if evaluations == nil {
+    evaluations = make([]dao.DomainEvaluation, 0)
+  }
   return
 }
@@ -0,0 +1,276 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/ratelimit"
+)
+
+// Prefix of the API keys, it makes them easy to spot in logs and configs.
+const APIKeyPrefix = "dek_"
+
+// Length of the part of a key kept in plain text for identifying it.
+const apiKeyPrefixLength = 12
+
+// APIKeyStatus - Struct representing an API key, together with its usage during
+// the current day, as shown to the admins.
+type APIKeyStatus struct {
+	dao.APIKey
+	Today dao.APIKeyUsage `json:"today"`
+}
+
+// Auxiliar function for the day of the usage counters (in UTC).
+func usageDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// Method for creating an API key. rateLimit and dailyQuota take the values of
+// the settings of the service when they are zero.
+// The key is returned in plain text only here, the store keeps its hash.
+func (s *Service) CreateAPIKey(ctx context.Context, name string, rateLimit int, dailyQuota int,
+	now time.Time) (key dao.APIKey, plain string, appErr APIError) {
+	appErr = DefaultAPIError()
+	if name == "" || len(name) > 100 {
+		appErr = APIErrors.E905(errors.New("the name must have between 1 and 100 characters"))
+		return
+	}
+	if rateLimit < 0 || dailyQuota < 0 {
+		appErr = APIErrors.E905(errors.New("the rate limit and the daily quota can't be negative"))
+		return
+	}
+	if rateLimit == 0 {
+		rateLimit = s.Config.APIKeyRateLimit
+	}
+	if dailyQuota == 0 {
+		dailyQuota = s.Config.APIKeyDailyQuota
+	}
+
+	b := make([]byte, 24)
+	rand.Read(b)
+	plain = APIKeyPrefix + hex.EncodeToString(b)
+	key = dao.APIKey{
+		Name:       name,
+		Prefix:     plain[:apiKeyPrefixLength],
+		KeyHash:    dao.HashAPIKey(plain),
+		RateLimit:  rateLimit,
+		DailyQuota: dailyQuota,
+		CreatedAt:  now.UTC(),
+	}
+	err := s.query(ctx, func(ctx context.Context) error {
+		return s.Store.CreateAPIKey(ctx, &key)
+	})
+	if err != nil {
+		appErr = APIErrors.E601(err)
+		return dao.APIKey{}, "", appErr
+	}
+	return
+}
+
+// Method for revoking an API key, the requests using it are rejected from now on.
+func (s *Service) RevokeAPIKey(ctx context.Context, id int, now time.Time) (appErr APIError) {
+	appErr = DefaultAPIError()
+	err := s.query(ctx, func(ctx context.Context) error {
+		return s.Store.RevokeAPIKey(ctx, id, now.UTC())
+	})
+	if errors.Is(err, dao.ErrAPIKeyNotFound) {
+		appErr = APIErrors.E906(fmt.Errorf("no API key with id %d", id))
+	} else if err != nil {
+		appErr = APIErrors.E601(err)
+	}
+	return
+}
+
+// Method for listing the API keys with their usage during the current day.
+func (s *Service) ListAPIKeys(ctx context.Context, now time.Time) (keys []APIKeyStatus, appErrs []APIError) {
+	keys = make([]APIKeyStatus, 0)
+	appErrs = make([]APIError, 0)
+	day := usageDay(now)
+	err := s.query(ctx, func(ctx context.Context) error {
+		stored, err := s.Store.ListAPIKeys(ctx)
+		if err != nil {
+			return err
+		}
+		for _, key := range stored {
+			status := APIKeyStatus{APIKey: key, Today: dao.APIKeyUsage{KeyId: key.Id, Day: day}}
+			usage, err := s.Store.ListAPIKeyUsage(ctx, key.Id)
+			if err != nil {
+				return err
+			}
+			for _, u := range usage {
+				if u.Day == day {
+					status.Today = u
+				}
+			}
+			keys = append(keys, status)
+		}
+		return nil
+	})
+	if err != nil {
+		keys = make([]APIKeyStatus, 0)
+		appErrs = append(appErrs, APIErrors.E601(err))
+	}
+	return
+}
+
+// Method for listing the usage of an API key by day.
+func (s *Service) ListAPIKeyUsage(ctx context.Context, id int) (usage []dao.APIKeyUsage, appErrs []APIError) {
+	usage = make([]dao.APIKeyUsage, 0)
+	appErrs = make([]APIError, 0)
+	err := s.query(ctx, func(ctx context.Context) (err error) {
+		usage, err = s.Store.ListAPIKeyUsage(ctx, id)
+		return
+	})
+	if err != nil {
+		usage = make([]dao.APIKeyUsage, 0)
+		appErrs = append(appErrs, APIErrors.E601(err))
+	}
+	return
+}
+
+// Main method for authorizing a request made with an API key.
+// The method receives the key in plain text, whether the request asks for an
+// evaluation of a domain (which is counted against the daily quota), and the
+// current time. It returns the key, the decision of the rate limiter (useful
+// for the rate limit headers) and:
+// - E902 when the key is missing, unknown or revoked.
+// - E903 when the key made more requests than its rate limit in the last minute.
+// - E904 when the request is an evaluation and the key spent its daily quota.
+// The RetryAfter of the decision tells when the rejected request can be retried.
+func (s *Service) AuthorizeAPIKey(ctx context.Context, plain string, evaluation bool,
+	now time.Time) (key dao.APIKey, decision ratelimit.Decision, appErr APIError) {
+	if plain == "" {
+		appErr = APIErrors.E902(errors.New("the request has no API key"))
+		return
+	}
+	return s.authorizeKey(ctx, func(ctx context.Context) (dao.APIKey, error) {
+		return s.Store.FindAPIKey(ctx, dao.HashAPIKey(plain))
+	}, evaluation, now)
+}
+
+// Auxiliar method for authorizing a request made with the API key found by
+// find, see AuthorizeAPIKey.
+func (s *Service) authorizeKey(ctx context.Context, find func(context.Context) (dao.APIKey, error),
+	evaluation bool, now time.Time) (key dao.APIKey, decision ratelimit.Decision, appErr APIError) {
+	appErr = DefaultAPIError()
+	err := s.query(ctx, func(ctx context.Context) (err error) {
+		key, err = find(ctx)
+		return
+	})
+	if err != nil {
+		appErr = APIErrors.E601(err)
+		return
+	}
+	if key.Id == 0 || key.RevokedAt != nil {
+		appErr = APIErrors.E902(errors.New("the API key is unknown or revoked"))
+		return
+	}
+
+	decision, err = s.Limiter.Allow(ctx, fmt.Sprintf("apikey:%d", key.Id),
+		ratelimit.Rate{Limit: key.RateLimit, Per: time.Minute})
+	if err != nil {
+		appErr = APIErrors.E601(err)
+		return
+	}
+	if !decision.Allowed {
+		appErr = APIErrors.E903(fmt.Errorf("limit of %d requests per minute", key.RateLimit))
+		return
+	}
+
+	err = s.query(ctx, func(ctx context.Context) error {
+		return s.Store.CountRequest(ctx, key.Id, usageDay(now))
+	})
+	if err != nil {
+		appErr = APIErrors.E601(err)
+		return
+	}
+	if !evaluation {
+		return
+	}
+	if appErr = s.chargeEvaluation(ctx, key, now); appErr.RetryAfter > 0 {
+		decision.Allowed = false
+		decision.RetryAfter = appErr.RetryAfter
+	}
+	return
+}
+
+// Auxiliar method for counting an evaluation against the daily quota of key.
+// When the quota is spent, the E904 error keeps the time until it's restored.
+func (s *Service) chargeEvaluation(ctx context.Context, key dao.APIKey, now time.Time) (appErr APIError) {
+	appErr = DefaultAPIError()
+	var allowed bool
+	err := s.query(ctx, func(ctx context.Context) (err error) {
+		allowed, err = s.Store.ConsumeEvaluation(ctx, key.Id, usageDay(now), key.DailyQuota)
+		return
+	})
+	if err != nil {
+		appErr = APIErrors.E601(err)
+		return
+	}
+	if !allowed {
+		// The quota is restored at the start of the next day.
+		tomorrow := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		appErr = APIErrors.E904(fmt.Errorf("quota of %d evaluations per day", key.DailyQuota))
+		appErr.RetryAfter = tomorrow.Sub(now)
+	}
+	return
+}
+
+// apiKeyKey - Key of the authorized API key in the context of a request.
+type apiKeyKey struct{}
+
+// Function for storing the API key that authorized a request in its context.
+func WithAPIKey(ctx context.Context, key dao.APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyKey{}, key)
+}
+
+// Function for getting the API key stored with WithAPIKey, the Id is 0 when
+// the request wasn't authorized with a key.
+func APIKeyFromContext(ctx context.Context) dao.APIKey {
+	key, _ := ctx.Value(apiKeyKey{}).(dao.APIKey)
+	return key
+}
+
+// Method for counting an evaluation against the daily quota of the API key
+// of the request, for the endpoints that can't know beforehand whether the
+// request asks for an evaluation. Requests without a key aren't counted.
+func (s *Service) ChargeEvaluation(ctx context.Context, now time.Time) APIError {
+	key := APIKeyFromContext(ctx)
+	if key.Id == 0 {
+		return DefaultAPIError()
+	}
+	return s.chargeEvaluation(ctx, key, now)
+}
+
+// chargeEachKey - Key of the flag of WithEvaluationCharges in the context of
+// a request.
+type chargeEachKey struct{}
+
+// Function for counting each new evaluation started with ctx against the daily
+// quota of its API key, instead of the request itself, for the long-lived
+// calls like the watch streams.
+func WithEvaluationCharges(ctx context.Context) context.Context {
+	return context.WithValue(ctx, chargeEachKey{}, true)
+}
+
+// Auxiliar function for knowing whether the new evaluations started with ctx
+// are counted one by one (see WithEvaluationCharges).
+func chargesEachEvaluation(ctx context.Context) bool {
+	charge, _ := ctx.Value(chargeEachKey{}).(bool)
+	return charge
+}
+
+// quotaError - Struct wrapping the E904 error of a new evaluation rejected by
+// the daily quota, so it reaches the client as it is.
+type quotaError struct {
+	appErr APIError
+}
+
+func (e *quotaError) Error() string {
+	return e.appErr.Err
+}
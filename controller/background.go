@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"context"
+	"sync"
+)
+
+// backgroundJobs - Struct tracking the jobs of a Service that outlive the
+// requests, like the batches and the evaluation of the watched domains, so
+// they can be cancelled and waited for on shutdown.
+type backgroundJobs struct {
+	mu      sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+}
+
+// Default constructor for the backgroundJobs struct.
+func newBackgroundJobs() *backgroundJobs {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &backgroundJobs{ctx: ctx, cancel: cancel}
+}
+
+// Auxiliar method for starting a job. The context of the job keeps the values
+// of ctx and is cancelled with it, or when the jobs are stopped, and done must
+// be called when the job ends. It returns false, without starting the job,
+// once the jobs were stopped.
+func (b *backgroundJobs) start(ctx context.Context) (jobCtx context.Context, done func(), ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ctx.Err() != nil {
+		return ctx, func() {}, false
+	}
+	b.running.Add(1)
+	jobCtx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(b.ctx, cancel)
+	return jobCtx, func() {
+		stop()
+		cancel()
+		b.running.Done()
+	}, true
+}
+
+// Auxiliar method for cancelling the jobs running and rejecting the new ones.
+func (b *backgroundJobs) stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cancel()
+}
+
+// Auxiliar method for waiting until every job started has ended.
+func (b *backgroundJobs) wait() {
+	b.running.Wait()
+}
@@ -0,0 +1,277 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/validation"
+)
+
+// Status of the domains of a batch.
+const (
+	// The domain is waiting for a free slot (see Config.BatchConcurrency).
+	BatchPending = "pending"
+	// The domain is being evaluated, or SSLabs is still working on it.
+	BatchRunning = "running"
+	// The evaluation of the domain is ready.
+	BatchDone = "done"
+	// The domain was rejected or its evaluation failed, the item has the errors.
+	BatchFailed = "failed"
+)
+
+// BatchResult - Struct representing the state of a batch and the results of
+// each one of its domains.
+type BatchResult struct {
+	Id        string            `json:"id"`
+	CreatedAt time.Time         `json:"created_at"`
+	Done      bool              `json:"done"`
+	Total     int               `json:"total"`
+	Pending   int               `json:"pending"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Items     []BatchItemResult `json:"items"`
+}
+
+// BatchItemResult - Struct representing the result of a domain of a batch.
+type BatchItemResult struct {
+	dao.BatchItem
+	APIErrors []APIError `json:"errors"`
+}
+
+// Auxiliar function for building the BatchResult of a stored batch.
+func newBatchResult(b dao.Batch) BatchResult {
+	result := BatchResult{Id: b.Id, CreatedAt: b.CreatedAt, Total: len(b.Items),
+		Items: make([]BatchItemResult, 0, len(b.Items))}
+	for _, item := range b.Items {
+		appErrs := make([]APIError, 0)
+		if item.Errors != "" {
+			json.Unmarshal([]byte(item.Errors), &appErrs)
+		}
+		switch item.Status {
+		case BatchDone:
+			result.Succeeded++
+		case BatchFailed:
+			result.Failed++
+		default:
+			result.Pending++
+		}
+		result.Items = append(result.Items, BatchItemResult{BatchItem: item, APIErrors: appErrs})
+	}
+	result.Done = result.Pending == 0
+	return result
+}
+
+// Auxiliar function for the ids of the batches, which aren't guessable since
+// they are the only way to read a batch.
+func newBatchID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Auxiliar function for storing the errors of an item of a batch.
+func setItemErrors(item *dao.BatchItem, appErrs []APIError) {
+	item.Errors = ""
+	if len(appErrs) > 0 {
+		errsB, _ := json.Marshal(appErrs)
+		item.Errors = string(errsB)
+	}
+}
+
+// Main method for creating a batch of evaluations. The domains are normalized
+// and deduplicated, the invalid ones fail right away with an E901 error, and
+// each valid one counts against the daily quota of the API key of the request.
+// The evaluations run in the background, at most Config.BatchConcurrency at
+// the same time across every batch, and their results are read with FindBatch.
+// The batch itself is rejected with an E905 error when it has no domains or
+// more than Config.MaxBatchSize.
+func (s *Service) CreateBatch(ctx context.Context, domains []string, now time.Time) (BatchResult, []APIError) {
+	if len(domains) == 0 {
+		return BatchResult{}, []APIError{APIErrors.E905(fmt.Errorf("the batch has no domains"))}
+	}
+	if s.Config.MaxBatchSize > 0 && len(domains) > s.Config.MaxBatchSize {
+		return BatchResult{}, []APIError{APIErrors.E905(fmt.Errorf("the batch has %d domains, the maximum is %d",
+			len(domains), s.Config.MaxBatchSize))}
+	}
+	b := dao.Batch{Id: newBatchID(), CreatedAt: now.UTC(), Items: make([]dao.BatchItem, 0, len(domains))}
+	seen := make(map[string]bool)
+	for _, domain := range domains {
+		item := dao.BatchItem{Position: len(b.Items), Domain: domain, Status: BatchPending, UpdatedAt: b.CreatedAt}
+		normalized, err := validation.NormalizeDomain(domain)
+		if err != nil {
+			item.Status = BatchFailed
+			setItemErrors(&item, []APIError{APIErrors.E901(err)})
+		} else if seen[normalized] {
+			continue
+		} else {
+			seen[normalized] = true
+			item.Domain = normalized
+			if appErr := s.ChargeEvaluation(ctx, now); appErr.Code != DefaultAPIError().Code {
+				item.Status = BatchFailed
+				setItemErrors(&item, []APIError{appErr})
+			}
+		}
+		b.Items = append(b.Items, item)
+	}
+	err := s.query(ctx, func(ctx context.Context) error {
+		return s.Store.CreateBatch(ctx, &b)
+	})
+	if err != nil {
+		return BatchResult{}, []APIError{APIErrors.E601(err)}
+	}
+	// The evaluations outlive the request, but keep its values (request id,
+	// client and API key) for the logs and the limits.
+	s.startBatch(context.WithoutCancel(ctx), b)
+	return newBatchResult(b), nil
+}
+
+// Method for getting the state of a batch, failing with an E910 error when
+// it doesn't exist.
+func (s *Service) FindBatch(ctx context.Context, id string) (BatchResult, APIError) {
+	var b dao.Batch
+	err := s.query(ctx, func(ctx context.Context) (err error) {
+		b, err = s.Store.FindBatch(ctx, id)
+		return
+	})
+	if err != nil {
+		return BatchResult{}, APIErrors.E601(err)
+	}
+	if b.Id == "" {
+		return BatchResult{}, APIErrors.E910(fmt.Errorf("batch %q", id))
+	}
+	return newBatchResult(b), DefaultAPIError()
+}
+
+// Method for resuming the batches left unfinished by a previous run of the
+// service, on its startup. Their running domains are evaluated again.
+func (s *Service) ResumeBatches(ctx context.Context) error {
+	return s.query(ctx, func(ctx context.Context) error {
+		ids, err := s.Store.ListBatchIds(ctx, []string{BatchPending, BatchRunning})
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			b, err := s.Store.FindBatch(ctx, id)
+			if err != nil {
+				return err
+			}
+			for i := range b.Items {
+				if b.Items[i].Status == BatchRunning {
+					b.Items[i].Status = BatchPending
+				}
+			}
+			slog.InfoContext(ctx, "resuming batch", "batch", b.Id)
+			s.startBatch(context.WithoutCancel(ctx), b)
+		}
+		return nil
+	})
+}
+
+// Auxiliar method for evaluating the pending domains of a batch in the
+// background, until they end or the service is shut down.
+func (s *Service) startBatch(ctx context.Context, b dao.Batch) {
+	ctx, done, ok := s.jobs.start(ctx)
+	if !ok {
+		return
+	}
+	go func() {
+		defer done()
+		s.runBatch(ctx, b)
+	}()
+}
+
+// Auxiliar method for evaluating the pending domains of a batch, each one as
+// soon as a slot is free.
+func (s *Service) runBatch(ctx context.Context, b dao.Batch) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for _, item := range b.Items {
+		if item.Status != BatchPending {
+			continue
+		}
+		// The select below picks at random when ctx is already done.
+		if ctx.Err() != nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case s.batchSlots <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(item dao.BatchItem) {
+			defer wg.Done()
+			defer func() { <-s.batchSlots }()
+			s.evaluateBatchItem(ctx, b.Id, item)
+		}(item)
+	}
+}
+
+// Auxiliar method for evaluating a domain of a batch through ScraperTestComplete.
+// Like the clients of the API, it waits when the limits of new evaluations
+// are reached, and evaluates the domain again every DomainEvaluationTW while
+// SSLabs is working on it, for at most BatchItemTimeout. When ctx is done,
+// the domain is left pending, so ResumeBatches evaluates it again.
+func (s *Service) evaluateBatchItem(ctx context.Context, batchId string, item dao.BatchItem) {
+	update := func(ctx context.Context) {
+		item.UpdatedAt = time.Now().UTC()
+		err := s.query(ctx, func(ctx context.Context) error {
+			return s.Store.UpdateBatchItem(ctx, batchId, item)
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "updating batch item", "batch", batchId, "domain", item.Domain, "err", err)
+		}
+	}
+	item.Status = BatchRunning
+	update(ctx)
+	deadline := time.Now().Add(s.Config.BatchItemTimeout)
+	for {
+		dec, appErrs := s.ScraperTestComplete(ctx, item.Domain, time.Now())
+		if ctx.Err() != nil {
+			break
+		}
+		// Only the limits of new evaluations are waited, a spent daily quota
+		// fails the domain.
+		wait := time.Duration(0)
+		for _, appErr := range appErrs {
+			if appErr.Code == "909" && appErr.RetryAfter > wait {
+				wait = appErr.RetryAfter
+			}
+		}
+		status := HTTPStatus(appErrs, dec.EvaluationInProgress)
+		if wait == 0 && status == http.StatusAccepted {
+			wait = s.Config.DomainEvaluationTW
+		}
+		if wait > 0 && (s.Config.BatchItemTimeout <= 0 || !time.Now().Add(wait).After(deadline)) {
+			select {
+			case <-ctx.Done():
+			case <-time.After(wait):
+				continue
+			}
+			break
+		}
+		item.Status = BatchDone
+		if wait > 0 {
+			appErrs = append(appErrs, APIErrors.E603(fmt.Errorf("the evaluation of the domain wasn't ready after %v",
+				s.Config.BatchItemTimeout)))
+		}
+		if wait > 0 || status >= http.StatusBadRequest {
+			item.Status = BatchFailed
+		}
+		item.SslGrade = dec.SslGrade
+		item.IsDown = dec.IsDown
+		setItemErrors(&item, appErrs)
+		update(ctx)
+		return
+	}
+	item.Status = BatchPending
+	update(context.WithoutCancel(ctx))
+}
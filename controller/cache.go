@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+)
+
+// EvaluationsCache - Concurrency-safe cache for lists of domain evaluations.
+// Every list is stored under a key (for example, one key per combination of
+// filters of the list endpoint) and is kept during TTL.
+// When StaleWhileRevalidate is true, an expired list is still returned while
+// a single background refresh loads the new one.
+type EvaluationsCache struct {
+	TTL                  time.Duration
+	StaleWhileRevalidate bool
+
+	mu         sync.Mutex
+	entries    map[string]*cacheEntry
+	generation uint64
+	refreshes  sync.WaitGroup
+}
+
+// cacheEntry - Struct representing a list stored in the EvaluationsCache.
+type cacheEntry struct {
+	evaluations []dao.DomainEvaluation
+	fetchedAt   time.Time
+	refreshing  bool
+}
+
+// Default constructor for the EvaluationsCache struct.
+func NewEvaluationsCache(ttl time.Duration, staleWhileRevalidate bool) *EvaluationsCache {
+	return &EvaluationsCache{
+		TTL:                  ttl,
+		StaleWhileRevalidate: staleWhileRevalidate,
+		entries:              make(map[string]*cacheEntry),
+	}
+}
+
+// Get returns the list stored under key, calling load when there is no list
+// or the stored one is older than TTL at currentHour.
+func (c *EvaluationsCache) Get(ctx context.Context, key string, currentHour time.Time,
+	load func(context.Context) ([]dao.DomainEvaluation, error)) ([]dao.DomainEvaluation, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok && currentHour.Before(entry.fetchedAt.Add(c.TTL)) {
+		c.mu.Unlock()
+		return entry.evaluations, nil
+	}
+	if ok && c.StaleWhileRevalidate {
+		if !entry.refreshing {
+			entry.refreshing = true
+			generation := c.generation
+			c.refreshes.Add(1)
+			go c.refresh(context.WithoutCancel(ctx), key, currentHour, generation, load)
+		}
+		c.mu.Unlock()
+		return entry.evaluations, nil
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	evaluations, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.store(key, evaluations, currentHour, generation)
+	return evaluations, nil
+}
+
+// Invalidate drops every list in the cache. It must be called after writing
+// evaluations, so the next Get loads the lists again.
+func (c *EvaluationsCache) Invalidate() {
+	c.mu.Lock()
+	c.entries = make(map[string]*cacheEntry)
+	c.generation++
+	c.mu.Unlock()
+}
+
+// Wait blocks until the background refreshes in progress are done.
+func (c *EvaluationsCache) Wait() {
+	c.refreshes.Wait()
+}
+
+// refresh loads the list stored under key in background.
+func (c *EvaluationsCache) refresh(ctx context.Context, key string, currentHour time.Time, generation uint64,
+	load func(context.Context) ([]dao.DomainEvaluation, error)) {
+	defer c.refreshes.Done()
+	evaluations, err := load(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "background refresh of evaluations failed", "key", key, "error", err)
+		c.mu.Lock()
+		if entry, ok := c.entries[key]; ok {
+			entry.refreshing = false
+		}
+		c.mu.Unlock()
+		return
+	}
+	c.store(key, evaluations, currentHour, generation)
+}
+
+// store saves a loaded list, unless the cache was invalidated while the list
+// was being loaded, in which case the list may already be outdated.
+func (c *EvaluationsCache) store(key string, evaluations []dao.DomainEvaluation, currentHour time.Time, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	c.entries[key] = &cacheEntry{evaluations: evaluations, fetchedAt: currentHour}
+}
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/scrapers"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/validation"
+)
+
+// Method for approving an evaluation of a domain as its baseline (see
+// dao.ApprovedBaseline). Without evaluationId, the last ready evaluation is
+// approved; without minGrade, the grade of the evaluation is the minimum.
+// It fails with an E912 error when the evaluation doesn't exist or is of
+// another domain, and with an E905 error when it isn't ready, the domain was
+// down, or minGrade isn't a grade.
+func (s *Service) ApproveBaseline(ctx context.Context, domain string, evaluationId int, minGrade string,
+	now time.Time) (ab dao.ApprovedBaseline, appErr APIError) {
+	appErr = DefaultAPIError()
+	domain, err := validation.NormalizeDomain(domain)
+	if err != nil {
+		appErr = APIErrors.E901(err)
+		return
+	}
+	if minGrade != "" && scrapers.GradeRank(minGrade) < 0 {
+		appErr = APIErrors.E905(fmt.Errorf("unknown grade %q", minGrade))
+		return
+	}
+	var de dao.DomainEvaluation
+	err = s.query(ctx, func(ctx context.Context) (err error) {
+		de, err = s.findEvaluation(ctx, domain, evaluationId, now)
+		return
+	})
+	switch {
+	case err != nil:
+		appErr = APIErrors.E601(err)
+		return
+	case de.Id == 0:
+		appErr = APIErrors.E912(fmt.Errorf("evaluation %d of domain %q", evaluationId, domain))
+		return
+	case de.EvaluationInProgress || de.IsDown:
+		appErr = APIErrors.E905(errors.New("only the ready evaluations of domains that weren't down can be approved"))
+		return
+	}
+	if minGrade == "" {
+		minGrade = de.SslGrade
+	}
+	ab = dao.ApprovedBaseline{Domain: domain, EvaluationId: de.Id, MinGrade: minGrade, Servers: de.Servers,
+		ApprovedAt: now.UTC()}
+	err = s.write(ctx, func(ctx context.Context) error {
+		return s.Store.SetApprovedBaseline(ctx, ab)
+	})
+	if err != nil {
+		ab = dao.ApprovedBaseline{}
+		appErr = APIErrors.E601(err)
+	}
+	return
+}
+
+// Method for clearing the approved baseline of a domain, failing with an
+// E913 error when it had none.
+func (s *Service) ClearApprovedBaseline(ctx context.Context, domain string) APIError {
+	domain, err := validation.NormalizeDomain(domain)
+	if err != nil {
+		return APIErrors.E901(err)
+	}
+	var cleared bool
+	err = s.write(ctx, func(ctx context.Context) (err error) {
+		cleared, err = s.Store.ClearApprovedBaseline(ctx, domain)
+		return
+	})
+	if err != nil {
+		return APIErrors.E601(err)
+	}
+	if !cleared {
+		return APIErrors.E913(fmt.Errorf("domain %q", domain))
+	}
+	return DefaultAPIError()
+}
+
+// Method for reading the approved baseline of a domain, failing with an E913
+// error when it has none.
+func (s *Service) FindApprovedBaseline(ctx context.Context, domain string) (ab dao.ApprovedBaseline,
+	appErr APIError) {
+	appErr = DefaultAPIError()
+	domain, err := validation.NormalizeDomain(domain)
+	if err != nil {
+		appErr = APIErrors.E901(err)
+		return
+	}
+	err = s.query(ctx, func(ctx context.Context) (err error) {
+		ab, err = s.Store.FindApprovedBaseline(ctx, domain)
+		return
+	})
+	switch {
+	case err != nil:
+		appErr = APIErrors.E601(err)
+	case ab.Domain == "":
+		appErr = APIErrors.E913(fmt.Errorf("domain %q", domain))
+	}
+	return
+}
+
+// Function for getting the drift of an evaluation, given its grade and its
+// servers, from the approved baseline of its domain. The domains that were
+// down have no servers and no grade, so they always drift.
+// The grades T (no trust) and M (certificate name mismatch) of SSLabs rank
+// below F (see scrapers.GradeRank): they are below any other minimum grade,
+// and only meet a minimum of T or M.
+func DriftFrom(ab dao.ApprovedBaseline, grade string, servers []dao.Server) dao.Drift {
+	drift := dao.Drift{EvaluationId: ab.EvaluationId, MinGrade: ab.MinGrade,
+		GradeBelowMinimum:   scrapers.GradeRank(grade) < scrapers.GradeRank(ab.MinGrade),
+		UnexpectedAddresses: make([]string, 0), MissingAddresses: make([]string, 0),
+		Servers: make([]dao.ServerChange, 0)}
+	sd := dao.DiffServers(ab.Servers, servers)
+	for _, s := range sd.Added {
+		drift.UnexpectedAddresses = append(drift.UnexpectedAddresses, s.Address)
+	}
+	for _, s := range sd.Removed {
+		drift.MissingAddresses = append(drift.MissingAddresses, s.Address)
+	}
+	for _, sc := range sd.Modified {
+		// The grades of the servers are only checked through the grade of the domain.
+		sc.SslGrade = nil
+		if sc.Country != nil || sc.Owner != nil {
+			drift.Servers = append(drift.Servers, sc)
+		}
+	}
+	sort.Strings(drift.UnexpectedAddresses)
+	sort.Strings(drift.MissingAddresses)
+	drift.Drifted = drift.GradeBelowMinimum || len(drift.UnexpectedAddresses) > 0 ||
+		len(drift.MissingAddresses) > 0 || len(drift.Servers) > 0
+	return drift
+}
+
+// Auxiliar method for setting the drift of a ready evaluation of a domain from
+// its approved baseline, when it has one.
+func (s *Service) checkDrift(ctx context.Context, domain string, dec *dao.DomainEvaluationComplete) APIError {
+	var ab dao.ApprovedBaseline
+	servers := dec.Servers
+	err := s.query(ctx, func(ctx context.Context) (err error) {
+		if ab, err = s.Store.FindApprovedBaseline(ctx, domain); err != nil || ab.Domain == "" {
+			return
+		}
+		// The evaluations read again from the store come without their servers.
+		if dec.EvaluationId != 0 && !dec.IsDown {
+			servers, err = s.Store.ListServers(ctx, dec.EvaluationId)
+		}
+		return
+	})
+	if err != nil {
+		return APIErrors.E601(err)
+	}
+	if ab.Domain != "" {
+		drift := DriftFrom(ab, dec.SslGrade, servers)
+		dec.Drift = &drift
+	}
+	return DefaultAPIError()
+}
@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/scrapers"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/validation"
+)
+
+// Stages of an evaluation, as reported in its events.
+const (
+	// SSLabs is resolving the domain.
+	StageDNS = "dns"
+	// SSLabs is assessing the servers, the events have the progress of each one.
+	StageInProgress = "in_progress"
+	// The logo, the title and the WHOIS info of the servers are being scraped.
+	StageEnrichment = "enrichment"
+	// The evaluation is ready, the event has it.
+	StageReady = "ready"
+	// The evaluation failed, the event has the errors.
+	StageError = "error"
+)
+
+// Number of events kept for a subscriber that doesn't read them, the newer
+// ones are dropped until it catches up.
+const eventsBuffer = 32
+
+// EvaluationEvent - Struct representing a change in the evaluation of a domain.
+type EvaluationEvent struct {
+	Id         uint64                        `json:"id,omitempty"`
+	Domain     string                        `json:"domain"`
+	Stage      string                        `json:"stage"`
+	Time       time.Time                     `json:"time"`
+	Endpoints  []scrapers.EndpointProgress   `json:"endpoints,omitempty"`
+	Evaluation *dao.DomainEvaluationComplete `json:"evaluation,omitempty"`
+	Errors     []APIError                    `json:"errors,omitempty"`
+}
+
+// EventBroker - Concurrency-safe broker sending the events of the evaluations
+// to their subscribers, either of a single domain or of every domain.
+// The events are only kept in memory, so each replica of the API only sees
+// the evaluations it makes.
+type EventBroker struct {
+	mu          sync.Mutex
+	lastID      uint64
+	subscribers map[chan EvaluationEvent]string
+}
+
+// Default constructor for the EventBroker struct.
+func NewEventBroker() *EventBroker {
+	return &EventBroker{subscribers: make(map[chan EvaluationEvent]string)}
+}
+
+// Method for subscribing to the events of domain, or of every domain when it's
+// empty. cancel must be called once the events aren't needed anymore.
+func (b *EventBroker) Subscribe(domain string) (events <-chan EvaluationEvent, cancel func()) {
+	ch := make(chan EvaluationEvent, eventsBuffer)
+	b.mu.Lock()
+	b.subscribers[ch] = domain
+	b.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, ch)
+			b.mu.Unlock()
+		})
+	}
+}
+
+// Method for sending an event to its subscribers, it never blocks.
+func (b *EventBroker) Publish(ev EvaluationEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastID++
+	ev.Id = b.lastID
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	for ch, domain := range b.subscribers {
+		if domain != "" && domain != ev.Domain {
+			continue
+		}
+		select {
+		case ch <- ev:
+		default:
+			slog.Debug("dropping evaluation event of a slow subscriber", "domain", ev.Domain, "stage", ev.Stage)
+		}
+	}
+}
+
+// Auxiliar method for the progress reporter of the evaluator, publishing the
+// stage of the assessment of domain while SSLabs is working on it.
+func (s *Service) progressReporter(domain string) func(scrapers.SSLabsProgress) {
+	return func(p scrapers.SSLabsProgress) {
+		switch p.Status {
+		case "DNS":
+			s.Events.Publish(EvaluationEvent{Domain: domain, Stage: StageDNS, Endpoints: p.Endpoints})
+		case "IN_PROGRESS":
+			s.Events.Publish(EvaluationEvent{Domain: domain, Stage: StageInProgress, Endpoints: p.Endpoints})
+		}
+	}
+}
+
+// Auxiliar function for the event closing an evaluation: an error when the
+// evaluation failed, and otherwise its state (in progress or ready).
+func resultEvent(domain string, dec dao.DomainEvaluationComplete, appErrs []APIError) EvaluationEvent {
+	ev := EvaluationEvent{Domain: domain, Stage: StageReady, Evaluation: &dec, Errors: appErrs}
+	if HTTPStatus(appErrs, false) >= http.StatusBadRequest {
+		ev.Stage = StageError
+		ev.Evaluation = nil
+	} else if dec.EvaluationInProgress {
+		ev.Stage = StageInProgress
+	}
+	return ev
+}
+
+// Main method for following the evaluation of a domain until it's ready.
+// The domain is evaluated again every DomainEvaluationTW while SSLabs reports
+// it in progress, so the clients don't need to poll. Meanwhile, the progress
+// events of the domain (DNS, IN_PROGRESS and enrichment) are passed to emit,
+// with the ones of the other requests evaluating the same domain.
+// It ends after emitting the ready or error event, when emit fails or when
+// ctx is done. After StreamMaxPolls evaluations in progress, the error event
+// has an E603 error.
+func (s *Service) FollowEvaluation(ctx context.Context, domain string, emit func(EvaluationEvent) error) error {
+	domain, err := validation.NormalizeDomain(domain)
+	if err != nil {
+		return emit(EvaluationEvent{Domain: domain, Stage: StageError, Time: time.Now().UTC(),
+			Errors: []APIError{APIErrors.E901(err)}})
+	}
+	events, cancel := s.Events.Subscribe(domain)
+	defer cancel()
+
+	type result struct {
+		dec     dao.DomainEvaluationComplete
+		appErrs []APIError
+	}
+	results := make(chan result, 1)
+	evaluate := func() {
+		dec, appErrs := s.ScraperTestComplete(ctx, domain, time.Now())
+		results <- result{dec, appErrs}
+	}
+	go evaluate()
+	polls := 1
+	var retry <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev := <-events:
+			if err := emitProgress(ev, emit); err != nil {
+				return err
+			}
+		case r := <-results:
+			// The progress events published before the result go first.
+			if err := drainEvents(events, emit); err != nil {
+				return err
+			}
+			ev := resultEvent(domain, r.dec, r.appErrs)
+			ev.Time = time.Now().UTC()
+			if err := emit(ev); err != nil || ev.Stage != StageInProgress {
+				return err
+			}
+			if s.Config.StreamMaxPolls > 0 && polls >= s.Config.StreamMaxPolls {
+				return emit(EvaluationEvent{Domain: domain, Stage: StageError, Time: time.Now().UTC(),
+					Errors: []APIError{APIErrors.E603(fmt.Errorf("the evaluation wasn't ready after %d polls", polls))}})
+			}
+			retry = time.After(s.Config.DomainEvaluationTW)
+		case <-retry:
+			retry = nil
+			polls++
+			go evaluate()
+		}
+	}
+}
+
+// Auxiliar function for emitting a progress event of FollowEvaluation. The
+// results are emitted by FollowEvaluation itself, not the ones of the other
+// requests.
+func emitProgress(ev EvaluationEvent, emit func(EvaluationEvent) error) error {
+	if ev.Stage == StageReady || ev.Stage == StageError || ev.Evaluation != nil {
+		return nil
+	}
+	return emit(ev)
+}
+
+// Auxiliar function for emitting the progress events already waiting in events.
+func drainEvents(events <-chan EvaluationEvent, emit func(EvaluationEvent) error) error {
+	for {
+		select {
+		case ev := <-events:
+			if err := emitProgress(ev, emit); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
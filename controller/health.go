@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+)
+
+// HealthCheck - Struct representing the result of checking one dependency
+// of the service.
+type HealthCheck struct {
+	Name  string `json:"name"`
+	Ready bool   `json:"ready"`
+	Err   string `json:"error,omitempty"`
+}
+
+// Auxiliar function for building a HealthCheck from an error.
+func makeHealthCheck(name string, err error) HealthCheck {
+	if err != nil {
+		return HealthCheck{Name: name, Ready: false, Err: err.Error()}
+	}
+	return HealthCheck{Name: name, Ready: true}
+}
+
+// Readiness
+// Method for checking whether the service can evaluate domains.
+// It checks that the store answers, that its schema is the one expected by
+// this build and, when the scrapers know how, that the evaluator is available.
+func (s *Service) Readiness(ctx context.Context) (ready bool, checks []HealthCheck) {
+	err := s.query(ctx, s.Store.Ping)
+	checks = append(checks, makeHealthCheck("database", err))
+
+	var version int
+	err = s.query(ctx, func(ctx context.Context) (err error) {
+		version, err = s.Store.MigrationVersion(ctx)
+		return
+	})
+	if err == nil && version != dao.LatestMigrationVersion {
+		err = fmt.Errorf("schema version is %d, expected %d", version, dao.LatestMigrationVersion)
+	}
+	checks = append(checks, makeHealthCheck("migrations", err))
+
+	if s.Scrapers.EvaluatorInfo != nil {
+		checks = append(checks, makeHealthCheck("evaluator", s.checkEvaluator(ctx, time.Now())))
+	}
+
+	ready = true
+	for _, c := range checks {
+		ready = ready && c.Ready
+	}
+	return
+}
+
+// evaluatorCheck - Struct holding the last check of the availability of the
+// evaluator, so the readiness probes don't call it every time.
+type evaluatorCheck struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+// Auxiliar method for checking whether the evaluator is available. The result
+// is kept for EvaluatorCheckTTL, and every check has the deadline
+// EvaluatorCheckTimeout.
+func (s *Service) checkEvaluator(ctx context.Context, now time.Time) error {
+	c := &s.evaluatorCheck
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.checkedAt.IsZero() && now.Sub(c.checkedAt) < s.Config.EvaluatorCheckTTL {
+		return c.err
+	}
+	err := withTimeout(ctx, s.Config.EvaluatorCheckTimeout, func(ctx context.Context) error {
+		_, err := s.Scrapers.EvaluatorInfo(ctx)
+		return err
+	})
+	// The probes cancelled by their clients say nothing about the evaluator.
+	if ctx.Err() == nil {
+		c.checkedAt, c.err = now, err
+	}
+	return err
+}
+
+// Shutdown
+// Method for draining the service: it cancels the batches, whose domains left
+// are resumed on the next start, and the evaluation of the watched domains,
+// and waits for them, for the evaluations in flight and for the background
+// refreshes of the caches, or until ctx is done.
+func (s *Service) Shutdown(ctx context.Context) error {
+	s.jobs.stop()
+	done := make(chan struct{})
+	go func() {
+		s.jobs.wait()
+		s.evaluations.wait()
+		s.RecentEvaluations.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
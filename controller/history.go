@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/validation"
+)
+
+// GradeChange - Struct representing a change of the SSL grade of a domain
+// between two consecutive ready evaluations.
+type GradeChange struct {
+	Hour string `json:"hour"` // hour of the evaluation with the new grade
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Method for listing the evaluations of a domain, the newest first.
+// When limit is greater than zero, at most limit evaluations are listed.
+// Invalid domains are rejected with an E901 error.
+func (s *Service) DomainHistory(ctx context.Context, domain string, limit int) (history []dao.DomainEvaluation,
+	appErr APIError) {
+	history = make([]dao.DomainEvaluation, 0)
+	appErr = DefaultAPIError()
+	domain, err := validation.NormalizeDomain(domain)
+	if err != nil {
+		appErr = APIErrors.E901(err)
+		return
+	}
+	err = s.query(ctx, func(ctx context.Context) (err error) {
+		history, err = s.Store.ListDomainHistory(ctx, domain, limit)
+		return
+	})
+	if err != nil {
+		history = make([]dao.DomainEvaluation, 0)
+		appErr = APIErrors.E601(err)
+	}
+	return
+}
+
+// Method for listing the servers of several evaluations with a single query
+// to the store, grouped by the id of their evaluation.
+func (s *Service) ListServersByEvaluations(ctx context.Context, ids []int) (servers map[int][]dao.Server,
+	appErr APIError) {
+	appErr = DefaultAPIError()
+	err := s.query(ctx, func(ctx context.Context) (err error) {
+		servers, err = s.Store.ListServersByEvaluations(ctx, ids)
+		return
+	})
+	if err != nil {
+		servers = make(map[int][]dao.Server)
+		appErr = APIErrors.E601(err)
+	}
+	return
+}
+
+// Method for passing every stored evaluation that passes the filter to fn,
+// with its servers (see dao.Store.ExportEvaluations). The exports may be long,
+// so the database deadline doesn't apply, only the one of ctx. It fails with
+// an E601 error when the store or fn fail.
+func (s *Service) ExportEvaluations(ctx context.Context, filter dao.EvaluationFilter,
+	fn func(dao.DomainEvaluation) error) APIError {
+	if err := s.Store.ExportEvaluations(ctx, filter, fn); err != nil {
+		return APIErrors.E601(err)
+	}
+	return DefaultAPIError()
+}
+
+// Method for comparing two evaluations of a domain, given their ids (see
+// dao.DiffEvaluations). Without toId, the last ready evaluation done before
+// now is compared; without fromId, the last ready evaluation done before the
+// compared one. It fails with an E912 error when an evaluation doesn't exist
+// or is of another domain.
+func (s *Service) DiffEvaluations(ctx context.Context, domain string, fromId int, toId int,
+	now time.Time) (diff dao.EvaluationDiff, appErr APIError) {
+	appErr = DefaultAPIError()
+	domain, err := validation.NormalizeDomain(domain)
+	if err != nil {
+		appErr = APIErrors.E901(err)
+		return
+	}
+	var from, to dao.DomainEvaluation
+	err = s.query(ctx, func(ctx context.Context) (err error) {
+		if to, err = s.findEvaluation(ctx, domain, toId, now); err != nil || to.Id == 0 {
+			return
+		}
+		upperBound, err := time.Parse(time.RFC3339, to.EvaluationHour)
+		if err != nil {
+			return
+		}
+		from, err = s.findEvaluation(ctx, domain, fromId, upperBound)
+		return
+	})
+	switch {
+	case err != nil:
+		appErr = APIErrors.E601(err)
+	case to.Id == 0:
+		appErr = APIErrors.E912(fmt.Errorf("evaluation %d of domain %q", toId, domain))
+	case from.Id == 0:
+		appErr = APIErrors.E912(fmt.Errorf("evaluation %d of domain %q", fromId, domain))
+	default:
+		diff = dao.DiffEvaluations(from, to)
+	}
+	return
+}
+
+// Auxiliar method for reading the evaluation of a domain with the given id,
+// or without id, the last ready evaluation done before upperBound. The Id of
+// the evaluation is 0 when there is none.
+func (s *Service) findEvaluation(ctx context.Context, domain string, id int,
+	upperBound time.Time) (de dao.DomainEvaluation, err error) {
+	if id == 0 {
+		if de, err = s.Store.SearchLastEvaluation(ctx, domain, false, upperBound); err != nil || de.Id == 0 {
+			return
+		}
+		id = de.Id
+	}
+	if de, err = s.Store.FindEvaluation(ctx, id); err != nil || de.Domain != domain {
+		return dao.DomainEvaluation{}, err
+	}
+	return
+}
+
+// Function for getting the changes of the SSL grade in the history of a domain
+// (as returned by DomainHistory, the newest first). The evaluations in progress
+// and the ones of a domain that was down have no grade, so they are skipped.
+// The changes are returned the newest first.
+func GradeChanges(history []dao.DomainEvaluation) []GradeChange {
+	changes := make([]GradeChange, 0)
+	var newer *dao.DomainEvaluation
+	for i := range history {
+		de := &history[i]
+		if de.EvaluationInProgress || de.IsDown {
+			continue
+		}
+		if newer != nil && newer.SslGrade != de.SslGrade {
+			changes = append(changes, GradeChange{Hour: newer.EvaluationHour, From: de.SslGrade, To: newer.SslGrade})
+		}
+		newer = de
+	}
+	return changes
+}
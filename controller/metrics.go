@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/metrics"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Outcomes of a domain evaluation, used as labels of metrics.Evaluations.
+const (
+	OutcomeCached     = "cached"      // a recent evaluation was returned from the store
+	OutcomeInProgress = "in_progress" // SSLabs is still evaluating the domain
+	OutcomeFresh      = "fresh"       // a new evaluation was stored
+	OutcomeDown       = "down"        // the domain couldn't be reached by SSLabs
+	OutcomeError      = "error"       // the evaluation failed, see the APIError code
+)
+
+// Auxiliar function for counting, logging and tracing the outcome of an evaluation
+// returned by EvaluateDomainTW.
+func observeEvaluation(ctx context.Context, domainName string, de dao.DomainEvaluation, changed bool, appErr APIError) {
+	outcome, code := OutcomeCached, ""
+	switch {
+	case appErr.Code != DefaultAPIError().Code:
+		outcome, code = OutcomeError, appErr.Code
+	case de.EvaluationInProgress:
+		outcome = OutcomeInProgress
+	case de.IsDown:
+		outcome = OutcomeDown
+	case changed:
+		outcome = OutcomeFresh
+	}
+	metrics.Evaluations.WithLabelValues(outcome, code).Inc()
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.String("evaluation.outcome", outcome))
+	if outcome == OutcomeError {
+		span.SetStatus(codes.Error, appErr.Err)
+		slog.WarnContext(ctx, "domain evaluation failed", "domain", domainName, "code", appErr.Code,
+			"error", appErr.Err)
+		return
+	}
+	slog.InfoContext(ctx, "domain evaluated", "domain", domainName, "outcome", outcome, "grade", de.SslGrade)
+}
+
+// Auxiliar function for starting the span of a decision branch of
+// EvaluateDomainTW. The branch is also recorded in the span of the evaluation.
+func startBranch(ctx context.Context, branch string, name string) (context.Context, trace.Span) {
+	attr := attribute.String("evaluation.branch", branch)
+	trace.SpanFromContext(ctx).SetAttributes(attr)
+	return tracing.Start(ctx, "EvaluateDomainTW."+name, attr)
+}
+
+// Auxiliar function for updating the number of domains by grade from the list
+// of recent evaluations, which holds the last evaluation of every domain.
+func observeGrades(evaluations []dao.DomainEvaluation) {
+	domainsByGrade := make(map[string]int)
+	for _, de := range evaluations {
+		grade := de.SslGrade
+		switch {
+		case de.EvaluationInProgress:
+			grade = OutcomeInProgress
+		case de.IsDown:
+			grade = OutcomeDown
+		case grade == "":
+			grade = "none"
+		}
+		domainsByGrade[grade]++
+	}
+	metrics.SetDomainsByGrade(domainsByGrade)
+}
@@ -0,0 +1,223 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/ratelimit"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/scrapers"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// StageTimeouts - Struct holding the deadline applied to each stage of an evaluation.
+// A zero duration means the stage only ends when the parent context does.
+type StageTimeouts struct {
+	Database  time.Duration // each query or transaction against the store
+	Evaluator time.Duration // each call to the evaluator (SSLabs)
+	Scraper   time.Duration // each call to the logo, title and WHOIS scrapers
+}
+
+// Config - Struct holding the settings of a Service.
+type Config struct {
+	// Time to wait between different domain evaluations.
+	DomainEvaluationTW time.Duration
+	// Time to wait for getting the list of recent evaluations again.
+	RecentEvaluationsTW time.Duration
+	// Whether an expired list of recent evaluations is returned while it's refreshed.
+	StaleWhileRevalidate bool
+	// Deadlines used for the different stages of an evaluation.
+	Timeouts StageTimeouts
+	// Time an evaluation lock is kept in the store before another API replica
+	// is allowed to take it over.
+	EvaluationLockTTL time.Duration
+	// Time to wait between attempts of taking the evaluation lock of a domain
+	// that is being evaluated by another API replica.
+	EvaluationLockPoll time.Duration
+	// Time the availability of the evaluator is cached by the readiness
+	// probes, and deadline of each check of it.
+	EvaluatorCheckTTL     time.Duration
+	EvaluatorCheckTimeout time.Duration
+	// Requests per minute and evaluations per day of the API keys created
+	// without their own limits.
+	APIKeyRateLimit  int
+	APIKeyDailyQuota int
+	// New evaluations started per minute by each client and by every client
+	// together. Zero means no limit.
+	ClientEvaluationLimit int
+	GlobalEvaluationLimit int
+	// Domains evaluated at the same time in the background (the ones of the
+	// batches and the watched ones), and domains accepted in a single batch.
+	BatchConcurrency int
+	MaxBatchSize     int
+	// Time a domain of a batch is waited for, while SSLabs works on it or the
+	// limits of new evaluations are reached, before failing it. Zero means no limit.
+	BatchItemTimeout time.Duration
+	// Evaluation the new evaluations are compared with for servers_changed and
+	// previous_ssl_grade, when the requests don't choose another one.
+	Baseline dao.Baseline
+	// Secret signing the stream tokens and their lifetime. Without a secret,
+	// every service signs with a random one, so its tokens only work on it.
+	StreamTokenSecret string
+	StreamTokenTTL    time.Duration
+	// Evaluations of a domain done by an event stream while SSLabs reports it
+	// in progress, before the stream ends with an error. Zero means no limit.
+	StreamMaxPolls int
+}
+
+// Default constructor for the Config struct.
+func DefaultConfig() Config {
+	return Config{
+		DomainEvaluationTW:  time.Second * 20,
+		RecentEvaluationsTW: time.Second * 20,
+		Timeouts: StageTimeouts{
+			Database:  time.Second * 5,
+			Evaluator: time.Second * 30,
+			Scraper:   time.Second * 10,
+		},
+		EvaluationLockTTL:     time.Minute * 2,
+		EvaluationLockPoll:    time.Millisecond * 500,
+		EvaluatorCheckTTL:     time.Second * 30,
+		EvaluatorCheckTimeout: time.Second * 3,
+		APIKeyRateLimit:       60,
+		APIKeyDailyQuota:      100,
+		ClientEvaluationLimit: 10,
+		GlobalEvaluationLimit: 30,
+		BatchConcurrency:      4,
+		MaxBatchSize:          500,
+		BatchItemTimeout:      time.Minute * 30,
+		Baseline:              dao.DefaultBaseline(),
+		StreamTokenTTL:        time.Minute,
+		StreamMaxPolls:        90,
+	}
+}
+
+// Evaluator - Function type used for getting a fresh domain evaluation.
+// Normally, the evaluator is a scraper like scrapers.ScraperSSLabs.
+type Evaluator func(context.Context, time.Time, string) (dao.DomainEvaluation, error)
+
+// Scrapers - Struct holding the functions used for getting the info about a domain.
+// EvaluatorInfo is optional, it's used for knowing if the evaluator is available.
+type Scrapers struct {
+	Evaluator     Evaluator
+	EvaluatorInfo func(context.Context) (scrapers.SSLabsInfo, error)
+	Logo          func(context.Context, string) (string, error)
+	Title         func(context.Context, string) (string, error)
+	Country       func(context.Context, string) (string, error)
+	Owner         func(context.Context, string) (string, error)
+}
+
+// Default constructor for the Scrapers struct, using the scrapers package.
+func DefaultScrapers() Scrapers {
+	return Scrapers{
+		Evaluator:     scrapers.ScraperSSLabs,
+		EvaluatorInfo: scrapers.ScraperSSLabsInfo,
+		Logo:          scrapers.ScraperLogo,
+		Title:         scrapers.ScraperTitle,
+		Country:       scrapers.ScraperCountry,
+		Owner:         scrapers.ScraperOwner,
+	}
+}
+
+// Service - Struct owning everything needed for evaluating domains: the store,
+// the scrapers, the cache of recent evaluations and the settings.
+// Several services can live in the same process, each one with its own store.
+type Service struct {
+	Store             dao.Store
+	Scrapers          Scrapers
+	Config            Config
+	RecentEvaluations *EvaluationsCache
+	// Limiter of the requests of the API keys.
+	Limiter ratelimit.Limiter
+	// Broker of the events of the evaluations.
+	Events *EventBroker
+
+	// Identifies this service as the owner of evaluation locks.
+	instanceID string
+	// Secret signing the stream tokens.
+	streamTokenSecret []byte
+	// Coalesces the concurrent evaluations of the same domain.
+	evaluations *flightGroup
+	// Slots of the domains evaluated in the background, the ones of the
+	// batches and the watched ones.
+	batchSlots chan struct{}
+	// Jobs outliving the requests, cancelled and waited for by Shutdown.
+	jobs *backgroundJobs
+	// Last check of the availability of the evaluator.
+	evaluatorCheck evaluatorCheck
+}
+
+// Default constructor for the Service struct.
+func NewService(store dao.Store, scrapers Scrapers, config Config) *Service {
+	return &Service{
+		Store:             store,
+		Scrapers:          scrapers,
+		Config:            config,
+		RecentEvaluations: NewEvaluationsCache(config.RecentEvaluationsTW, config.StaleWhileRevalidate),
+		Limiter:           ratelimit.NewMemoryLimiter(),
+		Events:            NewEventBroker(),
+		instanceID:        newInstanceID(),
+		streamTokenSecret: newStreamTokenSecret(config.StreamTokenSecret),
+		evaluations:       newFlightGroup(),
+		batchSlots:        make(chan struct{}, max(config.BatchConcurrency, 1)),
+		jobs:              newBackgroundJobs(),
+	}
+}
+
+// Auxiliar function for the instanceID of a Service.
+func newInstanceID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Auxiliar function for the secret of the stream tokens of a Service, a
+// random one when the settings have none.
+func newStreamTokenSecret(secret string) []byte {
+	if secret != "" {
+		return []byte(secret)
+	}
+	b := make([]byte, 32)
+	rand.Read(b)
+	return b
+}
+
+// Auxiliar function for running a stage of an evaluation with its own deadline.
+// The stage is cancelled when either the timeout expires or the parent context
+// is done (for example, because the http client disconnected).
+func withTimeout(ctx context.Context, timeout time.Duration, stage func(context.Context) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return stage(ctx)
+}
+
+// Auxiliar method for calling a scraper under the scraper deadline, inside
+// its own span. target is the domain or the server IP being scraped.
+func (s *Service) scrape(ctx context.Context, scraper string, target attribute.KeyValue,
+	fn func(context.Context) error) (err error) {
+	ctx, span := tracing.Start(ctx, "scraper."+scraper, target)
+	defer tracing.End(span, &err)
+	return withTimeout(ctx, s.Config.Timeouts.Scraper, fn)
+}
+
+// Auxiliar method for running a query against the store under the database deadline.
+func (s *Service) query(ctx context.Context, fn func(context.Context) error) error {
+	return withTimeout(ctx, s.Config.Timeouts.Database, fn)
+}
+
+// Auxiliar method for writing evaluations in the store under the database
+// deadline. The store rolls back writes cancelled halfway, and the cached
+// lists of evaluations are invalidated after every successful write.
+func (s *Service) write(ctx context.Context, fn func(context.Context) error) error {
+	err := withTimeout(ctx, s.Config.Timeouts.Database, fn)
+	if err == nil {
+		s.RecentEvaluations.Invalidate()
+	}
+	return err
+}
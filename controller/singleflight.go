@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	"sync"
+
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+)
+
+// flightCall - Struct representing an evaluation in flight for a domain.
+// Every caller asking for the same domain while the call is running waits for
+// it and receives the same result.
+type flightCall struct {
+	done    chan struct{}
+	waiters int
+	cancel  context.CancelFunc
+	dec     dao.DomainEvaluationComplete
+	appErrs []APIError
+}
+
+// flightGroup - Struct for coalescing concurrent evaluations of the same domain
+// inside the process.
+type flightGroup struct {
+	mu      sync.Mutex
+	calls   map[string]*flightCall
+	running sync.WaitGroup
+}
+
+// Default constructor for the flightGroup struct.
+func newFlightGroup() *flightGroup {
+	return &flightGroup{calls: make(map[string]*flightCall)}
+}
+
+// do runs fn once per key. Callers arriving while fn is running for the same
+// key wait for it and share its result.
+// The context given to fn isn't tied to any single caller: it's cancelled only
+// when every waiting caller is gone, so a client disconnecting doesn't abort
+// the evaluation for the others.
+func (g *flightGroup) do(ctx context.Context, key string,
+	fn func(context.Context) (dao.DomainEvaluationComplete, []APIError)) (dao.DomainEvaluationComplete, []APIError, error) {
+	g.mu.Lock()
+	c, ok := g.calls[key]
+	if !ok {
+		flightCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		c = &flightCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = c
+		g.running.Add(1)
+		go func() {
+			defer g.running.Done()
+			defer cancel()
+			c.dec, c.appErrs = fn(flightCtx)
+			g.mu.Lock()
+			g.forget(key, c)
+			g.mu.Unlock()
+			close(c.done)
+		}()
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.dec, c.appErrs, nil
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			// The cancelled call is forgotten at once, so the callers arriving
+			// before fn returns start a new call instead of joining a dead one.
+			c.cancel()
+			g.forget(key, c)
+		}
+		g.mu.Unlock()
+		return dao.DomainEvaluationComplete{}, nil, ctx.Err()
+	}
+}
+
+// forget removes the call of key from the calls in flight, unless a newer
+// call replaced it. It must be called with mu held.
+func (g *flightGroup) forget(key string, c *flightCall) {
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+}
+
+// wait blocks until every call in flight is done.
+func (g *flightGroup) wait() {
+	g.running.Wait()
+}
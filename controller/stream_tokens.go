@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/ratelimit"
+)
+
+// StreamToken - Struct representing a short-lived token authorizing the
+// event streams of an API key. The browsers can't send the X-API-Key header
+// in the event streams, and unlike the keys, the tokens can be sent in their
+// URLs: they expire after Config.StreamTokenTTL.
+type StreamToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Method for issuing a stream token for the API key of the request (see
+// WithAPIKey), failing with an E902 error when the request has none.
+func (s *Service) IssueStreamToken(ctx context.Context, now time.Time) (StreamToken, APIError) {
+	key := APIKeyFromContext(ctx)
+	if key.Id == 0 {
+		return StreamToken{}, APIErrors.E902(errors.New("the stream tokens are issued to the API keys"))
+	}
+	expiresAt := now.Add(s.Config.StreamTokenTTL).UTC().Truncate(time.Second)
+	// The token carries the id of the key, not its hash, since it ends in URLs.
+	payload := strconv.Itoa(key.Id) + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+	return StreamToken{Token: payload + "." + s.signStreamToken(payload), ExpiresAt: expiresAt},
+		DefaultAPIError()
+}
+
+// Main method for authorizing an event stream with a stream token, like
+// AuthorizeAPIKey does with the API key the token was issued to. The tokens
+// with a wrong signature or expired are rejected with an E902 error.
+func (s *Service) AuthorizeStreamToken(ctx context.Context, token string, evaluation bool,
+	now time.Time) (key dao.APIKey, decision ratelimit.Decision, appErr APIError) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || !hmac.Equal([]byte(parts[2]), []byte(s.signStreamToken(parts[0]+"."+parts[1]))) {
+		appErr = APIErrors.E902(errors.New("the stream token is invalid"))
+		return
+	}
+	expiresAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || now.Unix() > expiresAt {
+		appErr = APIErrors.E902(errors.New("the stream token expired"))
+		return
+	}
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		appErr = APIErrors.E902(errors.New("the stream token is invalid"))
+		return
+	}
+	return s.authorizeKey(ctx, func(ctx context.Context) (dao.APIKey, error) {
+		return s.Store.FindAPIKeyById(ctx, id)
+	}, evaluation, now)
+}
+
+// Auxiliar method for signing the payload of a stream token.
+func (s *Service) signStreamToken(payload string) string {
+	mac := hmac.New(sha256.New, s.streamTokenSecret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/validation"
+)
+
+// Method for adding a domain to the watched ones, which are evaluated every
+// interval by EvaluateWatchedDomains. Invalid domains are rejected with an
+// E901 error.
+func (s *Service) WatchDomain(ctx context.Context, domain string, now time.Time) APIError {
+	domain, err := validation.NormalizeDomain(domain)
+	if err != nil {
+		return APIErrors.E901(err)
+	}
+	err = s.query(ctx, func(ctx context.Context) error {
+		return s.Store.AddWatchedDomain(ctx, dao.WatchedDomain{Domain: domain, AddedAt: now.UTC()})
+	})
+	if err != nil {
+		return APIErrors.E601(err)
+	}
+	return DefaultAPIError()
+}
+
+// Method for removing a domain from the watched ones, failing with an E911
+// error when it wasn't watched.
+func (s *Service) UnwatchDomain(ctx context.Context, domain string) APIError {
+	domain, err := validation.NormalizeDomain(domain)
+	if err != nil {
+		return APIErrors.E901(err)
+	}
+	var removed bool
+	err = s.query(ctx, func(ctx context.Context) (err error) {
+		removed, err = s.Store.RemoveWatchedDomain(ctx, domain)
+		return
+	})
+	if err != nil {
+		return APIErrors.E601(err)
+	}
+	if !removed {
+		return APIErrors.E911(fmt.Errorf("domain %q", domain))
+	}
+	return DefaultAPIError()
+}
+
+// Method for listing the watched domains by name.
+func (s *Service) ListWatchedDomains(ctx context.Context) (watched []dao.WatchedDomain, appErr APIError) {
+	appErr = DefaultAPIError()
+	err := s.query(ctx, func(ctx context.Context) (err error) {
+		watched, err = s.Store.ListWatchedDomains(ctx)
+		return
+	})
+	if err != nil {
+		watched = make([]dao.WatchedDomain, 0)
+		appErr = APIErrors.E601(err)
+	}
+	return
+}
+
+// Main method for evaluating the watched domains every interval, until ctx
+// is done or the service is shut down. The domains share the slots of the
+// batches (see Config.BatchConcurrency), and a round only starts once the
+// previous one ends.
+func (s *Service) EvaluateWatchedDomains(ctx context.Context, interval time.Duration) {
+	ctx, done, ok := s.jobs.start(ctx)
+	if !ok {
+		return
+	}
+	defer done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		watched, appErr := s.ListWatchedDomains(ctx)
+		if appErr.Code != DefaultAPIError().Code {
+			slog.ErrorContext(ctx, "listing watched domains", "error", appErr.Err)
+			continue
+		}
+		for _, wd := range watched {
+			// The select below picks at random when ctx is already done.
+			if ctx.Err() != nil {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case s.batchSlots <- struct{}{}:
+			}
+			wg.Add(1)
+			go func(domain string) {
+				defer wg.Done()
+				defer func() { <-s.batchSlots }()
+				_, appErrs := s.ScraperTestComplete(ctx, domain, time.Now())
+				for _, appErr := range appErrs {
+					slog.WarnContext(ctx, "evaluating watched domain", "domain", domain, "code", appErr.Code,
+						"error", appErr.Err)
+				}
+			}(wd.Domain)
+		}
+		wg.Wait()
+	}
+}
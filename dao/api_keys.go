@@ -0,0 +1,217 @@
+package dao
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// APIKey - Struct for the representation of the API keys of the clients.
+// Only the hash of the key is stored, the key itself is shown once, when
+// it's created.
+type APIKey struct {
+	Id         int        `json:"id"`          // SERIAL PRIMARY KEY
+	Name       string     `json:"name"`        // VARCHAR[100]
+	Prefix     string     `json:"prefix"`      // VARCHAR[12]
+	KeyHash    string     `json:"-"`           // VARCHAR[64]
+	RateLimit  int        `json:"rate_limit"`  // requests per minute
+	DailyQuota int        `json:"daily_quota"` // evaluations per day
+	CreatedAt  time.Time  `json:"created_at"`  // TIMESTAMPTZ
+	RevokedAt  *time.Time `json:"revoked_at"`  // TIMESTAMPTZ
+}
+
+// APIKeyUsage - Struct for the representation of the usage of an API key
+// during a day (in UTC).
+type APIKeyUsage struct {
+	KeyId       int    `json:"key_id"`
+	Day         string `json:"day"` // VARCHAR[10], 2006-01-02
+	Requests    int    `json:"requests"`
+	Evaluations int    `json:"evaluations"`
+}
+
+// Error returned when revoking an API key that doesn't exist.
+var ErrAPIKeyNotFound = errors.New("API key not found.")
+
+// KeyStore interface: Declaration of the operations over the API keys and
+// their usage.
+type KeyStore interface {
+	// CreateAPIKey stores the key, setting its id.
+	CreateAPIKey(ctx context.Context, key *APIKey) error
+	// FindAPIKey returns the key with the given hash. The Id is 0 when there is none.
+	FindAPIKey(ctx context.Context, keyHash string) (APIKey, error)
+	// FindAPIKeyById returns the key with the given id. The Id is 0 when there is none.
+	FindAPIKeyById(ctx context.Context, id int) (APIKey, error)
+	// ListAPIKeys lists every key, including the revoked ones.
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+	// RevokeAPIKey marks the key as revoked. It returns ErrAPIKeyNotFound when
+	// the key doesn't exist.
+	RevokeAPIKey(ctx context.Context, id int, revokedAt time.Time) error
+	// CountRequest adds a request to the usage of the key during day.
+	CountRequest(ctx context.Context, keyId int, day string) error
+	// ConsumeEvaluation adds an evaluation to the usage of the key during day,
+	// unless the key already did quota evaluations that day, in which case it
+	// returns false.
+	ConsumeEvaluation(ctx context.Context, keyId int, day string, quota int) (bool, error)
+	// ListAPIKeyUsage lists the usage of the key by day.
+	ListAPIKeyUsage(ctx context.Context, keyId int) ([]APIKeyUsage, error)
+}
+
+// Function for getting the hash stored for an API key.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Auxiliar function for scanning an API key.
+func scanAPIKey(scan func(dest ...interface{}) error, key *APIKey) error {
+	var revokedAt sql.NullTime
+	err := scan(&key.Id, &key.Name, &key.Prefix, &key.KeyHash, &key.RateLimit, &key.DailyQuota,
+		&key.CreatedAt, &revokedAt)
+	if err == nil && revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return err
+}
+
+// CreateAPIKey
+// Function for storing a new API key.
+func CreateAPIKey(ctx context.Context, key *APIKey, dbc interface{}) error {
+	sqlStatement := `INSERT INTO apiKey (name, prefix, keyHash, rateLimit, dailyQuota, createdAt)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id;`
+	row, err := QueryRow(ctx, dbc, sqlStatement, key.Name, key.Prefix, key.KeyHash, key.RateLimit,
+		key.DailyQuota, key.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return row.Scan(&key.Id)
+}
+
+// FindAPIKey
+// Function for searching an API key by its hash.
+func FindAPIKey(ctx context.Context, keyHash string, dbc interface{}) (key APIKey, err error) {
+	sqlStatement := `SELECT id, name, prefix, keyHash, rateLimit, dailyQuota, createdAt, revokedAt
+		FROM apiKey WHERE keyHash = $1;`
+	row, err := QueryRow(ctx, dbc, sqlStatement, keyHash)
+	if err != nil {
+		return
+	}
+	err = scanAPIKey(row.Scan, &key)
+	if err == sql.ErrNoRows {
+		return APIKey{}, nil
+	}
+	return
+}
+
+// FindAPIKeyById
+// Function for searching an API key by its id.
+func FindAPIKeyById(ctx context.Context, id int, dbc interface{}) (key APIKey, err error) {
+	sqlStatement := `SELECT id, name, prefix, keyHash, rateLimit, dailyQuota, createdAt, revokedAt
+		FROM apiKey WHERE id = $1;`
+	row, err := QueryRow(ctx, dbc, sqlStatement, id)
+	if err != nil {
+		return
+	}
+	err = scanAPIKey(row.Scan, &key)
+	if err == sql.ErrNoRows {
+		return APIKey{}, nil
+	}
+	return
+}
+
+// ListAPIKeys
+// Function for listing every API key.
+func ListAPIKeys(ctx context.Context, dbc interface{}) ([]APIKey, error) {
+	keys := make([]APIKey, 0)
+	sqlStatement := `SELECT id, name, prefix, keyHash, rateLimit, dailyQuota, createdAt, revokedAt
+		FROM apiKey ORDER BY id;`
+	rows, err := Query(ctx, dbc, sqlStatement)
+	if err != nil {
+		return keys, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key APIKey
+		if err = scanAPIKey(rows.Scan, &key); err != nil {
+			return keys, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey
+// Function for revoking an API key. Revoking a revoked key keeps the first date.
+func RevokeAPIKey(ctx context.Context, id int, revokedAt time.Time, dbc interface{}) error {
+	sqlStatement := `UPDATE apiKey SET revokedAt = COALESCE(revokedAt, $2) WHERE id = $1;`
+	r, err := Exec(ctx, dbc, sqlStatement, id, revokedAt)
+	if err != nil {
+		return err
+	}
+	if n, err := r.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// CountRequest
+// Function for adding a request to the usage of an API key.
+func CountRequest(ctx context.Context, keyId int, day string, dbc interface{}) error {
+	sqlStatement := `INSERT INTO apiKeyUsage (keyId, day, requests, evaluations) VALUES ($1, $2, 1, 0)
+		ON CONFLICT (keyId, day) DO UPDATE SET requests = apiKeyUsage.requests + 1;`
+	_, err := Exec(ctx, dbc, sqlStatement, keyId, day)
+	return err
+}
+
+// ConsumeEvaluation
+// Function for adding an evaluation to the usage of an API key, as long as
+// the quota allows it. The check and the increment are a single statement,
+// so concurrent requests can't go over the quota.
+func ConsumeEvaluation(ctx context.Context, keyId int, day string, quota int, dbc interface{}) (bool, error) {
+	if quota <= 0 {
+		return false, nil
+	}
+	sqlStatement := `INSERT INTO apiKeyUsage (keyId, day, requests, evaluations) VALUES ($1, $2, 0, 1)
+		ON CONFLICT (keyId, day) DO UPDATE SET evaluations = apiKeyUsage.evaluations + 1
+		WHERE apiKeyUsage.evaluations < $3
+		RETURNING evaluations;`
+	row, err := QueryRow(ctx, dbc, sqlStatement, keyId, day, quota)
+	if err != nil {
+		return false, err
+	}
+	var evaluations int
+	err = row.Scan(&evaluations)
+	switch err {
+	case sql.ErrNoRows:
+		return false, nil
+	case nil:
+		return true, nil
+	default:
+		return false, err
+	}
+}
+
+// ListAPIKeyUsage
+// Function for listing the usage of an API key by day, the most recent first.
+func ListAPIKeyUsage(ctx context.Context, keyId int, dbc interface{}) ([]APIKeyUsage, error) {
+	usage := make([]APIKeyUsage, 0)
+	sqlStatement := `SELECT keyId, day, requests, evaluations FROM apiKeyUsage
+		WHERE keyId = $1 ORDER BY day DESC;`
+	rows, err := Query(ctx, dbc, sqlStatement, keyId)
+	if err != nil {
+		return usage, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var u APIKeyUsage
+		if err = rows.Scan(&u.KeyId, &u.Day, &u.Requests, &u.Evaluations); err != nil {
+			return usage, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
@@ -0,0 +1,95 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// ApprovedBaseline - Struct for the representation of the approved
+// configuration of a domain, taken from one of its evaluations: the expected
+// servers, with their country and owner, and the minimum SSL grade. The new
+// evaluations of the domain report their drift from it.
+type ApprovedBaseline struct {
+	Domain       string    `json:"domain"`        // VARCHAR[100] PRIMARY KEY
+	EvaluationId int       `json:"evaluation_id"` // integer
+	MinGrade     string    `json:"min_grade"`     // VARCHAR[5]
+	Servers      []Server  `json:"servers"`       // TEXT, the servers encoded in json
+	ApprovedAt   time.Time `json:"approved_at"`   // TIMESTAMPTZ
+}
+
+// Drift - Struct representing the differences between an evaluation and the
+// approved baseline of its domain. The servers are matched by address, and
+// only their country and owner are compared, the grades are checked against
+// MinGrade.
+type Drift struct {
+	Drifted bool `json:"drifted"`
+	// Id of the evaluation approved as baseline.
+	EvaluationId        int            `json:"baseline_evaluation_id"`
+	MinGrade            string         `json:"min_grade"`
+	GradeBelowMinimum   bool           `json:"grade_below_minimum"`
+	UnexpectedAddresses []string       `json:"unexpected_addresses"`
+	MissingAddresses    []string       `json:"missing_addresses"`
+	Servers             []ServerChange `json:"servers"`
+}
+
+// ApprovedBaselineStore interface: Declaration of the operations over the
+// approved baselines of the domains.
+type ApprovedBaselineStore interface {
+	// SetApprovedBaseline sets the approved baseline of its domain, replacing
+	// the previous one.
+	SetApprovedBaseline(ctx context.Context, ab ApprovedBaseline) error
+	// ClearApprovedBaseline removes the approved baseline of the domain, it
+	// returns false when the domain had none.
+	ClearApprovedBaseline(ctx context.Context, domain string) (bool, error)
+	// FindApprovedBaseline returns the approved baseline of the domain. The
+	// Domain is empty when there is none.
+	FindApprovedBaseline(ctx context.Context, domain string) (ApprovedBaseline, error)
+}
+
+// SetApprovedBaseline
+// Function for setting the approved baseline of a domain.
+func SetApprovedBaseline(ctx context.Context, ab ApprovedBaseline, dbc interface{}) error {
+	servers, err := json.Marshal(ab.Servers)
+	if err != nil {
+		return err
+	}
+	sqlStatement := `INSERT INTO approvedBaseline (domain, evaluationId, minGrade, servers, approvedAt)
+		VALUES ($1, $2, $3, $4, $5) ON CONFLICT (domain) DO UPDATE SET evaluationId = excluded.evaluationId,
+		minGrade = excluded.minGrade, servers = excluded.servers, approvedAt = excluded.approvedAt;`
+	_, err = Exec(ctx, dbc, sqlStatement, ab.Domain, ab.EvaluationId, ab.MinGrade, string(servers), ab.ApprovedAt)
+	return err
+}
+
+// ClearApprovedBaseline
+// Function for removing the approved baseline of a domain.
+func ClearApprovedBaseline(ctx context.Context, domain string, dbc interface{}) (bool, error) {
+	res, err := Exec(ctx, dbc, `DELETE FROM approvedBaseline WHERE domain = $1;`, domain)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// FindApprovedBaseline
+// Function for reading the approved baseline of a domain.
+func FindApprovedBaseline(ctx context.Context, domain string, dbc interface{}) (ab ApprovedBaseline, err error) {
+	sqlStatement := `SELECT domain, evaluationId, minGrade, servers, approvedAt FROM approvedBaseline
+		WHERE domain = $1;`
+	row, err := QueryRow(ctx, dbc, sqlStatement, domain)
+	if err != nil {
+		return
+	}
+	var servers string
+	err = row.Scan(&ab.Domain, &ab.EvaluationId, &ab.MinGrade, &servers, &ab.ApprovedAt)
+	if err == sql.ErrNoRows {
+		return ApprovedBaseline{}, nil
+	}
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal([]byte(servers), &ab.Servers)
+	return
+}
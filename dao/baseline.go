@@ -0,0 +1,105 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Modes of the baselines the evaluations are compared with.
+const (
+	// The last ready evaluation done before the compared one, whatever its age.
+	BaselinePrevious = "previous"
+	// The last ready evaluation done at least Hours before the compared one.
+	BaselineHoursAgo = "hours"
+	// The last ready evaluation done before the same time of the day before,
+	// in the fixed offset of the hour of the compared one.
+	BaselineYesterday = "yesterday"
+	// The evaluation with the id EvaluationId, when it's of the same domain,
+	// ready, and the domain wasn't down, like the approved baselines.
+	BaselinePinned = "evaluation"
+)
+
+// Baseline - Struct representing the evaluation the servers and the SSL
+// grade of an evaluation are compared with (see DomainEvaluation.SearchBaseline).
+type Baseline struct {
+	Mode         string
+	Hours        int
+	EvaluationId int
+}
+
+// Default constructor for the Baseline struct: the last ready evaluation done
+// at least one hour before.
+func DefaultBaseline() Baseline {
+	return Baseline{Mode: BaselineHoursAgo, Hours: 1}
+}
+
+// Function for parsing a baseline: previous, yesterday, a number of hours
+// like 6h, or evaluation:ID for a pinned evaluation.
+func ParseBaseline(s string) (b Baseline, err error) {
+	switch {
+	case s == BaselinePrevious || s == BaselineYesterday:
+		return Baseline{Mode: s}, nil
+	case strings.HasPrefix(s, BaselinePinned+":"):
+		b = Baseline{Mode: BaselinePinned}
+		b.EvaluationId, err = strconv.Atoi(strings.TrimPrefix(s, BaselinePinned+":"))
+		if err != nil || b.EvaluationId <= 0 {
+			return Baseline{}, fmt.Errorf("invalid baseline evaluation id in %q", s)
+		}
+		return
+	case strings.HasSuffix(s, "h"):
+		b = Baseline{Mode: BaselineHoursAgo}
+		b.Hours, err = strconv.Atoi(strings.TrimSuffix(s, "h"))
+		if err != nil || b.Hours <= 0 {
+			return Baseline{}, fmt.Errorf("invalid baseline hours in %q", s)
+		}
+		return
+	}
+	return Baseline{}, fmt.Errorf("unknown baseline %q: it must be previous, yesterday, a number of hours "+
+		"like 6h or evaluation:ID", s)
+}
+
+// Method for implementing the fmt.Stringer interface, in the format of ParseBaseline.
+func (b Baseline) String() string {
+	switch b.Mode {
+	case BaselineHoursAgo:
+		return strconv.Itoa(b.Hours) + "h"
+	case BaselinePinned:
+		return BaselinePinned + ":" + strconv.Itoa(b.EvaluationId)
+	}
+	return b.Mode
+}
+
+// SearchBaseline
+// Method for searching the evaluation the current DomainEvaluation structure
+// is compared with, given the baseline, with its servers. The Id of the
+// baseline is 0 when there is none.
+func (de *DomainEvaluation) SearchBaseline(ctx context.Context, store Store, b Baseline) (DomainEvaluation, error) {
+	if b.Mode == BaselinePinned {
+		baseline, err := store.FindEvaluation(ctx, b.EvaluationId)
+		if err != nil || baseline.Domain != de.Domain || baseline.Id == de.Id || baseline.EvaluationInProgress ||
+			baseline.IsDown {
+			return DomainEvaluation{}, err
+		}
+		return baseline, nil
+	}
+	EvaluationHour, err := time.Parse(time.RFC3339, de.EvaluationHour)
+	if err != nil {
+		return DomainEvaluation{}, err
+	}
+	upperBound := EvaluationHour
+	switch b.Mode {
+	case BaselineHoursAgo:
+		upperBound = EvaluationHour.Add(time.Hour * time.Duration(-b.Hours))
+	case BaselineYesterday:
+		upperBound = EvaluationHour.AddDate(0, 0, -1)
+	}
+	baseline, err := store.SearchLastEvaluation(ctx, de.Domain, false, upperBound)
+	if err != nil || baseline.Id == 0 {
+		return DomainEvaluation{}, err
+	}
+	baseline.Servers, err = store.ListServers(ctx, baseline.Id)
+	return baseline, err
+}
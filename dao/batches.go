@@ -0,0 +1,130 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cockroachdb/cockroach-go/crdb"
+	"github.com/lib/pq"
+)
+
+// Batch - Struct for the representation of a list of domains evaluated
+// together. The items keep the order of the domains in the request.
+type Batch struct {
+	Id        string      `json:"id"`         // VARCHAR[32] PRIMARY KEY
+	CreatedAt time.Time   `json:"created_at"` // TIMESTAMPTZ
+	Items     []BatchItem `json:"items"`
+}
+
+// BatchItem - Struct for the representation of the evaluation of a domain of
+// a batch.
+type BatchItem struct {
+	Position  int       `json:"-"`          // integer, PRIMARY KEY with the batch id
+	Domain    string    `json:"domain"`     // VARCHAR[100]
+	Status    string    `json:"status"`     // VARCHAR[20]
+	SslGrade  string    `json:"ssl_grade"`  // VARCHAR[5]
+	IsDown    bool      `json:"is_down"`    // boolean
+	Errors    string    `json:"-"`          // TEXT, the errors encoded in json
+	UpdatedAt time.Time `json:"updated_at"` // TIMESTAMPTZ
+}
+
+// BatchStore interface: Declaration of the operations over the batches of
+// evaluations.
+type BatchStore interface {
+	// CreateBatch stores the batch and its items.
+	CreateBatch(ctx context.Context, b *Batch) error
+	// UpdateBatchItem replaces the item of the batch in the same position.
+	UpdateBatchItem(ctx context.Context, batchId string, item BatchItem) error
+	// FindBatch returns the batch with the given id. The Id is empty when there is none.
+	FindBatch(ctx context.Context, id string) (Batch, error)
+	// ListBatchIds returns the ids of the batches with items in any of the
+	// given statuses.
+	ListBatchIds(ctx context.Context, statuses []string) ([]string, error)
+}
+
+// CreateBatch
+// Function for storing a batch and its items in a transaction.
+func CreateBatch(ctx context.Context, b *Batch, dbc *sql.DB) error {
+	return crdb.ExecuteTx(ctx, dbc, nil, func(tx *sql.Tx) error {
+		_, err := Exec(ctx, tx, `INSERT INTO batch (id, createdAt) VALUES ($1, $2);`, b.Id, b.CreatedAt)
+		if err != nil {
+			return err
+		}
+		sqlStatement := `INSERT INTO batchItem (batchId, position, domain, status, sslGrade, isDown,
+			errors, updatedAt) VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`
+		for _, item := range b.Items {
+			_, err = Exec(ctx, tx, sqlStatement, b.Id, item.Position, item.Domain, item.Status, item.SslGrade,
+				item.IsDown, item.Errors, item.UpdatedAt)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateBatchItem
+// Function for updating the result of an item of a batch.
+func UpdateBatchItem(ctx context.Context, batchId string, item BatchItem, dbc interface{}) error {
+	sqlStatement := `UPDATE batchItem SET status = $3, sslGrade = $4, isDown = $5, errors = $6,
+		updatedAt = $7 WHERE batchId = $1 AND position = $2;`
+	_, err := Exec(ctx, dbc, sqlStatement, batchId, item.Position, item.Status, item.SslGrade, item.IsDown,
+		item.Errors, item.UpdatedAt)
+	return err
+}
+
+// FindBatch
+// Function for searching a batch by its id, with its items.
+func FindBatch(ctx context.Context, id string, dbc interface{}) (b Batch, err error) {
+	row, err := QueryRow(ctx, dbc, `SELECT id, createdAt FROM batch WHERE id = $1;`, id)
+	if err != nil {
+		return
+	}
+	if err = row.Scan(&b.Id, &b.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return Batch{}, nil
+		}
+		return
+	}
+	sqlStatement := `SELECT position, domain, status, sslGrade, isDown, errors, updatedAt
+		FROM batchItem WHERE batchId = $1 ORDER BY position;`
+	rows, err := Query(ctx, dbc, sqlStatement, id)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	b.Items = make([]BatchItem, 0)
+	for rows.Next() {
+		var item BatchItem
+		err = rows.Scan(&item.Position, &item.Domain, &item.Status, &item.SslGrade, &item.IsDown,
+			&item.Errors, &item.UpdatedAt)
+		if err != nil {
+			return
+		}
+		b.Items = append(b.Items, item)
+	}
+	err = rows.Err()
+	return
+}
+
+// ListBatchIds
+// Function for listing the ids of the batches with items in any of the given
+// statuses, like the ones left unfinished by a stopped replica.
+func ListBatchIds(ctx context.Context, statuses []string, dbc interface{}) ([]string, error) {
+	sqlStatement := `SELECT DISTINCT batchId FROM batchItem WHERE status = ANY($1) ORDER BY batchId;`
+	rows, err := Query(ctx, dbc, sqlStatement, pq.Array(statuses))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
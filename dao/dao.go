@@ -3,13 +3,21 @@
 package dao
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"log/slog"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/metrics"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Postgresql Settings
@@ -26,17 +34,26 @@ const (
 	SSLCERT     = "../../certs/client.manuelams.crt"
 )
 
-// Declaration of global DB controller
-var (
-	DBConf *sql.DB
-)
+// Time to wait for the database to answer the first ping.
+var InitDBTimeout = time.Second * 5
 
-// Function for the inicialization of the global DB controller
+// Function for the inicialization of the DB controller.
+// sql.Open doesn't connect to the database, so the function pings it in order
+// to fail at startup when the database can't be reached.
 func InitDB() (*sql.DB, error) {
 	psqlInfo := fmt.Sprintf("postgresql://%s:%s@%s:%s/%s?ssl=%s&sslmode=%s&sslrootcert=%s&sslkey=%s&sslcert=%s",
 		USER, PASSWORD, HOST, strconv.Itoa(PORT), DATABASE, strconv.FormatBool(SSL), SSLMODE, SSLROOTCERT, SSLKEY, SSLCERT)
 	db, err := sql.Open("postgres", psqlInfo)
-	return db, err
+	if err != nil {
+		return db, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), InitDBTimeout)
+	defer cancel()
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
 }
 
 // Auxiliar function to add quotes to a string
@@ -63,10 +80,11 @@ type DomainEvaluation struct {
 	EvaluationHour       string   `json:"hour"`        // VARCHAR[30]
 	EvaluationInProgress bool     `json:"in_progress"` // boolean
 	Servers              []Server `json:"-"`
-	SslGrade             string   `json:"ssl_grade"` // VARCHAR [5]
-	Logo                 string   `json:"logo"`      // VARCHAR[20]
-	Title                string   `json:"title"`     // VARCHAR[20]
-	IsDown               bool     `json:"is_down"`   // boolean
+	SslGrade             string   `json:"ssl_grade"`            // VARCHAR [5]
+	Logo                 string   `json:"logo"`                 // VARCHAR[20]
+	Title                string   `json:"title"`                // VARCHAR[20]
+	IsDown               bool     `json:"is_down"`              // boolean
+	RequestId            string   `json:"request_id,omitempty"` // VARCHAR[64]
 }
 
 // DomainEvaluationComplete: Struct for the representation of all data
@@ -81,8 +99,15 @@ type DomainEvaluationComplete struct {
 	Logo             string   `json:"logo"`
 	Title            string   `json:"title"`
 	IsDown           bool     `json:"is_down"` // boolean
+	Baseline         *EvaluationRef `json:"baseline"` // evaluation compared with, nil without one
+	Drift            *Drift   `json:"drift"` // drift from the approved baseline, nil without one
+	EvaluationId     int      `json:"-"` // id of the evaluation, for comparing it with other baselines
+	EvaluationHour   string   `json:"-"`
 }
 
+// Previous SSL grade of the evaluations without baseline.
+const NoEvaluation = `NO EVALUATION`
+
 // Function self-explanatory, it allows to copy information from one structure
 // for database manipulation to another structure for data visualization
 func (dec *DomainEvaluationComplete) Copy(de DomainEvaluation) {
@@ -92,6 +117,22 @@ func (dec *DomainEvaluationComplete) Copy(de DomainEvaluation) {
 	dec.IsDown = de.IsDown
 	dec.Logo = de.Logo
 	dec.Title = de.Title
+	dec.EvaluationId = de.Id
+	dec.EvaluationHour = de.EvaluationHour
+}
+
+// Method for comparing the evaluation, whose servers are given, with its
+// baseline (see DomainEvaluation.SearchBaseline), whose Id is 0 when there is none.
+func (dec *DomainEvaluationComplete) CompareWith(servers []Server, baseline DomainEvaluation) {
+	dec.ServersChanged = false
+	dec.PreviousSslGrade = NoEvaluation
+	dec.Baseline = nil
+	if baseline.Id == 0 {
+		return
+	}
+	dec.ServersChanged = DiffServers(baseline.Servers, servers).Changed()
+	dec.PreviousSslGrade = baseline.SslGrade
+	dec.Baseline = &EvaluationRef{Id: baseline.Id, Hour: baseline.EvaluationHour}
 }
 
 // Compares two server structures
@@ -126,19 +167,48 @@ func CompareDomainEvaluation(de1, de2 DomainEvaluation) bool {
 
 // DAO interface: Declaration of interface for data manipulation in database
 type DAO interface {
-	SelectInDB(dbc interface{}) error
-	CreateInDB(dbc interface{}) error
-	UpdateInDB(dbc interface{}) error
-	DeleteInDB(dbc interface{}) error
+	SelectInDB(ctx context.Context, dbc interface{}) error
+	CreateInDB(ctx context.Context, dbc interface{}) error
+	UpdateInDB(ctx context.Context, dbc interface{}) error
+	DeleteInDB(ctx context.Context, dbc interface{}) error
+}
+
+// Auxiliar function for getting the operation of a statement, that is, its
+// first keyword (SELECT, INSERT, UPDATE...).
+func queryOperation(sqlString string) string {
+	if fields := strings.Fields(sqlString); len(fields) > 0 {
+		return strings.ToUpper(fields[0])
+	}
+	return "OTHER"
+}
+
+// Auxiliar function for starting the span of a statement sent to the database.
+func startQuery(ctx context.Context, sqlString string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "db."+queryOperation(sqlString), attribute.String("db.statement", sqlString))
+}
+
+// Auxiliar function for observing a statement sent to the database: its
+// latency goes to the metrics, the statement to the debug logs and its span is ended.
+// Errors of QueryRow are only known when the row is scanned, so they aren't logged here.
+func observeQuery(ctx context.Context, span trace.Span, sqlString string, start time.Time, err *error) {
+	tracing.End(span, err)
+	metrics.ObserveQuery(queryOperation(sqlString), start)
+	if *err != nil {
+		slog.WarnContext(ctx, "database statement failed", "statement", sqlString, "error", *err)
+		return
+	}
+	slog.DebugContext(ctx, "database statement", "statement", sqlString, "duration", time.Since(start))
 }
 
 // Function for calling Exec in either a *sql.DB or a *sql.Tx controller.
-func Exec(dbc interface{}, sqlString string, args ...interface{}) (r sql.Result, err error) {
+func Exec(ctx context.Context, dbc interface{}, sqlString string, args ...interface{}) (r sql.Result, err error) {
+	ctx, span := startQuery(ctx, sqlString)
+	defer observeQuery(ctx, span, sqlString, time.Now(), &err)
 	switch v := dbc.(type) {
 	case *sql.DB:
-		r, err = v.Exec(sqlString, args...)
+		r, err = v.ExecContext(ctx, sqlString, args...)
 	case *sql.Tx:
-		r, err = v.Exec(sqlString, args...)
+		r, err = v.ExecContext(ctx, sqlString, args...)
 	default:
 		err = errors.New("No valid DB Controller")
 	}
@@ -146,12 +216,14 @@ func Exec(dbc interface{}, sqlString string, args ...interface{}) (r sql.Result,
 }
 
 // Funcion for calling QueryRow in either a *sql.DB or a *sql.Tx controller.
-func QueryRow(dbc interface{}, sqlString string, args ...interface{}) (r *sql.Row, err error) {
+func QueryRow(ctx context.Context, dbc interface{}, sqlString string, args ...interface{}) (r *sql.Row, err error) {
+	ctx, span := startQuery(ctx, sqlString)
+	defer observeQuery(ctx, span, sqlString, time.Now(), &err)
 	switch v := dbc.(type) {
 	case *sql.DB:
-		r = v.QueryRow(sqlString, args...)
+		r = v.QueryRowContext(ctx, sqlString, args...)
 	case *sql.Tx:
-		r = v.QueryRow(sqlString, args...)
+		r = v.QueryRowContext(ctx, sqlString, args...)
 	default:
 		err = errors.New("No valid DB Controller")
 	}
@@ -159,12 +231,14 @@ func QueryRow(dbc interface{}, sqlString string, args ...interface{}) (r *sql.Ro
 }
 
 // Function for calling Query in either a *sql.DB or a *sql.Tx controller.
-func Query(dbc interface{}, sqlString string, args ...interface{}) (r *sql.Rows, err error) {
+func Query(ctx context.Context, dbc interface{}, sqlString string, args ...interface{}) (r *sql.Rows, err error) {
+	ctx, span := startQuery(ctx, sqlString)
+	defer observeQuery(ctx, span, sqlString, time.Now(), &err)
 	switch v := dbc.(type) {
 	case *sql.DB:
-		r, err = v.Query(sqlString, args...)
+		r, err = v.QueryContext(ctx, sqlString, args...)
 	case *sql.Tx:
-		r, err = v.Query(sqlString, args...)
+		r, err = v.QueryContext(ctx, sqlString, args...)
 	default:
 		err = errors.New("No valid DB Controller")
 	}
@@ -176,7 +250,8 @@ func Query(dbc interface{}, sqlString string, args ...interface{}) (r *sql.Rows,
 func InitDomainEvaluationTable(dbc *sql.DB) error {
 	sqlStatement := `CREATE TABLE domainEvaluation (id SERIAL PRIMARY KEY,
 					domain VARCHAR(100), EvaluationHour VARCHAR(30), EvaluationInProgress boolean,
-					sslGrade VARCHAR(5), logo VARCHAR(80), title VARCHAR(80), isDown boolean);`
+					sslGrade VARCHAR(5), logo VARCHAR(80), title VARCHAR(80), isDown boolean,
+					requestId VARCHAR(64) NOT NULL DEFAULT '');`
 	_, err := dbc.Exec(sqlStatement)
 	return err
 }
@@ -191,6 +266,25 @@ func InitServerTable(dbc *sql.DB) error {
 	return err
 }
 
+// Function for creating the evaluationLock table.
+// The table holds at most one row per domain, marking that an API replica is
+// currently evaluating it.
+// WARNING: USAGE ONLY IN TESTS ENVIRONMENTS, NOT RECOMMENDED FOR PRODUCTION
+func InitEvaluationLockTable(dbc *sql.DB) error {
+	sqlStatement := `CREATE TABLE evaluationLock (domain VARCHAR(100) PRIMARY KEY,
+		owner VARCHAR(64), expiresAt TIMESTAMPTZ);`
+	_, err := dbc.Exec(sqlStatement)
+	return err
+}
+
+// Function for droping the evaluationLock table.
+// WARNING: USAGE ONLY IN TESTS ENVIRONMENTS, NOT RECOMMENDED FOR PRODUCTION
+func DropEvaluationLockTable(dbc *sql.DB) error {
+	sqlStatement := `DROP TABLE evaluationLock;`
+	_, err := dbc.Exec(sqlStatement)
+	return err
+}
+
 // Function for droping the server table.
 // WARNING: USAGE ONLY IN TESTS ENVIRONMENTS, NOT RECOMMENDED FOR PRODUCTION
 func DropServerTable(dbc *sql.DB) error {
@@ -217,15 +311,20 @@ func CleanDataInDB(dbc *sql.DB) error {
 	}
 	sqlStatement2 := `DELETE FROM domainevaluation WHERE id > 0;`
 	_, err = dbc.Exec(sqlStatement2)
+	if err != nil {
+		return err
+	}
+	sqlStatement3 := `DELETE FROM evaluationLock WHERE true;`
+	_, err = dbc.Exec(sqlStatement3)
 	return err
 }
 
 // SelectInDB
 // Implementation of the method SelectInDB from the DAO interface
 // for the Server structure.
-func (s *Server) SelectInDB(dbc interface{}) error {
+func (s *Server) SelectInDB(ctx context.Context, dbc interface{}) error {
 	sqlStatement := `SELECT address, sslGrade, country, owner FROM server WHERE id=$1;`
-	row, err := QueryRow(dbc, sqlStatement, s.Id)
+	row, err := QueryRow(ctx, dbc, sqlStatement, s.Id)
 	err = row.Scan(&s.Address, &s.SslGrade, &s.Country, &s.Owner)
 	switch err {
 	case sql.ErrNoRows:
@@ -240,10 +339,10 @@ func (s *Server) SelectInDB(dbc interface{}) error {
 // CreateInDB
 // Implementation of the method CreateInDB from the DAO interface
 // for the Server structure.
-func (s *Server) CreateInDB(dbc interface{}) error {
+func (s *Server) CreateInDB(ctx context.Context, dbc interface{}) error {
 	sqlStatement := `INSERT INTO server (address, sslGrade, country, owner)
 	VALUES ($1, $2, $3, $4) RETURNING id;`
-	row, err := QueryRow(dbc, sqlStatement, s.Address, s.SslGrade, s.Country, s.Owner)
+	row, err := QueryRow(ctx, dbc, sqlStatement, s.Address, s.SslGrade, s.Country, s.Owner)
 	err = row.Scan(&s.Id)
 	return err
 }
@@ -252,19 +351,19 @@ func (s *Server) CreateInDB(dbc interface{}) error {
 // Method for updating the domainEvaluationId of a server structure.
 // Since the server structure doesn't store the id, the update is just in
 // the database
-func (s *Server) updateDomainEvaluationInDB(domainEvaluationId int, dbc interface{}) error {
+func (s *Server) updateDomainEvaluationInDB(ctx context.Context, domainEvaluationId int, dbc interface{}) error {
 	sqlStatement := `UPDATE server SET domainEvaluationId = $2 WHERE id = $1;`
-	_, err := Exec(dbc, sqlStatement, s.Id, domainEvaluationId)
+	_, err := Exec(ctx, dbc, sqlStatement, s.Id, domainEvaluationId)
 	return err
 }
 
 // UpdateInDB
 // Implementation of the method UpdateInDB from the DAO interface
 // for the Server structure.
-func (s *Server) UpdateInDB(dbc interface{}) error {
+func (s *Server) UpdateInDB(ctx context.Context, dbc interface{}) error {
 	sqlStatement := `UPDATE server SET address = $2, sslGrade = $3, country = $4,
 	owner = $5 WHERE id = $1;`
-	_, err := Exec(dbc, sqlStatement, s.Id, s.Address,
+	_, err := Exec(ctx, dbc, sqlStatement, s.Id, s.Address,
 		s.SslGrade, s.Country, s.Owner)
 	return err
 }
@@ -272,21 +371,21 @@ func (s *Server) UpdateInDB(dbc interface{}) error {
 // DeleteInDB
 // Implementation of the method DeleteInDB from the DAO interface
 // for the Server structure.
-func (s *Server) DeleteInDB(dbc interface{}) error {
+func (s *Server) DeleteInDB(ctx context.Context, dbc interface{}) error {
 	sqlStatement := `DELETE FROM server WHERE id = $1;`
-	_, err := Exec(dbc, sqlStatement, s.Id)
+	_, err := Exec(ctx, dbc, sqlStatement, s.Id)
 	return err
 }
 
 // SelectInDB
 // Implementation of the method SelectInDB from the DAO interface
 // for the DomainEvaluation structure.
-func (de *DomainEvaluation) SelectInDB(dbc interface{}) error {
+func (de *DomainEvaluation) SelectInDB(ctx context.Context, dbc interface{}) error {
 	sqlStatement := `SELECT domain, EvaluationHour, EvaluationInProgress, sslGrade,
-	logo, title, isDown FROM domainEvaluation WHERE id=$1;`
-	row, err := QueryRow(dbc, sqlStatement, de.Id)
+	logo, title, isDown, requestId FROM domainEvaluation WHERE id=$1;`
+	row, err := QueryRow(ctx, dbc, sqlStatement, de.Id)
 	err = row.Scan(&de.Domain, &de.EvaluationHour, &de.EvaluationInProgress, &de.SslGrade,
-		&de.Logo, &de.Title, &de.IsDown)
+		&de.Logo, &de.Title, &de.IsDown, &de.RequestId)
 	switch err {
 	case sql.ErrNoRows:
 		return errors.New("No rows were returned.")
@@ -302,11 +401,11 @@ func (de *DomainEvaluation) SelectInDB(dbc interface{}) error {
 // for the DomainEvaluation structure.
 // In case the lists of servers in the structure is not empty,
 // the method create all the servers in the list in the db.
-func (de *DomainEvaluation) CreateInDB(dbc interface{}) error {
+func (de *DomainEvaluation) CreateInDB(ctx context.Context, dbc interface{}) error {
 	sqlStatement := `INSERT INTO domainEvaluation (domain, EvaluationHour, EvaluationInProgress, sslGrade,
-		logo, title, isDown) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id;`
-	row, err := QueryRow(dbc, sqlStatement, de.Domain, de.EvaluationHour,
-		de.EvaluationInProgress, de.SslGrade, de.Logo, de.Title, de.IsDown)
+		logo, title, isDown, requestId) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id;`
+	row, err := QueryRow(ctx, dbc, sqlStatement, de.Domain, de.EvaluationHour,
+		de.EvaluationInProgress, de.SslGrade, de.Logo, de.Title, de.IsDown, de.RequestId)
 	err = row.Scan(&de.Id)
 	if err != nil {
 		return err
@@ -314,11 +413,12 @@ func (de *DomainEvaluation) CreateInDB(dbc interface{}) error {
 
 	//
 	if len(de.Servers) > 0 {
-		for _, v := range de.Servers {
-			if err = v.CreateInDB(dbc); err != nil {
+		for i := range de.Servers {
+			v := &de.Servers[i]
+			if err = v.CreateInDB(ctx, dbc); err != nil {
 				return err
 			}
-			if err = v.updateDomainEvaluationInDB(de.Id, dbc); err != nil {
+			if err = v.updateDomainEvaluationInDB(ctx, de.Id, dbc); err != nil {
 				return err
 			}
 		}
@@ -335,24 +435,25 @@ func (de *DomainEvaluation) CreateInDB(dbc interface{}) error {
 // in the list.
 
 // Partial updates of the server list are not implemented in this method
-func (de *DomainEvaluation) UpdateInDB(dbc interface{}) error {
+func (de *DomainEvaluation) UpdateInDB(ctx context.Context, dbc interface{}) error {
 	sqlStatement := `UPDATE domainEvaluation SET domain = $2, EvaluationHour = $3, EvaluationInProgress = $4,
-	sslGrade = $5, logo = $6, title = $7, isDown = $8 WHERE id = $1;`
-	_, err := Exec(dbc, sqlStatement, de.Id, de.Domain, de.EvaluationHour,
-		de.EvaluationInProgress, de.SslGrade, de.Logo, de.Title, de.IsDown)
+	sslGrade = $5, logo = $6, title = $7, isDown = $8, requestId = $9 WHERE id = $1;`
+	_, err := Exec(ctx, dbc, sqlStatement, de.Id, de.Domain, de.EvaluationHour,
+		de.EvaluationInProgress, de.SslGrade, de.Logo, de.Title, de.IsDown, de.RequestId)
 	if err != nil {
 		return err
 	}
 	if len(de.Servers) > 0 {
-		err = de.deleteAllServersInDB(dbc)
+		err = de.deleteAllServersInDB(ctx, dbc)
 		if err != nil {
 			return err
 		}
-		for _, v := range de.Servers {
-			if err = v.CreateInDB(dbc); err != nil {
+		for i := range de.Servers {
+			v := &de.Servers[i]
+			if err = v.CreateInDB(ctx, dbc); err != nil {
 				return err
 			}
-			if err = v.updateDomainEvaluationInDB(de.Id, dbc); err != nil {
+			if err = v.updateDomainEvaluationInDB(ctx, de.Id, dbc); err != nil {
 				return err
 			}
 		}
@@ -362,45 +463,63 @@ func (de *DomainEvaluation) UpdateInDB(dbc interface{}) error {
 
 // UpdateLogoInDb
 // Method for updating only the logo in a domainEvaluation structure.
-func (de *DomainEvaluation) UpdateLogoInDb(dbc interface{}) error {
+func (de *DomainEvaluation) UpdateLogoInDb(ctx context.Context, dbc interface{}) error {
 	sqlStatement := `UPDATE domainEvaluation SET logo = $2 WHERE id = $1;`
-	_, err := Exec(dbc, sqlStatement, de.Id, de.Logo)
+	_, err := Exec(ctx, dbc, sqlStatement, de.Id, de.Logo)
 	return err
 }
 
 // UpdateTitleInDb
 // Method for updating only the title in a domainEvaluation structure.
-func (de *DomainEvaluation) UpdateTitleInDb(dbc interface{}) error {
+func (de *DomainEvaluation) UpdateTitleInDb(ctx context.Context, dbc interface{}) error {
 	sqlStatement := `UPDATE domainEvaluation SET title = $2 WHERE id = $1;`
-	_, err := Exec(dbc, sqlStatement, de.Id, de.Title)
+	_, err := Exec(ctx, dbc, sqlStatement, de.Id, de.Title)
 	return err
 }
 
 // UpdateHourInDb
 // Method for updating only the hour in a domainEvaluation structure.
-func (de *DomainEvaluation) UpdateHourInDb(dbc interface{}) error {
+func (de *DomainEvaluation) UpdateHourInDb(ctx context.Context, dbc interface{}) error {
 	sqlStatement := `UPDATE domainEvaluation SET EvaluationHour = $2 WHERE id = $1;`
-	_, err := Exec(dbc, sqlStatement, de.Id, de.EvaluationHour)
+	_, err := Exec(ctx, dbc, sqlStatement, de.Id, de.EvaluationHour)
+	return err
+}
+
+// UpdateEnrichmentInDB
+// Method for updating the logo, the title and the country and owner of every
+// server in a domainEvaluation structure. It's meant to run inside a single
+// transaction, so a cancelled enrichment never leaves half of the data written.
+func (de *DomainEvaluation) UpdateEnrichmentInDB(ctx context.Context, dbc interface{}) error {
+	sqlStatement := `UPDATE domainEvaluation SET logo = $2, title = $3 WHERE id = $1;`
+	_, err := Exec(ctx, dbc, sqlStatement, de.Id, de.Logo, de.Title)
+	if err != nil {
+		return err
+	}
+	for i := range de.Servers {
+		if err = de.Servers[i].UpdateInDB(ctx, dbc); err != nil {
+			return err
+		}
+	}
 	return err
 }
 
 // deleteAllServersInDB
 // Method for deleting all servers in db corresponding to a specific
 // domainEvaluation structure.
-func (de *DomainEvaluation) deleteAllServersInDB(dbc interface{}) error {
+func (de *DomainEvaluation) deleteAllServersInDB(ctx context.Context, dbc interface{}) error {
 	sqlStatement := `DELETE FROM server WHERE domainEvaluationId = $1;`
-	_, err := Exec(dbc, sqlStatement, de.Id)
+	_, err := Exec(ctx, dbc, sqlStatement, de.Id)
 	return err
 }
 
 // DeleteInDB
 // Implementation of the method DeleteInDB from the DAO interface for
 // the domainEvaluation structure.
-func (de *DomainEvaluation) DeleteInDB(dbc interface{}) error {
+func (de *DomainEvaluation) DeleteInDB(ctx context.Context, dbc interface{}) error {
 	sqlStatement := `DELETE FROM domainEvaluation WHERE id = $1;`
-	_, err := Exec(dbc, sqlStatement, de.Id)
+	_, err := Exec(ctx, dbc, sqlStatement, de.Id)
 	if err == nil {
-		return de.deleteAllServersInDB(dbc)
+		return de.deleteAllServersInDB(ctx, dbc)
 	}
 	return err
 }
@@ -408,19 +527,21 @@ func (de *DomainEvaluation) DeleteInDB(dbc interface{}) error {
 // ListDomainEvaluations
 // Function for listing all domain evaluations in the database, without any
 // kind of grouping
-func ListDomainEvaluations(dbc interface{}) ([]DomainEvaluation, error) {
+func ListDomainEvaluations(ctx context.Context, dbc interface{}) ([]DomainEvaluation, error) {
 	var domainEvaluations []DomainEvaluation
-	sqlStatement := `SELECT id, domain, EvaluationHour, EvaluationInProgress, sslGrade, logo, title, isDown FROM domainEvaluation;`
-	rows, err := Query(dbc, sqlStatement)
+	sqlStatement := `SELECT id, domain, EvaluationHour, EvaluationInProgress, sslGrade, logo, title, isDown,
+		requestId FROM domainEvaluation;`
+	rows, err := Query(ctx, dbc, sqlStatement)
 
 	if err != nil {
 		return domainEvaluations, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var de DomainEvaluation
 		if err = rows.Scan(&de.Id, &de.Domain, &de.EvaluationHour, &de.EvaluationInProgress,
-			&de.SslGrade, &de.Logo, &de.Title, &de.IsDown); err != nil {
+			&de.SslGrade, &de.Logo, &de.Title, &de.IsDown, &de.RequestId); err != nil {
 			return domainEvaluations, err
 		}
 		domainEvaluations = append(domainEvaluations, de)
@@ -435,8 +556,8 @@ func ListDomainEvaluations(dbc interface{}) ([]DomainEvaluation, error) {
 
 // Function for listing the last domain evaluations for each unique domain name
 // in the database.
-func ListRecentDomainEvaluations(dbc interface{}) ([]DomainEvaluation, error) {
-	del, err := ListDomainEvaluations(dbc)
+func ListRecentDomainEvaluations(ctx context.Context, dbc interface{}) ([]DomainEvaluation, error) {
+	del, err := ListDomainEvaluations(ctx, dbc)
 	if err != nil {
 		return nil, err
 	}
@@ -481,15 +602,16 @@ func ListRecentDomainEvaluations(dbc interface{}) ([]DomainEvaluation, error) {
 }
 
 // Function for listing the servers corresponding to a specific idDomainEvaluation
-func ListServersID(idDomainEvaluation int, dbc interface{}) ([]Server, error) {
+func ListServersID(ctx context.Context, idDomainEvaluation int, dbc interface{}) ([]Server, error) {
 	var servers []Server
 	sqlStatement := `SELECT id, address, sslGrade, country, owner FROM server
 						WHERE domainEvaluationId = $1;`
-	rows, err := Query(dbc, sqlStatement, idDomainEvaluation)
+	rows, err := Query(ctx, dbc, sqlStatement, idDomainEvaluation)
 
 	if err != nil {
 		return servers, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var s Server
@@ -506,9 +628,89 @@ func ListServersID(idDomainEvaluation int, dbc interface{}) ([]Server, error) {
 	return servers, err
 }
 
+// Function for listing the evaluations of a domain, from the newest to the
+// oldest one. When limit is greater than zero, only the newest limit evaluations
+// are listed. The hours may have different offsets, so they are sorted once
+// parsed, like in ListRecentDomainEvaluations.
+func ListDomainHistory(ctx context.Context, domainName string, limit int, dbc interface{}) ([]DomainEvaluation, error) {
+	domainEvaluations := make([]DomainEvaluation, 0)
+	sqlStatement := `SELECT id, domain, EvaluationHour, EvaluationInProgress, sslGrade, logo, title, isDown,
+		requestId FROM domainEvaluation WHERE domain = $1;`
+	rows, err := Query(ctx, dbc, sqlStatement, domainName)
+	if err != nil {
+		return domainEvaluations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var de DomainEvaluation
+		if err = rows.Scan(&de.Id, &de.Domain, &de.EvaluationHour, &de.EvaluationInProgress,
+			&de.SslGrade, &de.Logo, &de.Title, &de.IsDown, &de.RequestId); err != nil {
+			return domainEvaluations, err
+		}
+		domainEvaluations = append(domainEvaluations, de)
+	}
+	if err = rows.Err(); err != nil {
+		return domainEvaluations, err
+	}
+	return newestFirst(domainEvaluations, limit)
+}
+
+// Function for sorting a list of evaluations from the newest to the oldest
+// one (by hour, and then by id). When limit is greater than zero, only the
+// newest limit evaluations are kept.
+func newestFirst(del []DomainEvaluation, limit int) ([]DomainEvaluation, error) {
+	hours := make(map[int]time.Time)
+	for _, de := range del {
+		d, err := time.Parse(time.RFC3339, de.EvaluationHour)
+		if err != nil {
+			return nil, err
+		}
+		hours[de.Id] = d
+	}
+	sort.SliceStable(del, func(i, j int) bool {
+		if hi, hj := hours[del[i].Id], hours[del[j].Id]; !hi.Equal(hj) {
+			return hi.After(hj)
+		}
+		return del[i].Id > del[j].Id
+	})
+	if limit > 0 && len(del) > limit {
+		del = del[:limit]
+	}
+	return del, nil
+}
+
+// Function for listing the servers of several evaluations in a single query,
+// grouped by the id of their evaluation. It avoids a query per evaluation when
+// the servers of a whole list of evaluations are needed.
+func ListServersByEvaluations(ctx context.Context, ids []int, dbc interface{}) (map[int][]Server, error) {
+	servers := make(map[int][]Server)
+	if len(ids) == 0 {
+		return servers, nil
+	}
+	sqlStatement := `SELECT domainEvaluationId, id, address, sslGrade, country, owner FROM server
+						WHERE domainEvaluationId = ANY($1) ORDER BY id;`
+	rows, err := Query(ctx, dbc, sqlStatement, pq.Array(ids))
+	if err != nil {
+		return servers, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var idDomainEvaluation int
+		var s Server
+		if err = rows.Scan(&idDomainEvaluation, &s.Id, &s.Address, &s.SslGrade, &s.Country, &s.Owner); err != nil {
+			return servers, err
+		}
+		servers[idDomainEvaluation] = append(servers[idDomainEvaluation], s)
+	}
+	err = rows.Err()
+	return servers, err
+}
+
 // Method for listing the servers of a DomainEvaluation
-func (de *DomainEvaluation) ListServers(dbc interface{}) error {
-	servers, err := ListServersID(de.Id, dbc)
+func (de *DomainEvaluation) ListServers(ctx context.Context, dbc interface{}) error {
+	servers, err := ListServersID(ctx, de.Id, dbc)
 	de.Servers = servers
 	return err
 }
@@ -520,21 +722,22 @@ func (de *DomainEvaluation) ListServers(dbc interface{}) error {
 // and the status of the evaluation, allowing for search for either the last
 // evaluation in progress, or the last evaluation ready
 
-func (de *DomainEvaluation) SearchLastEvaluation(domainName string, EvaluationInProgress bool,
+func (de *DomainEvaluation) SearchLastEvaluation(ctx context.Context, domainName string, EvaluationInProgress bool,
 	upperBound time.Time, dbc interface{}) error {
 
 	var domainEvaluations []DomainEvaluation
 	sqlStatement := `SELECT id, domain, EvaluationHour, EvaluationInProgress, sslGrade, logo,
-		title, isDown	FROM domainEvaluation WHERE domain = $1 AND EvaluationInProgress = $2;`
-	rows, err := Query(dbc, sqlStatement, domainName, EvaluationInProgress)
+		title, isDown, requestId FROM domainEvaluation WHERE domain = $1 AND EvaluationInProgress = $2;`
+	rows, err := Query(ctx, dbc, sqlStatement, domainName, EvaluationInProgress)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var deTmp DomainEvaluation
 		if err = rows.Scan(&deTmp.Id, &deTmp.Domain, &deTmp.EvaluationHour, &deTmp.EvaluationInProgress,
-			&deTmp.SslGrade, &deTmp.Logo, &deTmp.Title, &deTmp.IsDown); err != nil {
+			&deTmp.SslGrade, &deTmp.Logo, &deTmp.Title, &deTmp.IsDown, &deTmp.RequestId); err != nil {
 			return err
 		}
 		domainEvaluations = append(domainEvaluations, deTmp)
@@ -565,11 +768,50 @@ func (de *DomainEvaluation) SearchLastEvaluation(domainName string, EvaluationIn
 	}
 
 	de.Id = highestID
-	de.SelectInDB(dbc)
+	if highestID != 0 {
+		err = de.SelectInDB(ctx, dbc)
+	}
 	return err
 }
 
 
+// AcquireEvaluationLock
+// Function for taking the evaluation lock of a domain on behalf of owner.
+// The lock is granted when no other owner holds it or when the previous lock
+// has expired, so a crashed replica never blocks a domain forever.
+// It returns false, without error, when the lock is held by someone else.
+func AcquireEvaluationLock(ctx context.Context, domainName string, owner string, ttl time.Duration,
+	dbc interface{}) (bool, error) {
+	sqlStatement := `INSERT INTO evaluationLock (domain, owner, expiresAt)
+		VALUES ($1, $2, now() + $3 * INTERVAL '1 millisecond')
+		ON CONFLICT (domain) DO UPDATE SET owner = excluded.owner, expiresAt = excluded.expiresAt
+		WHERE evaluationLock.expiresAt < now() OR evaluationLock.owner = excluded.owner
+		RETURNING owner;`
+	row, err := QueryRow(ctx, dbc, sqlStatement, domainName, owner, ttl.Milliseconds())
+	if err != nil {
+		return false, err
+	}
+	var lockOwner string
+	err = row.Scan(&lockOwner)
+	switch err {
+	case sql.ErrNoRows:
+		return false, nil
+	case nil:
+		return lockOwner == owner, nil
+	default:
+		return false, err
+	}
+}
+
+// ReleaseEvaluationLock
+// Function for releasing the evaluation lock of a domain. Only the owner of
+// the lock can release it.
+func ReleaseEvaluationLock(ctx context.Context, domainName string, owner string, dbc interface{}) error {
+	sqlStatement := `DELETE FROM evaluationLock WHERE domain = $1 AND owner = $2;`
+	_, err := Exec(ctx, dbc, sqlStatement, domainName, owner)
+	return err
+}
+
 var SLStatus = newSLSRegistry()
 func newSLSRegistry() *slsRegistry {
 	return &slsRegistry{
@@ -590,29 +832,16 @@ type slsRegistry struct {
 
 // The method compares the servers of the current DomainEvaluation structure
 // with the servers of the previous DomainEvaluation(one hour before)
-// in the database.
-
-func (de *DomainEvaluation) HaveServersChanged(dbc interface{}) (int, error) {
-	EvaluationHour, err := time.Parse(time.RFC3339, de.EvaluationHour)
-	if err != nil {
-		return SLStatus.NoPastEvaluation, err
-	}
-	EvaluationHourS1H := EvaluationHour.Add(time.Hour * -1)
+// in the store. The servers are matched by address (see DiffServers), so
+// a different order of the servers isn't a change.
 
-	deTmp := DomainEvaluation{}
-	err = deTmp.SearchLastEvaluation(de.Domain, false, EvaluationHourS1H, dbc)
-	if err != nil {
-		return SLStatus.NoPastEvaluation, err
-	}
-	if deTmp.Id == 0 {
-		return SLStatus.NoPastEvaluation, nil
-	}
-	err = deTmp.ListServers(dbc)
-	if err != nil {
+func (de *DomainEvaluation) HaveServersChanged(ctx context.Context, store Store) (int, error) {
+	deTmp, err := de.SearchBaseline(ctx, store, DefaultBaseline())
+	if err != nil || deTmp.Id == 0 {
 		return SLStatus.NoPastEvaluation, err
 	}
 
-	if !CompareServerList(deTmp.Servers, de.Servers) {
+	if DiffServers(deTmp.Servers, de.Servers).Changed() {
 		return SLStatus.Changed, nil
 	}
 
@@ -623,21 +852,11 @@ func (de *DomainEvaluation) HaveServersChanged(dbc interface{}) (int, error) {
 // Method for evaluating the previous sslgrade of a given domain evaluation.
 
 // The method compares the current DomainEvaluation structure with the previous
-// one (one hour before) in the database.
-func (de *DomainEvaluation) PreviousSSLgrade(dbc interface{}) (string, error) {
-	EvaluationHour, err := time.Parse(time.RFC3339, de.EvaluationHour)
-	if err != nil {
-		return `NO EVALUATION`, err
-	}
-	EvaluationHourS1H := EvaluationHour.Add(time.Hour * -1)
-
-	deTmp := DomainEvaluation{}
-	err = deTmp.SearchLastEvaluation(de.Domain, false, EvaluationHourS1H, dbc)
-	if err != nil {
-		return `NO EVALUATION`, err
-	}
-	if deTmp.Id == 0 {
-		return `NO EVALUATION`, nil
+// one (one hour before) in the store.
+func (de *DomainEvaluation) PreviousSSLgrade(ctx context.Context, store Store) (string, error) {
+	deTmp, err := de.SearchBaseline(ctx, store, DefaultBaseline())
+	if err != nil || deTmp.Id == 0 {
+		return NoEvaluation, err
 	}
 
 	return deTmp.SslGrade, nil
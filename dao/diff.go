@@ -0,0 +1,132 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+)
+
+// Change - Struct representing the change of a field between two evaluations.
+type Change struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ServerChange - Struct representing a server present in two evaluations,
+// with the same address, whose grade, country or owner changed.
+type ServerChange struct {
+	Address  string  `json:"address"`
+	SslGrade *Change `json:"ssl_grade,omitempty"`
+	Country  *Change `json:"country,omitempty"`
+	Owner    *Change `json:"owner,omitempty"`
+}
+
+// ServersDiff - Struct holding the differences between two lists of servers.
+// The servers are matched by address, so their order doesn't matter.
+type ServersDiff struct {
+	Added    []Server       `json:"added"`
+	Removed  []Server       `json:"removed"`
+	Modified []ServerChange `json:"modified"`
+}
+
+// Method for checking whether the lists of servers are different.
+func (sd ServersDiff) Changed() bool {
+	return len(sd.Added) > 0 || len(sd.Removed) > 0 || len(sd.Modified) > 0
+}
+
+// EvaluationRef - Struct identifying an evaluation of a domain.
+type EvaluationRef struct {
+	Id   int    `json:"id"`
+	Hour string `json:"hour"`
+}
+
+// EvaluationDiff - Struct holding the differences between two evaluations of
+// a domain. The changes of the grade, the title and the logo are nil when
+// they didn't change.
+type EvaluationDiff struct {
+	Domain   string        `json:"domain"`
+	From     EvaluationRef `json:"from"`
+	To       EvaluationRef `json:"to"`
+	SslGrade *Change       `json:"ssl_grade,omitempty"`
+	Title    *Change       `json:"title,omitempty"`
+	Logo     *Change       `json:"logo,omitempty"`
+	Servers  ServersDiff   `json:"servers"`
+}
+
+// Auxiliar function for the change between two values of a field, nil when
+// they are equal.
+func change(from string, to string) *Change {
+	if from == to {
+		return nil
+	}
+	return &Change{From: from, To: to}
+}
+
+// Function for getting the differences between two lists of servers. The
+// servers are matched by address; the lists of the diff are sorted by address.
+func DiffServers(from []Server, to []Server) ServersDiff {
+	sd := ServersDiff{Added: make([]Server, 0), Removed: make([]Server, 0), Modified: make([]ServerChange, 0)}
+	previous := make(map[string]Server, len(from))
+	for _, s := range from {
+		previous[s.Address] = s
+	}
+	current := make(map[string]bool, len(to))
+	for _, s := range to {
+		current[s.Address] = true
+		p, ok := previous[s.Address]
+		if !ok {
+			sd.Added = append(sd.Added, s)
+			continue
+		}
+		sc := ServerChange{Address: s.Address, SslGrade: change(p.SslGrade, s.SslGrade),
+			Country: change(p.Country, s.Country), Owner: change(p.Owner, s.Owner)}
+		if sc.SslGrade != nil || sc.Country != nil || sc.Owner != nil {
+			sd.Modified = append(sd.Modified, sc)
+		}
+	}
+	for _, s := range from {
+		if !current[s.Address] {
+			sd.Removed = append(sd.Removed, s)
+		}
+	}
+	sort.Slice(sd.Added, func(i, j int) bool { return sd.Added[i].Address < sd.Added[j].Address })
+	sort.Slice(sd.Removed, func(i, j int) bool { return sd.Removed[i].Address < sd.Removed[j].Address })
+	sort.Slice(sd.Modified, func(i, j int) bool { return sd.Modified[i].Address < sd.Modified[j].Address })
+	return sd
+}
+
+// Function for getting the differences between two evaluations of a domain,
+// with their servers.
+func DiffEvaluations(from DomainEvaluation, to DomainEvaluation) EvaluationDiff {
+	return EvaluationDiff{
+		Domain:   to.Domain,
+		From:     EvaluationRef{Id: from.Id, Hour: from.EvaluationHour},
+		To:       EvaluationRef{Id: to.Id, Hour: to.EvaluationHour},
+		SslGrade: change(from.SslGrade, to.SslGrade),
+		Title:    change(from.Title, to.Title),
+		Logo:     change(from.Logo, to.Logo),
+		Servers:  DiffServers(from.Servers, to.Servers),
+	}
+}
+
+// FindEvaluation
+// Function for reading the evaluation with the given id, with its servers.
+// The Id of the evaluation is 0 when there is none.
+func FindEvaluation(ctx context.Context, id int, dbc interface{}) (de DomainEvaluation, err error) {
+	sqlStatement := `SELECT id, domain, EvaluationHour, EvaluationInProgress, sslGrade,
+	logo, title, isDown, requestId FROM domainEvaluation WHERE id=$1;`
+	row, err := QueryRow(ctx, dbc, sqlStatement, id)
+	if err != nil {
+		return
+	}
+	err = row.Scan(&de.Id, &de.Domain, &de.EvaluationHour, &de.EvaluationInProgress, &de.SslGrade,
+		&de.Logo, &de.Title, &de.IsDown, &de.RequestId)
+	if err == sql.ErrNoRows {
+		return DomainEvaluation{}, nil
+	}
+	if err != nil {
+		return
+	}
+	de.Servers, err = ListServersID(ctx, de.Id, dbc)
+	return
+}
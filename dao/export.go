@@ -0,0 +1,104 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// EvaluationFilter - Struct holding the filters of the lists and the exports
+// of evaluations. The zero fields don't filter.
+type EvaluationFilter struct {
+	Domain     string
+	SslGrade   string
+	InProgress *bool
+	// Evaluations done at or after Since, and before Until.
+	Since time.Time
+	Until time.Time
+}
+
+// Method for checking whether an evaluation passes the filter. The hours are
+// compared once parsed, so an evaluation with an invalid hour never passes
+// the Since and Until filters.
+func (f EvaluationFilter) Match(de DomainEvaluation) bool {
+	if f.Domain != "" && de.Domain != f.Domain {
+		return false
+	}
+	if f.SslGrade != "" && de.SslGrade != f.SslGrade {
+		return false
+	}
+	if f.InProgress != nil && de.EvaluationInProgress != *f.InProgress {
+		return false
+	}
+	if f.Since.IsZero() && f.Until.IsZero() {
+		return true
+	}
+	hour, err := time.Parse(time.RFC3339, de.EvaluationHour)
+	if err != nil {
+		return false
+	}
+	return (f.Since.IsZero() || !hour.Before(f.Since)) && (f.Until.IsZero() || hour.Before(f.Until))
+}
+
+// Method for getting the evaluations of del passing the filter.
+func (f EvaluationFilter) Filter(del []DomainEvaluation) []DomainEvaluation {
+	filtered := make([]DomainEvaluation, 0, len(del))
+	for _, de := range del {
+		if f.Match(de) {
+			filtered = append(filtered, de)
+		}
+	}
+	return filtered
+}
+
+// ExportEvaluations
+// Function for reading every evaluation passing the filter, with its servers,
+// in the order they were created. The rows are read one by one and passed to
+// fn, so the evaluations are never kept in memory together. The domain and
+// the grade are filtered in the query, the rest of the filter once the hour
+// is parsed.
+func ExportEvaluations(ctx context.Context, filter EvaluationFilter, fn func(DomainEvaluation) error,
+	dbc interface{}) error {
+	sqlStatement := `SELECT d.id, d.domain, d.EvaluationHour, d.EvaluationInProgress, d.sslGrade, d.logo,
+		d.title, d.isDown, d.requestId, s.id, s.address, s.sslGrade, s.country, s.owner
+		FROM domainEvaluation d LEFT JOIN server s ON s.domainEvaluationId = d.id
+		WHERE ($1 = '' OR d.domain = $1) AND ($2 = '' OR d.sslGrade = $2) ORDER BY d.id, s.id;`
+	rows, err := Query(ctx, dbc, sqlStatement, filter.Domain, filter.SslGrade)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var current DomainEvaluation
+	flush := func() error {
+		if current.Id == 0 || !filter.Match(current) {
+			return nil
+		}
+		return fn(current)
+	}
+	for rows.Next() {
+		var de DomainEvaluation
+		var serverId sql.NullInt64
+		var address, sslGrade, country, owner sql.NullString
+		err = rows.Scan(&de.Id, &de.Domain, &de.EvaluationHour, &de.EvaluationInProgress, &de.SslGrade,
+			&de.Logo, &de.Title, &de.IsDown, &de.RequestId, &serverId, &address, &sslGrade, &country, &owner)
+		if err != nil {
+			return err
+		}
+		if de.Id != current.Id {
+			if err = flush(); err != nil {
+				return err
+			}
+			current = de
+			current.Servers = make([]Server, 0)
+		}
+		if serverId.Valid {
+			current.Servers = append(current.Servers, Server{Id: int(serverId.Int64), Address: address.String,
+				SslGrade: sslGrade.String, Country: country.String, Owner: owner.String})
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
@@ -0,0 +1,571 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore - Implementation of the Store interface keeping the evaluations
+// in memory. It's meant for tests and local runs without a database.
+type MemoryStore struct {
+	mu          sync.Mutex
+	evaluations []DomainEvaluation
+	lastID      int
+	lastServer  int
+	locks       map[string]memoryLock
+	apiKeys     []APIKey
+	apiKeyUsage []APIKeyUsage
+	buckets     map[string]RateLimitBucket
+	batches     map[string]Batch
+	watched     map[string]WatchedDomain
+	approved    map[string]ApprovedBaseline
+}
+
+// memoryLock - Struct representing an evaluation lock in the MemoryStore.
+type memoryLock struct {
+	owner     string
+	expiresAt time.Time
+}
+
+// Default constructor for the MemoryStore struct.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{locks: make(map[string]memoryLock), buckets: make(map[string]RateLimitBucket),
+		batches: make(map[string]Batch), watched: make(map[string]WatchedDomain),
+		approved: make(map[string]ApprovedBaseline)}
+}
+
+// Auxiliar function for copying a list of servers, so the store never shares
+// memory with its callers.
+func copyServers(servers []Server) []Server {
+	c := make([]Server, len(servers))
+	copy(c, servers)
+	return c
+}
+
+// Auxiliar method for getting the index of the evaluation with the given id.
+func (m *MemoryStore) indexOf(id int) (int, error) {
+	for i := range m.evaluations {
+		if m.evaluations[i].Id == id {
+			return i, nil
+		}
+	}
+	return 0, errors.New("No rows were returned.")
+}
+
+// Auxiliar method for giving ids to the servers of an evaluation.
+func (m *MemoryStore) numberServers(de *DomainEvaluation) {
+	for i := range de.Servers {
+		m.lastServer++
+		de.Servers[i].Id = m.lastServer
+	}
+}
+
+// SearchLastEvaluation
+// Implementation of the method SearchLastEvaluation from the Store interface.
+func (m *MemoryStore) SearchLastEvaluation(ctx context.Context, domainName string, inProgress bool,
+	upperBound time.Time) (de DomainEvaluation, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	highest := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, v := range m.evaluations {
+		if v.Domain != domainName || v.EvaluationInProgress != inProgress {
+			continue
+		}
+		var d time.Time
+		d, err = time.Parse(time.RFC3339, v.EvaluationHour)
+		if err != nil {
+			return
+		}
+		if d.After(highest) && d.Before(upperBound) {
+			highest = d
+			de = v
+			de.Servers = nil
+		}
+	}
+	return
+}
+
+// FindEvaluation
+// Implementation of the method FindEvaluation from the Store interface.
+func (m *MemoryStore) FindEvaluation(ctx context.Context, id int) (DomainEvaluation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, err := m.indexOf(id)
+	if err != nil {
+		return DomainEvaluation{}, nil
+	}
+	de := m.evaluations[i]
+	de.Servers = copyServers(de.Servers)
+	return de, nil
+}
+
+// CreateEvaluation
+// Implementation of the method CreateEvaluation from the Store interface.
+func (m *MemoryStore) CreateEvaluation(ctx context.Context, de *DomainEvaluation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastID++
+	de.Id = m.lastID
+	m.numberServers(de)
+	stored := *de
+	stored.Servers = copyServers(de.Servers)
+	m.evaluations = append(m.evaluations, stored)
+	return nil
+}
+
+// UpdateEvaluation
+// Implementation of the method UpdateEvaluation from the Store interface.
+func (m *MemoryStore) UpdateEvaluation(ctx context.Context, de *DomainEvaluation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, err := m.indexOf(de.Id)
+	if err != nil {
+		return err
+	}
+	stored := *de
+	if len(de.Servers) > 0 {
+		m.numberServers(de)
+		stored.Servers = copyServers(de.Servers)
+	} else {
+		stored.Servers = m.evaluations[i].Servers
+	}
+	m.evaluations[i] = stored
+	return nil
+}
+
+// UpdateEvaluationHour
+// Implementation of the method UpdateEvaluationHour from the Store interface.
+func (m *MemoryStore) UpdateEvaluationHour(ctx context.Context, de *DomainEvaluation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, err := m.indexOf(de.Id)
+	if err != nil {
+		return err
+	}
+	m.evaluations[i].EvaluationHour = de.EvaluationHour
+	return nil
+}
+
+// UpdateEnrichment
+// Implementation of the method UpdateEnrichment from the Store interface.
+func (m *MemoryStore) UpdateEnrichment(ctx context.Context, de *DomainEvaluation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, err := m.indexOf(de.Id)
+	if err != nil {
+		return err
+	}
+	stored := &m.evaluations[i]
+	stored.Logo = de.Logo
+	stored.Title = de.Title
+	for _, s := range de.Servers {
+		for j := range stored.Servers {
+			if stored.Servers[j].Id == s.Id {
+				stored.Servers[j] = s
+			}
+		}
+	}
+	return nil
+}
+
+// ListServers
+// Implementation of the method ListServers from the Store interface.
+func (m *MemoryStore) ListServers(ctx context.Context, idDomainEvaluation int) ([]Server, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, err := m.indexOf(idDomainEvaluation)
+	if err != nil {
+		return nil, nil
+	}
+	return copyServers(m.evaluations[i].Servers), nil
+}
+
+// ListRecentEvaluations
+// Implementation of the method ListRecentEvaluations from the Store interface.
+func (m *MemoryStore) ListRecentEvaluations(ctx context.Context) ([]DomainEvaluation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	recent := make(map[string]int)
+	hours := make(map[string]time.Time)
+	order := make([]string, 0)
+	for i, v := range m.evaluations {
+		d, err := time.Parse(time.RFC3339, v.EvaluationHour)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := recent[v.Domain]; !ok {
+			order = append(order, v.Domain)
+		} else if !d.After(hours[v.Domain]) {
+			continue
+		}
+		recent[v.Domain] = i
+		hours[v.Domain] = d
+	}
+	recentDomainEvaluations := make([]DomainEvaluation, 0)
+	for _, domain := range order {
+		de := m.evaluations[recent[domain]]
+		de.Servers = nil
+		recentDomainEvaluations = append(recentDomainEvaluations, de)
+	}
+	return recentDomainEvaluations, nil
+}
+
+// ListDomainHistory
+// Implementation of the method ListDomainHistory from the Store interface.
+func (m *MemoryStore) ListDomainHistory(ctx context.Context, domainName string, limit int) ([]DomainEvaluation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	history := make([]DomainEvaluation, 0)
+	for _, v := range m.evaluations {
+		if v.Domain == domainName {
+			v.Servers = nil
+			history = append(history, v)
+		}
+	}
+	return newestFirst(history, limit)
+}
+
+// ListServersByEvaluations
+// Implementation of the method ListServersByEvaluations from the Store interface.
+func (m *MemoryStore) ListServersByEvaluations(ctx context.Context, ids []int) (map[int][]Server, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	servers := make(map[int][]Server)
+	for _, id := range ids {
+		if i, err := m.indexOf(id); err == nil && len(m.evaluations[i].Servers) > 0 {
+			servers[id] = copyServers(m.evaluations[i].Servers)
+		}
+	}
+	return servers, nil
+}
+
+// ExportEvaluations
+// Implementation of the method ExportEvaluations from the Store interface.
+// The evaluations are copied first, so fn runs without holding the lock.
+func (m *MemoryStore) ExportEvaluations(ctx context.Context, filter EvaluationFilter,
+	fn func(DomainEvaluation) error) error {
+	m.mu.Lock()
+	exported := make([]DomainEvaluation, 0)
+	for _, v := range m.evaluations {
+		if filter.Match(v) {
+			v.Servers = copyServers(v.Servers)
+			exported = append(exported, v)
+		}
+	}
+	m.mu.Unlock()
+	for _, de := range exported {
+		if err := fn(de); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AcquireEvaluationLock
+// Implementation of the method AcquireEvaluationLock from the Store interface.
+func (m *MemoryStore) AcquireEvaluationLock(ctx context.Context, domainName string, owner string,
+	ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if lock, ok := m.locks[domainName]; ok && lock.owner != owner && lock.expiresAt.After(now) {
+		return false, nil
+	}
+	m.locks[domainName] = memoryLock{owner: owner, expiresAt: now.Add(ttl)}
+	return true, nil
+}
+
+// ReleaseEvaluationLock
+// Implementation of the method ReleaseEvaluationLock from the Store interface.
+func (m *MemoryStore) ReleaseEvaluationLock(ctx context.Context, domainName string, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if lock, ok := m.locks[domainName]; ok && lock.owner == owner {
+		delete(m.locks, domainName)
+	}
+	return nil
+}
+
+// Ping
+// Implementation of the method Ping from the Store interface.
+func (m *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// MigrationVersion
+// Implementation of the method MigrationVersion from the Store interface.
+// The MemoryStore has no schema, so it's always up to date.
+func (m *MemoryStore) MigrationVersion(ctx context.Context) (int, error) {
+	return LatestMigrationVersion, nil
+}
+
+// CreateAPIKey
+// Implementation of the method CreateAPIKey from the KeyStore interface.
+func (m *MemoryStore) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range m.apiKeys {
+		if k.KeyHash == key.KeyHash {
+			return errors.New("Duplicated API key.")
+		}
+	}
+	key.Id = len(m.apiKeys) + 1
+	m.apiKeys = append(m.apiKeys, *key)
+	return nil
+}
+
+// FindAPIKey
+// Implementation of the method FindAPIKey from the KeyStore interface.
+func (m *MemoryStore) FindAPIKey(ctx context.Context, keyHash string) (APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range m.apiKeys {
+		if k.KeyHash == keyHash {
+			return k, nil
+		}
+	}
+	return APIKey{}, nil
+}
+
+// FindAPIKeyById
+// Implementation of the method FindAPIKeyById from the KeyStore interface.
+func (m *MemoryStore) FindAPIKeyById(ctx context.Context, id int) (APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range m.apiKeys {
+		if k.Id == id {
+			return k, nil
+		}
+	}
+	return APIKey{}, nil
+}
+
+// ListAPIKeys
+// Implementation of the method ListAPIKeys from the KeyStore interface.
+func (m *MemoryStore) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append(make([]APIKey, 0, len(m.apiKeys)), m.apiKeys...), nil
+}
+
+// RevokeAPIKey
+// Implementation of the method RevokeAPIKey from the KeyStore interface.
+func (m *MemoryStore) RevokeAPIKey(ctx context.Context, id int, revokedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.apiKeys {
+		if m.apiKeys[i].Id == id {
+			if m.apiKeys[i].RevokedAt == nil {
+				m.apiKeys[i].RevokedAt = &revokedAt
+			}
+			return nil
+		}
+	}
+	return ErrAPIKeyNotFound
+}
+
+// Auxiliar method for getting the usage of a key during a day.
+func (m *MemoryStore) usageOf(keyId int, day string) *APIKeyUsage {
+	for i := range m.apiKeyUsage {
+		if m.apiKeyUsage[i].KeyId == keyId && m.apiKeyUsage[i].Day == day {
+			return &m.apiKeyUsage[i]
+		}
+	}
+	m.apiKeyUsage = append(m.apiKeyUsage, APIKeyUsage{KeyId: keyId, Day: day})
+	return &m.apiKeyUsage[len(m.apiKeyUsage)-1]
+}
+
+// CountRequest
+// Implementation of the method CountRequest from the KeyStore interface.
+func (m *MemoryStore) CountRequest(ctx context.Context, keyId int, day string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usageOf(keyId, day).Requests++
+	return nil
+}
+
+// ConsumeEvaluation
+// Implementation of the method ConsumeEvaluation from the KeyStore interface.
+func (m *MemoryStore) ConsumeEvaluation(ctx context.Context, keyId int, day string, quota int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usage := m.usageOf(keyId, day)
+	if usage.Evaluations >= quota {
+		return false, nil
+	}
+	usage.Evaluations++
+	return true, nil
+}
+
+// ListAPIKeyUsage
+// Implementation of the method ListAPIKeyUsage from the KeyStore interface.
+func (m *MemoryStore) ListAPIKeyUsage(ctx context.Context, keyId int) ([]APIKeyUsage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usage := make([]APIKeyUsage, 0)
+	for i := len(m.apiKeyUsage) - 1; i >= 0; i-- {
+		if m.apiKeyUsage[i].KeyId == keyId {
+			usage = append(usage, m.apiKeyUsage[i])
+		}
+	}
+	return usage, nil
+}
+
+// UpdateRateLimitBucket
+// Implementation of the method UpdateRateLimitBucket from the BucketStore interface.
+func (m *MemoryStore) UpdateRateLimitBucket(ctx context.Context, key string,
+	update func(b *RateLimitBucket, found bool)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, found := m.buckets[key]
+	b.Key = key
+	update(&b, found)
+	m.buckets[key] = b
+	return nil
+}
+
+// DeleteRateLimitBuckets
+// Implementation of the method DeleteRateLimitBuckets from the BucketStore interface.
+func (m *MemoryStore) DeleteRateLimitBuckets(ctx context.Context, before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, b := range m.buckets {
+		if b.UpdatedAt.Before(before) {
+			delete(m.buckets, key)
+		}
+	}
+	return nil
+}
+
+// CreateBatch
+// Implementation of the method CreateBatch from the BatchStore interface.
+func (m *MemoryStore) CreateBatch(ctx context.Context, b *Batch) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, found := m.batches[b.Id]; found {
+		return errors.New("Duplicated batch.")
+	}
+	c := *b
+	c.Items = append(make([]BatchItem, 0, len(b.Items)), b.Items...)
+	m.batches[b.Id] = c
+	return nil
+}
+
+// UpdateBatchItem
+// Implementation of the method UpdateBatchItem from the BatchStore interface.
+func (m *MemoryStore) UpdateBatchItem(ctx context.Context, batchId string, item BatchItem) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := m.batches[batchId]
+	for i := range b.Items {
+		if b.Items[i].Position == item.Position {
+			b.Items[i] = item
+		}
+	}
+	return nil
+}
+
+// FindBatch
+// Implementation of the method FindBatch from the BatchStore interface.
+func (m *MemoryStore) FindBatch(ctx context.Context, id string) (Batch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, found := m.batches[id]
+	if !found {
+		return Batch{}, nil
+	}
+	b.Items = append(make([]BatchItem, 0, len(b.Items)), b.Items...)
+	return b, nil
+}
+
+// ListBatchIds
+// Implementation of the method ListBatchIds from the BatchStore interface.
+func (m *MemoryStore) ListBatchIds(ctx context.Context, statuses []string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	wanted := make(map[string]bool)
+	for _, status := range statuses {
+		wanted[status] = true
+	}
+	ids := make([]string, 0)
+	for id, b := range m.batches {
+		for _, item := range b.Items {
+			if wanted[item.Status] {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// AddWatchedDomain
+// Implementation of the method AddWatchedDomain from the WatchStore interface.
+func (m *MemoryStore) AddWatchedDomain(ctx context.Context, wd WatchedDomain) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, found := m.watched[wd.Domain]; !found {
+		m.watched[wd.Domain] = wd
+	}
+	return nil
+}
+
+// RemoveWatchedDomain
+// Implementation of the method RemoveWatchedDomain from the WatchStore interface.
+func (m *MemoryStore) RemoveWatchedDomain(ctx context.Context, domain string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, found := m.watched[domain]
+	delete(m.watched, domain)
+	return found, nil
+}
+
+// ListWatchedDomains
+// Implementation of the method ListWatchedDomains from the WatchStore interface.
+func (m *MemoryStore) ListWatchedDomains(ctx context.Context) ([]WatchedDomain, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	watched := make([]WatchedDomain, 0, len(m.watched))
+	for _, wd := range m.watched {
+		watched = append(watched, wd)
+	}
+	sort.Slice(watched, func(i, j int) bool { return watched[i].Domain < watched[j].Domain })
+	return watched, nil
+}
+
+// SetApprovedBaseline
+// Implementation of the method SetApprovedBaseline from the ApprovedBaselineStore interface.
+func (m *MemoryStore) SetApprovedBaseline(ctx context.Context, ab ApprovedBaseline) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ab.Servers = copyServers(ab.Servers)
+	m.approved[ab.Domain] = ab
+	return nil
+}
+
+// ClearApprovedBaseline
+// Implementation of the method ClearApprovedBaseline from the ApprovedBaselineStore interface.
+func (m *MemoryStore) ClearApprovedBaseline(ctx context.Context, domain string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, found := m.approved[domain]
+	delete(m.approved, domain)
+	return found, nil
+}
+
+// FindApprovedBaseline
+// Implementation of the method FindApprovedBaseline from the ApprovedBaselineStore interface.
+func (m *MemoryStore) FindApprovedBaseline(ctx context.Context, domain string) (ApprovedBaseline, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ab, found := m.approved[domain]
+	if !found {
+		return ApprovedBaseline{}, nil
+	}
+	ab.Servers = copyServers(ab.Servers)
+	return ab, nil
+}
@@ -0,0 +1,99 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/cockroachdb/cockroach-go/crdb"
+)
+
+// Ordered list of the statements building the schema of the database.
+// The version of the schema is the number of migrations applied, so new
+// migrations are always appended at the end of the list.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS domainEvaluation (id SERIAL PRIMARY KEY,
+		domain VARCHAR(100), EvaluationHour VARCHAR(30), EvaluationInProgress boolean,
+		sslGrade VARCHAR(5), logo VARCHAR(80), title VARCHAR(80), isDown boolean);`,
+	`CREATE TABLE IF NOT EXISTS server (id SERIAL PRIMARY KEY,
+		domainEvaluationId integer, address VARCHAR(50), sslGrade VARCHAR(5), country VARCHAR(20),
+		owner VARCHAR(50), FOREIGN KEY(domainEvaluationId) REFERENCES domainEvaluation(id));`,
+	`CREATE TABLE IF NOT EXISTS evaluationLock (domain VARCHAR(100) PRIMARY KEY,
+		owner VARCHAR(64), expiresAt TIMESTAMPTZ);`,
+	`ALTER TABLE domainEvaluation ADD COLUMN IF NOT EXISTS requestId VARCHAR(64) NOT NULL DEFAULT '';`,
+	`CREATE TABLE IF NOT EXISTS apiKey (id SERIAL PRIMARY KEY, name VARCHAR(100),
+		prefix VARCHAR(12), keyHash VARCHAR(64) UNIQUE, rateLimit integer, dailyQuota integer,
+		createdAt TIMESTAMPTZ, revokedAt TIMESTAMPTZ);`,
+	`CREATE TABLE IF NOT EXISTS apiKeyUsage (keyId integer REFERENCES apiKey(id), day VARCHAR(10),
+		requests integer, evaluations integer, PRIMARY KEY (keyId, day));`,
+	`CREATE TABLE IF NOT EXISTS rateLimitBucket (bucketKey VARCHAR(200) PRIMARY KEY, tokens FLOAT,
+		updatedAt TIMESTAMPTZ);`,
+	`CREATE TABLE IF NOT EXISTS batch (id VARCHAR(32) PRIMARY KEY, createdAt TIMESTAMPTZ);`,
+	`CREATE TABLE IF NOT EXISTS batchItem (batchId VARCHAR(32) REFERENCES batch(id), position integer,
+		domain VARCHAR(100), status VARCHAR(20), sslGrade VARCHAR(5), isDown boolean, errors TEXT,
+		updatedAt TIMESTAMPTZ, PRIMARY KEY (batchId, position));`,
+	`CREATE TABLE IF NOT EXISTS watchedDomain (domain VARCHAR(100) PRIMARY KEY, addedAt TIMESTAMPTZ);`,
+	`CREATE TABLE IF NOT EXISTS approvedBaseline (domain VARCHAR(100) PRIMARY KEY, evaluationId integer,
+		minGrade VARCHAR(5), servers TEXT, approvedAt TIMESTAMPTZ);`,
+}
+
+// Version of the schema expected by this build.
+var LatestMigrationVersion = len(migrations)
+
+// Function for creating the schemaMigration table, which stores the
+// migrations already applied.
+func initSchemaMigrationTable(ctx context.Context, dbc *sql.DB) error {
+	sqlStatement := `CREATE TABLE IF NOT EXISTS schemaMigration (version integer PRIMARY KEY,
+		appliedAt TIMESTAMPTZ DEFAULT now());`
+	_, err := Exec(ctx, dbc, sqlStatement)
+	return err
+}
+
+// MigrationVersion
+// Function for getting the version of the schema of the database, that is,
+// the number of migrations applied. It's 0 in an empty database, and it only
+// reads the database, so it can be used by the readiness probes.
+func MigrationVersion(ctx context.Context, dbc *sql.DB) (int, error) {
+	sqlStatement := `SELECT EXISTS (SELECT 1 FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_name = 'schemamigration');`
+	row, err := QueryRow(ctx, dbc, sqlStatement)
+	if err != nil {
+		return 0, err
+	}
+	var exists bool
+	if err = row.Scan(&exists); err != nil || !exists {
+		return 0, err
+	}
+	row, err = QueryRow(ctx, dbc, `SELECT COALESCE(MAX(version), 0) FROM schemaMigration;`)
+	if err != nil {
+		return 0, err
+	}
+	var version int
+	err = row.Scan(&version)
+	return version, err
+}
+
+// Migrate
+// Function for applying the pending migrations. Every migration runs in its
+// own transaction together with the row recording it.
+func Migrate(ctx context.Context, dbc *sql.DB) error {
+	if err := initSchemaMigrationTable(ctx, dbc); err != nil {
+		return err
+	}
+	version, err := MigrationVersion(ctx, dbc)
+	if err != nil {
+		return err
+	}
+	for i := version; i < len(migrations); i++ {
+		err = crdb.ExecuteTx(ctx, dbc, nil, func(tx *sql.Tx) error {
+			if _, err := Exec(ctx, tx, migrations[i]); err != nil {
+				return err
+			}
+			_, err := Exec(ctx, tx, `INSERT INTO schemaMigration (version) VALUES ($1);`, i+1)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
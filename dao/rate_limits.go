@@ -0,0 +1,59 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cockroachdb/cockroach-go/crdb"
+)
+
+// RateLimitBucket - Struct for the representation of the token bucket of a
+// rate limiter, shared by every API replica.
+type RateLimitBucket struct {
+	Key       string    // VARCHAR[200] PRIMARY KEY
+	Tokens    float64   // FLOAT
+	UpdatedAt time.Time // TIMESTAMPTZ
+}
+
+// BucketStore interface: Declaration of the operations over the token buckets
+// of the rate limiters.
+type BucketStore interface {
+	// UpdateRateLimitBucket reads the bucket of key and stores the changes
+	// made by update, atomically. found is false when the bucket doesn't exist yet.
+	UpdateRateLimitBucket(ctx context.Context, key string, update func(b *RateLimitBucket, found bool)) error
+	// DeleteRateLimitBuckets deletes the buckets not updated since before.
+	DeleteRateLimitBuckets(ctx context.Context, before time.Time) error
+}
+
+// UpdateRateLimitBucket
+// Function for updating a token bucket inside a transaction. The bucket is
+// read FOR UPDATE, so concurrent requests of different replicas can't take
+// the same token.
+func UpdateRateLimitBucket(ctx context.Context, key string, update func(b *RateLimitBucket, found bool),
+	dbc *sql.DB) error {
+	return crdb.ExecuteTx(ctx, dbc, nil, func(tx *sql.Tx) error {
+		b := RateLimitBucket{Key: key}
+		sqlStatement := `SELECT tokens, updatedAt FROM rateLimitBucket WHERE bucketKey = $1 FOR UPDATE;`
+		row, err := QueryRow(ctx, tx, sqlStatement, key)
+		if err != nil {
+			return err
+		}
+		err = row.Scan(&b.Tokens, &b.UpdatedAt)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		update(&b, err == nil)
+		sqlStatement = `INSERT INTO rateLimitBucket (bucketKey, tokens, updatedAt) VALUES ($1, $2, $3)
+			ON CONFLICT (bucketKey) DO UPDATE SET tokens = excluded.tokens, updatedAt = excluded.updatedAt;`
+		_, err = Exec(ctx, tx, sqlStatement, key, b.Tokens, b.UpdatedAt)
+		return err
+	})
+}
+
+// DeleteRateLimitBuckets
+// Function for deleting the token buckets not updated since before.
+func DeleteRateLimitBuckets(ctx context.Context, before time.Time, dbc interface{}) error {
+	_, err := Exec(ctx, dbc, `DELETE FROM rateLimitBucket WHERE updatedAt < $1;`, before)
+	return err
+}
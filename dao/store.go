@@ -0,0 +1,293 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cockroachdb/cockroach-go/crdb"
+)
+
+// Store interface: Declaration of the operations the controller needs over
+// the stored evaluations. Writes that touch more than one row are atomic, so
+// a cancelled context never leaves an evaluation partially written.
+type Store interface {
+	// SearchLastEvaluation returns the last evaluation of domainName, either in
+	// progress or ready, done before upperBound. The Id is 0 when there is none.
+	SearchLastEvaluation(ctx context.Context, domainName string, inProgress bool, upperBound time.Time) (DomainEvaluation, error)
+	// FindEvaluation returns the evaluation with the given id, with its
+	// servers. The Id is 0 when there is none.
+	FindEvaluation(ctx context.Context, id int) (DomainEvaluation, error)
+	// CreateEvaluation stores the evaluation and its servers, setting their ids.
+	CreateEvaluation(ctx context.Context, de *DomainEvaluation) error
+	// UpdateEvaluation replaces the evaluation with the given id and its servers.
+	UpdateEvaluation(ctx context.Context, de *DomainEvaluation) error
+	// UpdateEvaluationHour updates only the hour of the evaluation.
+	UpdateEvaluationHour(ctx context.Context, de *DomainEvaluation) error
+	// UpdateEnrichment updates the logo, the title and the country and owner
+	// of the servers of the evaluation.
+	UpdateEnrichment(ctx context.Context, de *DomainEvaluation) error
+	// ListServers lists the servers of the evaluation with the given id.
+	ListServers(ctx context.Context, idDomainEvaluation int) ([]Server, error)
+	// ListRecentEvaluations lists the last evaluation of every domain.
+	ListRecentEvaluations(ctx context.Context) ([]DomainEvaluation, error)
+	// ListDomainHistory lists the evaluations of a domain, the newest first.
+	// When limit is greater than zero, at most limit evaluations are listed.
+	ListDomainHistory(ctx context.Context, domainName string, limit int) ([]DomainEvaluation, error)
+	// ListServersByEvaluations lists the servers of the evaluations with the
+	// given ids, grouped by evaluation id.
+	ListServersByEvaluations(ctx context.Context, ids []int) (map[int][]Server, error)
+	// ExportEvaluations passes every evaluation passing the filter to fn, with
+	// its servers, in the order they were created. It stops at the first error of fn.
+	ExportEvaluations(ctx context.Context, filter EvaluationFilter, fn func(DomainEvaluation) error) error
+	// AcquireEvaluationLock takes the evaluation lock of a domain for owner.
+	AcquireEvaluationLock(ctx context.Context, domainName string, owner string, ttl time.Duration) (bool, error)
+	// ReleaseEvaluationLock releases the evaluation lock of a domain held by owner.
+	ReleaseEvaluationLock(ctx context.Context, domainName string, owner string) error
+	// Ping checks that the store is reachable.
+	Ping(ctx context.Context) error
+	// MigrationVersion returns the version of the schema of the store.
+	MigrationVersion(ctx context.Context) (int, error)
+	// Operations over the API keys.
+	KeyStore
+	// Operations over the token buckets of the rate limiters.
+	BucketStore
+	// Operations over the batches of evaluations.
+	BatchStore
+	// Operations over the watched domains.
+	WatchStore
+	// Operations over the approved baselines of the domains.
+	ApprovedBaselineStore
+}
+
+// SQLStore - Implementation of the Store interface over a CockroachDB
+// (or PostgreSQL) database.
+type SQLStore struct {
+	DB *sql.DB
+}
+
+// Default constructor for the SQLStore struct.
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{DB: db}
+}
+
+// SearchLastEvaluation
+// Implementation of the method SearchLastEvaluation from the Store interface.
+func (s *SQLStore) SearchLastEvaluation(ctx context.Context, domainName string, inProgress bool,
+	upperBound time.Time) (de DomainEvaluation, err error) {
+	err = de.SearchLastEvaluation(ctx, domainName, inProgress, upperBound, s.DB)
+	return
+}
+
+// FindEvaluation
+// Implementation of the method FindEvaluation from the Store interface.
+func (s *SQLStore) FindEvaluation(ctx context.Context, id int) (DomainEvaluation, error) {
+	return FindEvaluation(ctx, id, s.DB)
+}
+
+// CreateEvaluation
+// Implementation of the method CreateEvaluation from the Store interface.
+func (s *SQLStore) CreateEvaluation(ctx context.Context, de *DomainEvaluation) error {
+	return crdb.ExecuteTx(ctx, s.DB, nil, func(tx *sql.Tx) error {
+		return de.CreateInDB(ctx, tx)
+	})
+}
+
+// UpdateEvaluation
+// Implementation of the method UpdateEvaluation from the Store interface.
+func (s *SQLStore) UpdateEvaluation(ctx context.Context, de *DomainEvaluation) error {
+	return crdb.ExecuteTx(ctx, s.DB, nil, func(tx *sql.Tx) error {
+		return de.UpdateInDB(ctx, tx)
+	})
+}
+
+// UpdateEvaluationHour
+// Implementation of the method UpdateEvaluationHour from the Store interface.
+func (s *SQLStore) UpdateEvaluationHour(ctx context.Context, de *DomainEvaluation) error {
+	return de.UpdateHourInDb(ctx, s.DB)
+}
+
+// UpdateEnrichment
+// Implementation of the method UpdateEnrichment from the Store interface.
+func (s *SQLStore) UpdateEnrichment(ctx context.Context, de *DomainEvaluation) error {
+	return crdb.ExecuteTx(ctx, s.DB, nil, func(tx *sql.Tx) error {
+		return de.UpdateEnrichmentInDB(ctx, tx)
+	})
+}
+
+// ListServers
+// Implementation of the method ListServers from the Store interface.
+func (s *SQLStore) ListServers(ctx context.Context, idDomainEvaluation int) ([]Server, error) {
+	return ListServersID(ctx, idDomainEvaluation, s.DB)
+}
+
+// ListRecentEvaluations
+// Implementation of the method ListRecentEvaluations from the Store interface.
+func (s *SQLStore) ListRecentEvaluations(ctx context.Context) ([]DomainEvaluation, error) {
+	return ListRecentDomainEvaluations(ctx, s.DB)
+}
+
+// ListDomainHistory
+// Implementation of the method ListDomainHistory from the Store interface.
+func (s *SQLStore) ListDomainHistory(ctx context.Context, domainName string, limit int) ([]DomainEvaluation, error) {
+	return ListDomainHistory(ctx, domainName, limit, s.DB)
+}
+
+// ListServersByEvaluations
+// Implementation of the method ListServersByEvaluations from the Store interface.
+func (s *SQLStore) ListServersByEvaluations(ctx context.Context, ids []int) (map[int][]Server, error) {
+	return ListServersByEvaluations(ctx, ids, s.DB)
+}
+
+// ExportEvaluations
+// Implementation of the method ExportEvaluations from the Store interface.
+func (s *SQLStore) ExportEvaluations(ctx context.Context, filter EvaluationFilter,
+	fn func(DomainEvaluation) error) error {
+	return ExportEvaluations(ctx, filter, fn, s.DB)
+}
+
+// AcquireEvaluationLock
+// Implementation of the method AcquireEvaluationLock from the Store interface.
+func (s *SQLStore) AcquireEvaluationLock(ctx context.Context, domainName string, owner string,
+	ttl time.Duration) (bool, error) {
+	return AcquireEvaluationLock(ctx, domainName, owner, ttl, s.DB)
+}
+
+// ReleaseEvaluationLock
+// Implementation of the method ReleaseEvaluationLock from the Store interface.
+func (s *SQLStore) ReleaseEvaluationLock(ctx context.Context, domainName string, owner string) error {
+	return ReleaseEvaluationLock(ctx, domainName, owner, s.DB)
+}
+
+// Ping
+// Implementation of the method Ping from the Store interface.
+func (s *SQLStore) Ping(ctx context.Context) error {
+	return s.DB.PingContext(ctx)
+}
+
+// MigrationVersion
+// Implementation of the method MigrationVersion from the Store interface.
+func (s *SQLStore) MigrationVersion(ctx context.Context) (int, error) {
+	return MigrationVersion(ctx, s.DB)
+}
+
+// CreateAPIKey
+// Implementation of the method CreateAPIKey from the KeyStore interface.
+func (s *SQLStore) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	return CreateAPIKey(ctx, key, s.DB)
+}
+
+// FindAPIKey
+// Implementation of the method FindAPIKey from the KeyStore interface.
+func (s *SQLStore) FindAPIKey(ctx context.Context, keyHash string) (APIKey, error) {
+	return FindAPIKey(ctx, keyHash, s.DB)
+}
+
+// FindAPIKeyById
+// Implementation of the method FindAPIKeyById from the KeyStore interface.
+func (s *SQLStore) FindAPIKeyById(ctx context.Context, id int) (APIKey, error) {
+	return FindAPIKeyById(ctx, id, s.DB)
+}
+
+// ListAPIKeys
+// Implementation of the method ListAPIKeys from the KeyStore interface.
+func (s *SQLStore) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	return ListAPIKeys(ctx, s.DB)
+}
+
+// RevokeAPIKey
+// Implementation of the method RevokeAPIKey from the KeyStore interface.
+func (s *SQLStore) RevokeAPIKey(ctx context.Context, id int, revokedAt time.Time) error {
+	return RevokeAPIKey(ctx, id, revokedAt, s.DB)
+}
+
+// CountRequest
+// Implementation of the method CountRequest from the KeyStore interface.
+func (s *SQLStore) CountRequest(ctx context.Context, keyId int, day string) error {
+	return CountRequest(ctx, keyId, day, s.DB)
+}
+
+// ConsumeEvaluation
+// Implementation of the method ConsumeEvaluation from the KeyStore interface.
+func (s *SQLStore) ConsumeEvaluation(ctx context.Context, keyId int, day string, quota int) (bool, error) {
+	return ConsumeEvaluation(ctx, keyId, day, quota, s.DB)
+}
+
+// ListAPIKeyUsage
+// Implementation of the method ListAPIKeyUsage from the KeyStore interface.
+func (s *SQLStore) ListAPIKeyUsage(ctx context.Context, keyId int) ([]APIKeyUsage, error) {
+	return ListAPIKeyUsage(ctx, keyId, s.DB)
+}
+
+// UpdateRateLimitBucket
+// Implementation of the method UpdateRateLimitBucket from the BucketStore interface.
+func (s *SQLStore) UpdateRateLimitBucket(ctx context.Context, key string,
+	update func(b *RateLimitBucket, found bool)) error {
+	return UpdateRateLimitBucket(ctx, key, update, s.DB)
+}
+
+// DeleteRateLimitBuckets
+// Implementation of the method DeleteRateLimitBuckets from the BucketStore interface.
+func (s *SQLStore) DeleteRateLimitBuckets(ctx context.Context, before time.Time) error {
+	return DeleteRateLimitBuckets(ctx, before, s.DB)
+}
+
+// CreateBatch
+// Implementation of the method CreateBatch from the BatchStore interface.
+func (s *SQLStore) CreateBatch(ctx context.Context, b *Batch) error {
+	return CreateBatch(ctx, b, s.DB)
+}
+
+// UpdateBatchItem
+// Implementation of the method UpdateBatchItem from the BatchStore interface.
+func (s *SQLStore) UpdateBatchItem(ctx context.Context, batchId string, item BatchItem) error {
+	return UpdateBatchItem(ctx, batchId, item, s.DB)
+}
+
+// FindBatch
+// Implementation of the method FindBatch from the BatchStore interface.
+func (s *SQLStore) FindBatch(ctx context.Context, id string) (Batch, error) {
+	return FindBatch(ctx, id, s.DB)
+}
+
+// ListBatchIds
+// Implementation of the method ListBatchIds from the BatchStore interface.
+func (s *SQLStore) ListBatchIds(ctx context.Context, statuses []string) ([]string, error) {
+	return ListBatchIds(ctx, statuses, s.DB)
+}
+
+// AddWatchedDomain
+// Implementation of the method AddWatchedDomain from the WatchStore interface.
+func (s *SQLStore) AddWatchedDomain(ctx context.Context, wd WatchedDomain) error {
+	return AddWatchedDomain(ctx, wd, s.DB)
+}
+
+// RemoveWatchedDomain
+// Implementation of the method RemoveWatchedDomain from the WatchStore interface.
+func (s *SQLStore) RemoveWatchedDomain(ctx context.Context, domain string) (bool, error) {
+	return RemoveWatchedDomain(ctx, domain, s.DB)
+}
+
+// ListWatchedDomains
+// Implementation of the method ListWatchedDomains from the WatchStore interface.
+func (s *SQLStore) ListWatchedDomains(ctx context.Context) ([]WatchedDomain, error) {
+	return ListWatchedDomains(ctx, s.DB)
+}
+
+// SetApprovedBaseline
+// Implementation of the method SetApprovedBaseline from the ApprovedBaselineStore interface.
+func (s *SQLStore) SetApprovedBaseline(ctx context.Context, ab ApprovedBaseline) error {
+	return SetApprovedBaseline(ctx, ab, s.DB)
+}
+
+// ClearApprovedBaseline
+// Implementation of the method ClearApprovedBaseline from the ApprovedBaselineStore interface.
+func (s *SQLStore) ClearApprovedBaseline(ctx context.Context, domain string) (bool, error) {
+	return ClearApprovedBaseline(ctx, domain, s.DB)
+}
+
+// FindApprovedBaseline
+// Implementation of the method FindApprovedBaseline from the ApprovedBaselineStore interface.
+func (s *SQLStore) FindApprovedBaseline(ctx context.Context, domain string) (ApprovedBaseline, error) {
+	return FindApprovedBaseline(ctx, domain, s.DB)
+}
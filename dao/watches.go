@@ -0,0 +1,63 @@
+package dao
+
+import (
+	"context"
+	"time"
+)
+
+// WatchedDomain - Struct for the representation of a domain evaluated
+// periodically by the server, without waiting for the clients to ask for it.
+type WatchedDomain struct {
+	Domain  string    `json:"domain"`   // VARCHAR[100] PRIMARY KEY
+	AddedAt time.Time `json:"added_at"` // TIMESTAMPTZ
+}
+
+// WatchStore interface: Declaration of the operations over the watched domains.
+type WatchStore interface {
+	// AddWatchedDomain adds the domain to the watched ones. Adding a domain
+	// already watched keeps its AddedAt.
+	AddWatchedDomain(ctx context.Context, wd WatchedDomain) error
+	// RemoveWatchedDomain removes the domain from the watched ones, it returns
+	// false when the domain wasn't watched.
+	RemoveWatchedDomain(ctx context.Context, domain string) (bool, error)
+	// ListWatchedDomains lists the watched domains by name.
+	ListWatchedDomains(ctx context.Context) ([]WatchedDomain, error)
+}
+
+// AddWatchedDomain
+// Function for adding a domain to the watched ones.
+func AddWatchedDomain(ctx context.Context, wd WatchedDomain, dbc interface{}) error {
+	sqlStatement := `INSERT INTO watchedDomain (domain, addedAt) VALUES ($1, $2) ON CONFLICT (domain) DO NOTHING;`
+	_, err := Exec(ctx, dbc, sqlStatement, wd.Domain, wd.AddedAt)
+	return err
+}
+
+// RemoveWatchedDomain
+// Function for removing a domain from the watched ones.
+func RemoveWatchedDomain(ctx context.Context, domain string, dbc interface{}) (bool, error) {
+	res, err := Exec(ctx, dbc, `DELETE FROM watchedDomain WHERE domain = $1;`, domain)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ListWatchedDomains
+// Function for listing the watched domains by name.
+func ListWatchedDomains(ctx context.Context, dbc interface{}) ([]WatchedDomain, error) {
+	watched := make([]WatchedDomain, 0)
+	rows, err := Query(ctx, dbc, `SELECT domain, addedAt FROM watchedDomain ORDER BY domain;`)
+	if err != nil {
+		return watched, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var wd WatchedDomain
+		if err = rows.Scan(&wd.Domain, &wd.AddedAt); err != nil {
+			return watched, err
+		}
+		watched = append(watched, wd)
+	}
+	return watched, rows.Err()
+}
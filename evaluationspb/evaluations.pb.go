@@ -0,0 +1,840 @@
+// Definition of the gRPC API of the domain evaluations, for the internal
+// services. The messages mirror the json responses of the REST API.
+//
+// After changing this file, regenerate the Go code from the root of the repo:
+//   protoc --go_out=. --go_opt=paths=source_relative \
+//     --go-grpc_out=. --go-grpc_opt=paths=source_relative \
+//     evaluationspb/evaluations.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        v5.29.3
+// source: evaluationspb/evaluations.proto
+
+package evaluationspb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// A server of a domain, with its country and owner from WHOIS.
+type Server struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Address       string                 `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	SslGrade      string                 `protobuf:"bytes,2,opt,name=ssl_grade,json=sslGrade,proto3" json:"ssl_grade,omitempty"`
+	Country       string                 `protobuf:"bytes,3,opt,name=country,proto3" json:"country,omitempty"`
+	Owner         string                 `protobuf:"bytes,4,opt,name=owner,proto3" json:"owner,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Server) Reset() {
+	*x = Server{}
+	mi := &file_evaluationspb_evaluations_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Server) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Server) ProtoMessage() {}
+
+func (x *Server) ProtoReflect() protoreflect.Message {
+	mi := &file_evaluationspb_evaluations_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Server.ProtoReflect.Descriptor instead.
+func (*Server) Descriptor() ([]byte, []int) {
+	return file_evaluationspb_evaluations_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Server) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *Server) GetSslGrade() string {
+	if x != nil {
+		return x.SslGrade
+	}
+	return ""
+}
+
+func (x *Server) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+func (x *Server) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+// Error of the application, the codes are the ones of the REST API.
+type APIError struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Code          string                 `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	Description   string                 `protobuf:"bytes,2,opt,name=description,proto3" json:"description,omitempty"`
+	ErrorMessage  string                 `protobuf:"bytes,3,opt,name=error_message,json=errorMessage,proto3" json:"error_message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *APIError) Reset() {
+	*x = APIError{}
+	mi := &file_evaluationspb_evaluations_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *APIError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*APIError) ProtoMessage() {}
+
+func (x *APIError) ProtoReflect() protoreflect.Message {
+	mi := &file_evaluationspb_evaluations_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use APIError.ProtoReflect.Descriptor instead.
+func (*APIError) Descriptor() ([]byte, []int) {
+	return file_evaluationspb_evaluations_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *APIError) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *APIError) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *APIError) GetErrorMessage() string {
+	if x != nil {
+		return x.ErrorMessage
+	}
+	return ""
+}
+
+// Complete information about a domain, as in the evaluation of the REST API.
+type DomainEvaluationComplete struct {
+	state                protoimpl.MessageState `protogen:"open.v1"`
+	EvaluationInProgress bool                   `protobuf:"varint,1,opt,name=evaluation_in_progress,json=evaluationInProgress,proto3" json:"evaluation_in_progress,omitempty"`
+	Servers              []*Server              `protobuf:"bytes,2,rep,name=servers,proto3" json:"servers,omitempty"`
+	ServersChanged       bool                   `protobuf:"varint,3,opt,name=servers_changed,json=serversChanged,proto3" json:"servers_changed,omitempty"`
+	SslGrade             string                 `protobuf:"bytes,4,opt,name=ssl_grade,json=sslGrade,proto3" json:"ssl_grade,omitempty"`
+	PreviousSslGrade     string                 `protobuf:"bytes,5,opt,name=previous_ssl_grade,json=previousSslGrade,proto3" json:"previous_ssl_grade,omitempty"`
+	Logo                 string                 `protobuf:"bytes,6,opt,name=logo,proto3" json:"logo,omitempty"`
+	Title                string                 `protobuf:"bytes,7,opt,name=title,proto3" json:"title,omitempty"`
+	IsDown               bool                   `protobuf:"varint,8,opt,name=is_down,json=isDown,proto3" json:"is_down,omitempty"`
+	unknownFields        protoimpl.UnknownFields
+	sizeCache            protoimpl.SizeCache
+}
+
+func (x *DomainEvaluationComplete) Reset() {
+	*x = DomainEvaluationComplete{}
+	mi := &file_evaluationspb_evaluations_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DomainEvaluationComplete) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DomainEvaluationComplete) ProtoMessage() {}
+
+func (x *DomainEvaluationComplete) ProtoReflect() protoreflect.Message {
+	mi := &file_evaluationspb_evaluations_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DomainEvaluationComplete.ProtoReflect.Descriptor instead.
+func (*DomainEvaluationComplete) Descriptor() ([]byte, []int) {
+	return file_evaluationspb_evaluations_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *DomainEvaluationComplete) GetEvaluationInProgress() bool {
+	if x != nil {
+		return x.EvaluationInProgress
+	}
+	return false
+}
+
+func (x *DomainEvaluationComplete) GetServers() []*Server {
+	if x != nil {
+		return x.Servers
+	}
+	return nil
+}
+
+func (x *DomainEvaluationComplete) GetServersChanged() bool {
+	if x != nil {
+		return x.ServersChanged
+	}
+	return false
+}
+
+func (x *DomainEvaluationComplete) GetSslGrade() string {
+	if x != nil {
+		return x.SslGrade
+	}
+	return ""
+}
+
+func (x *DomainEvaluationComplete) GetPreviousSslGrade() string {
+	if x != nil {
+		return x.PreviousSslGrade
+	}
+	return ""
+}
+
+func (x *DomainEvaluationComplete) GetLogo() string {
+	if x != nil {
+		return x.Logo
+	}
+	return ""
+}
+
+func (x *DomainEvaluationComplete) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *DomainEvaluationComplete) GetIsDown() bool {
+	if x != nil {
+		return x.IsDown
+	}
+	return false
+}
+
+// A stored evaluation of a domain.
+type DomainEvaluation struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Domain        string                 `protobuf:"bytes,1,opt,name=domain,proto3" json:"domain,omitempty"`
+	Hour          string                 `protobuf:"bytes,2,opt,name=hour,proto3" json:"hour,omitempty"`
+	InProgress    bool                   `protobuf:"varint,3,opt,name=in_progress,json=inProgress,proto3" json:"in_progress,omitempty"`
+	SslGrade      string                 `protobuf:"bytes,4,opt,name=ssl_grade,json=sslGrade,proto3" json:"ssl_grade,omitempty"`
+	Logo          string                 `protobuf:"bytes,5,opt,name=logo,proto3" json:"logo,omitempty"`
+	Title         string                 `protobuf:"bytes,6,opt,name=title,proto3" json:"title,omitempty"`
+	IsDown        bool                   `protobuf:"varint,7,opt,name=is_down,json=isDown,proto3" json:"is_down,omitempty"`
+	Servers       []*Server              `protobuf:"bytes,8,rep,name=servers,proto3" json:"servers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DomainEvaluation) Reset() {
+	*x = DomainEvaluation{}
+	mi := &file_evaluationspb_evaluations_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DomainEvaluation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DomainEvaluation) ProtoMessage() {}
+
+func (x *DomainEvaluation) ProtoReflect() protoreflect.Message {
+	mi := &file_evaluationspb_evaluations_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DomainEvaluation.ProtoReflect.Descriptor instead.
+func (*DomainEvaluation) Descriptor() ([]byte, []int) {
+	return file_evaluationspb_evaluations_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *DomainEvaluation) GetDomain() string {
+	if x != nil {
+		return x.Domain
+	}
+	return ""
+}
+
+func (x *DomainEvaluation) GetHour() string {
+	if x != nil {
+		return x.Hour
+	}
+	return ""
+}
+
+func (x *DomainEvaluation) GetInProgress() bool {
+	if x != nil {
+		return x.InProgress
+	}
+	return false
+}
+
+func (x *DomainEvaluation) GetSslGrade() string {
+	if x != nil {
+		return x.SslGrade
+	}
+	return ""
+}
+
+func (x *DomainEvaluation) GetLogo() string {
+	if x != nil {
+		return x.Logo
+	}
+	return ""
+}
+
+func (x *DomainEvaluation) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *DomainEvaluation) GetIsDown() bool {
+	if x != nil {
+		return x.IsDown
+	}
+	return false
+}
+
+func (x *DomainEvaluation) GetServers() []*Server {
+	if x != nil {
+		return x.Servers
+	}
+	return nil
+}
+
+type EvaluateDomainRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Domain        string                 `protobuf:"bytes,1,opt,name=domain,proto3" json:"domain,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EvaluateDomainRequest) Reset() {
+	*x = EvaluateDomainRequest{}
+	mi := &file_evaluationspb_evaluations_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EvaluateDomainRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EvaluateDomainRequest) ProtoMessage() {}
+
+func (x *EvaluateDomainRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_evaluationspb_evaluations_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EvaluateDomainRequest.ProtoReflect.Descriptor instead.
+func (*EvaluateDomainRequest) Descriptor() ([]byte, []int) {
+	return file_evaluationspb_evaluations_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *EvaluateDomainRequest) GetDomain() string {
+	if x != nil {
+		return x.Domain
+	}
+	return ""
+}
+
+type EvaluationResponse struct {
+	state         protoimpl.MessageState    `protogen:"open.v1"`
+	Domain        string                    `protobuf:"bytes,1,opt,name=domain,proto3" json:"domain,omitempty"`
+	Evaluation    *DomainEvaluationComplete `protobuf:"bytes,2,opt,name=evaluation,proto3" json:"evaluation,omitempty"`
+	Errors        []*APIError               `protobuf:"bytes,3,rep,name=errors,proto3" json:"errors,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EvaluationResponse) Reset() {
+	*x = EvaluationResponse{}
+	mi := &file_evaluationspb_evaluations_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EvaluationResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EvaluationResponse) ProtoMessage() {}
+
+func (x *EvaluationResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_evaluationspb_evaluations_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EvaluationResponse.ProtoReflect.Descriptor instead.
+func (*EvaluationResponse) Descriptor() ([]byte, []int) {
+	return file_evaluationspb_evaluations_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *EvaluationResponse) GetDomain() string {
+	if x != nil {
+		return x.Domain
+	}
+	return ""
+}
+
+func (x *EvaluationResponse) GetEvaluation() *DomainEvaluationComplete {
+	if x != nil {
+		return x.Evaluation
+	}
+	return nil
+}
+
+func (x *EvaluationResponse) GetErrors() []*APIError {
+	if x != nil {
+		return x.Errors
+	}
+	return nil
+}
+
+type GetEvaluationRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Domain        string                 `protobuf:"bytes,1,opt,name=domain,proto3" json:"domain,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetEvaluationRequest) Reset() {
+	*x = GetEvaluationRequest{}
+	mi := &file_evaluationspb_evaluations_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetEvaluationRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetEvaluationRequest) ProtoMessage() {}
+
+func (x *GetEvaluationRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_evaluationspb_evaluations_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetEvaluationRequest.ProtoReflect.Descriptor instead.
+func (*GetEvaluationRequest) Descriptor() ([]byte, []int) {
+	return file_evaluationspb_evaluations_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GetEvaluationRequest) GetDomain() string {
+	if x != nil {
+		return x.Domain
+	}
+	return ""
+}
+
+type GetEvaluationResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Unset when the domain was never evaluated.
+	Evaluation    *DomainEvaluation `protobuf:"bytes,1,opt,name=evaluation,proto3" json:"evaluation,omitempty"`
+	Errors        []*APIError       `protobuf:"bytes,2,rep,name=errors,proto3" json:"errors,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetEvaluationResponse) Reset() {
+	*x = GetEvaluationResponse{}
+	mi := &file_evaluationspb_evaluations_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetEvaluationResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetEvaluationResponse) ProtoMessage() {}
+
+func (x *GetEvaluationResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_evaluationspb_evaluations_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetEvaluationResponse.ProtoReflect.Descriptor instead.
+func (*GetEvaluationResponse) Descriptor() ([]byte, []int) {
+	return file_evaluationspb_evaluations_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *GetEvaluationResponse) GetEvaluation() *DomainEvaluation {
+	if x != nil {
+		return x.Evaluation
+	}
+	return nil
+}
+
+func (x *GetEvaluationResponse) GetErrors() []*APIError {
+	if x != nil {
+		return x.Errors
+	}
+	return nil
+}
+
+type ListRecentRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRecentRequest) Reset() {
+	*x = ListRecentRequest{}
+	mi := &file_evaluationspb_evaluations_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRecentRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRecentRequest) ProtoMessage() {}
+
+func (x *ListRecentRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_evaluationspb_evaluations_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRecentRequest.ProtoReflect.Descriptor instead.
+func (*ListRecentRequest) Descriptor() ([]byte, []int) {
+	return file_evaluationspb_evaluations_proto_rawDescGZIP(), []int{8}
+}
+
+type ListRecentResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Evaluations   []*DomainEvaluation    `protobuf:"bytes,1,rep,name=evaluations,proto3" json:"evaluations,omitempty"`
+	Errors        []*APIError            `protobuf:"bytes,2,rep,name=errors,proto3" json:"errors,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRecentResponse) Reset() {
+	*x = ListRecentResponse{}
+	mi := &file_evaluationspb_evaluations_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRecentResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRecentResponse) ProtoMessage() {}
+
+func (x *ListRecentResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_evaluationspb_evaluations_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRecentResponse.ProtoReflect.Descriptor instead.
+func (*ListRecentResponse) Descriptor() ([]byte, []int) {
+	return file_evaluationspb_evaluations_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ListRecentResponse) GetEvaluations() []*DomainEvaluation {
+	if x != nil {
+		return x.Evaluations
+	}
+	return nil
+}
+
+func (x *ListRecentResponse) GetErrors() []*APIError {
+	if x != nil {
+		return x.Errors
+	}
+	return nil
+}
+
+type WatchDomainRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Domain string                 `protobuf:"bytes,1,opt,name=domain,proto3" json:"domain,omitempty"`
+	// Seconds between evaluations, 5 when it's zero.
+	IntervalSeconds int32 `protobuf:"varint,2,opt,name=interval_seconds,json=intervalSeconds,proto3" json:"interval_seconds,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *WatchDomainRequest) Reset() {
+	*x = WatchDomainRequest{}
+	mi := &file_evaluationspb_evaluations_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchDomainRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchDomainRequest) ProtoMessage() {}
+
+func (x *WatchDomainRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_evaluationspb_evaluations_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchDomainRequest.ProtoReflect.Descriptor instead.
+func (*WatchDomainRequest) Descriptor() ([]byte, []int) {
+	return file_evaluationspb_evaluations_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *WatchDomainRequest) GetDomain() string {
+	if x != nil {
+		return x.Domain
+	}
+	return ""
+}
+
+func (x *WatchDomainRequest) GetIntervalSeconds() int32 {
+	if x != nil {
+		return x.IntervalSeconds
+	}
+	return 0
+}
+
+var File_evaluationspb_evaluations_proto protoreflect.FileDescriptor
+
+const file_evaluationspb_evaluations_proto_rawDesc = "" +
+	"\n" +
+	"\x1fevaluationspb/evaluations.proto\x12\x0eevaluations.v1\"o\n" +
+	"\x06Server\x12\x18\n" +
+	"\aaddress\x18\x01 \x01(\tR\aaddress\x12\x1b\n" +
+	"\tssl_grade\x18\x02 \x01(\tR\bsslGrade\x12\x18\n" +
+	"\acountry\x18\x03 \x01(\tR\acountry\x12\x14\n" +
+	"\x05owner\x18\x04 \x01(\tR\x05owner\"e\n" +
+	"\bAPIError\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\tR\x04code\x12 \n" +
+	"\vdescription\x18\x02 \x01(\tR\vdescription\x12#\n" +
+	"\rerror_message\x18\x03 \x01(\tR\ferrorMessage\"\xb9\x02\n" +
+	"\x18DomainEvaluationComplete\x124\n" +
+	"\x16evaluation_in_progress\x18\x01 \x01(\bR\x14evaluationInProgress\x120\n" +
+	"\aservers\x18\x02 \x03(\v2\x16.evaluations.v1.ServerR\aservers\x12'\n" +
+	"\x0fservers_changed\x18\x03 \x01(\bR\x0eserversChanged\x12\x1b\n" +
+	"\tssl_grade\x18\x04 \x01(\tR\bsslGrade\x12,\n" +
+	"\x12previous_ssl_grade\x18\x05 \x01(\tR\x10previousSslGrade\x12\x12\n" +
+	"\x04logo\x18\x06 \x01(\tR\x04logo\x12\x14\n" +
+	"\x05title\x18\a \x01(\tR\x05title\x12\x17\n" +
+	"\ais_down\x18\b \x01(\bR\x06isDown\"\xf1\x01\n" +
+	"\x10DomainEvaluation\x12\x16\n" +
+	"\x06domain\x18\x01 \x01(\tR\x06domain\x12\x12\n" +
+	"\x04hour\x18\x02 \x01(\tR\x04hour\x12\x1f\n" +
+	"\vin_progress\x18\x03 \x01(\bR\n" +
+	"inProgress\x12\x1b\n" +
+	"\tssl_grade\x18\x04 \x01(\tR\bsslGrade\x12\x12\n" +
+	"\x04logo\x18\x05 \x01(\tR\x04logo\x12\x14\n" +
+	"\x05title\x18\x06 \x01(\tR\x05title\x12\x17\n" +
+	"\ais_down\x18\a \x01(\bR\x06isDown\x120\n" +
+	"\aservers\x18\b \x03(\v2\x16.evaluations.v1.ServerR\aservers\"/\n" +
+	"\x15EvaluateDomainRequest\x12\x16\n" +
+	"\x06domain\x18\x01 \x01(\tR\x06domain\"\xa8\x01\n" +
+	"\x12EvaluationResponse\x12\x16\n" +
+	"\x06domain\x18\x01 \x01(\tR\x06domain\x12H\n" +
+	"\n" +
+	"evaluation\x18\x02 \x01(\v2(.evaluations.v1.DomainEvaluationCompleteR\n" +
+	"evaluation\x120\n" +
+	"\x06errors\x18\x03 \x03(\v2\x18.evaluations.v1.APIErrorR\x06errors\".\n" +
+	"\x14GetEvaluationRequest\x12\x16\n" +
+	"\x06domain\x18\x01 \x01(\tR\x06domain\"\x8b\x01\n" +
+	"\x15GetEvaluationResponse\x12@\n" +
+	"\n" +
+	"evaluation\x18\x01 \x01(\v2 .evaluations.v1.DomainEvaluationR\n" +
+	"evaluation\x120\n" +
+	"\x06errors\x18\x02 \x03(\v2\x18.evaluations.v1.APIErrorR\x06errors\"\x13\n" +
+	"\x11ListRecentRequest\"\x8a\x01\n" +
+	"\x12ListRecentResponse\x12B\n" +
+	"\vevaluations\x18\x01 \x03(\v2 .evaluations.v1.DomainEvaluationR\vevaluations\x120\n" +
+	"\x06errors\x18\x02 \x03(\v2\x18.evaluations.v1.APIErrorR\x06errors\"W\n" +
+	"\x12WatchDomainRequest\x12\x16\n" +
+	"\x06domain\x18\x01 \x01(\tR\x06domain\x12)\n" +
+	"\x10interval_seconds\x18\x02 \x01(\x05R\x0fintervalSeconds2\xf6\x02\n" +
+	"\vEvaluations\x12[\n" +
+	"\x0eEvaluateDomain\x12%.evaluations.v1.EvaluateDomainRequest\x1a\".evaluations.v1.EvaluationResponse\x12\\\n" +
+	"\rGetEvaluation\x12$.evaluations.v1.GetEvaluationRequest\x1a%.evaluations.v1.GetEvaluationResponse\x12S\n" +
+	"\n" +
+	"ListRecent\x12!.evaluations.v1.ListRecentRequest\x1a\".evaluations.v1.ListRecentResponse\x12W\n" +
+	"\vWatchDomain\x12\".evaluations.v1.WatchDomainRequest\x1a\".evaluations.v1.EvaluationResponse0\x01BHZFgithub.com/trotsdeveloper/truora_test/truora_test_golang/evaluationspbb\x06proto3"
+
+var (
+	file_evaluationspb_evaluations_proto_rawDescOnce sync.Once
+	file_evaluationspb_evaluations_proto_rawDescData []byte
+)
+
+func file_evaluationspb_evaluations_proto_rawDescGZIP() []byte {
+	file_evaluationspb_evaluations_proto_rawDescOnce.Do(func() {
+		file_evaluationspb_evaluations_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_evaluationspb_evaluations_proto_rawDesc), len(file_evaluationspb_evaluations_proto_rawDesc)))
+	})
+	return file_evaluationspb_evaluations_proto_rawDescData
+}
+
+var file_evaluationspb_evaluations_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_evaluationspb_evaluations_proto_goTypes = []any{
+	(*Server)(nil),                   // 0: evaluations.v1.Server
+	(*APIError)(nil),                 // 1: evaluations.v1.APIError
+	(*DomainEvaluationComplete)(nil), // 2: evaluations.v1.DomainEvaluationComplete
+	(*DomainEvaluation)(nil),         // 3: evaluations.v1.DomainEvaluation
+	(*EvaluateDomainRequest)(nil),    // 4: evaluations.v1.EvaluateDomainRequest
+	(*EvaluationResponse)(nil),       // 5: evaluations.v1.EvaluationResponse
+	(*GetEvaluationRequest)(nil),     // 6: evaluations.v1.GetEvaluationRequest
+	(*GetEvaluationResponse)(nil),    // 7: evaluations.v1.GetEvaluationResponse
+	(*ListRecentRequest)(nil),        // 8: evaluations.v1.ListRecentRequest
+	(*ListRecentResponse)(nil),       // 9: evaluations.v1.ListRecentResponse
+	(*WatchDomainRequest)(nil),       // 10: evaluations.v1.WatchDomainRequest
+}
+var file_evaluationspb_evaluations_proto_depIdxs = []int32{
+	0,  // 0: evaluations.v1.DomainEvaluationComplete.servers:type_name -> evaluations.v1.Server
+	0,  // 1: evaluations.v1.DomainEvaluation.servers:type_name -> evaluations.v1.Server
+	2,  // 2: evaluations.v1.EvaluationResponse.evaluation:type_name -> evaluations.v1.DomainEvaluationComplete
+	1,  // 3: evaluations.v1.EvaluationResponse.errors:type_name -> evaluations.v1.APIError
+	3,  // 4: evaluations.v1.GetEvaluationResponse.evaluation:type_name -> evaluations.v1.DomainEvaluation
+	1,  // 5: evaluations.v1.GetEvaluationResponse.errors:type_name -> evaluations.v1.APIError
+	3,  // 6: evaluations.v1.ListRecentResponse.evaluations:type_name -> evaluations.v1.DomainEvaluation
+	1,  // 7: evaluations.v1.ListRecentResponse.errors:type_name -> evaluations.v1.APIError
+	4,  // 8: evaluations.v1.Evaluations.EvaluateDomain:input_type -> evaluations.v1.EvaluateDomainRequest
+	6,  // 9: evaluations.v1.Evaluations.GetEvaluation:input_type -> evaluations.v1.GetEvaluationRequest
+	8,  // 10: evaluations.v1.Evaluations.ListRecent:input_type -> evaluations.v1.ListRecentRequest
+	10, // 11: evaluations.v1.Evaluations.WatchDomain:input_type -> evaluations.v1.WatchDomainRequest
+	5,  // 12: evaluations.v1.Evaluations.EvaluateDomain:output_type -> evaluations.v1.EvaluationResponse
+	7,  // 13: evaluations.v1.Evaluations.GetEvaluation:output_type -> evaluations.v1.GetEvaluationResponse
+	9,  // 14: evaluations.v1.Evaluations.ListRecent:output_type -> evaluations.v1.ListRecentResponse
+	5,  // 15: evaluations.v1.Evaluations.WatchDomain:output_type -> evaluations.v1.EvaluationResponse
+	12, // [12:16] is the sub-list for method output_type
+	8,  // [8:12] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_evaluationspb_evaluations_proto_init() }
+func file_evaluationspb_evaluations_proto_init() {
+	if File_evaluationspb_evaluations_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_evaluationspb_evaluations_proto_rawDesc), len(file_evaluationspb_evaluations_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_evaluationspb_evaluations_proto_goTypes,
+		DependencyIndexes: file_evaluationspb_evaluations_proto_depIdxs,
+		MessageInfos:      file_evaluationspb_evaluations_proto_msgTypes,
+	}.Build()
+	File_evaluationspb_evaluations_proto = out.File
+	file_evaluationspb_evaluations_proto_goTypes = nil
+	file_evaluationspb_evaluations_proto_depIdxs = nil
+}
@@ -0,0 +1,261 @@
+// Definition of the gRPC API of the domain evaluations, for the internal
+// services. The messages mirror the json responses of the REST API.
+//
+// After changing this file, regenerate the Go code from the root of the repo:
+//   protoc --go_out=. --go_opt=paths=source_relative \
+//     --go-grpc_out=. --go-grpc_opt=paths=source_relative \
+//     evaluationspb/evaluations.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: evaluationspb/evaluations.proto
+
+package evaluationspb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Evaluations_EvaluateDomain_FullMethodName = "/evaluations.v1.Evaluations/EvaluateDomain"
+	Evaluations_GetEvaluation_FullMethodName  = "/evaluations.v1.Evaluations/GetEvaluation"
+	Evaluations_ListRecent_FullMethodName     = "/evaluations.v1.Evaluations/ListRecent"
+	Evaluations_WatchDomain_FullMethodName    = "/evaluations.v1.Evaluations/WatchDomain"
+)
+
+// EvaluationsClient is the client API for Evaluations service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Service for evaluating the SSL configuration of domains.
+type EvaluationsClient interface {
+	// Evaluates a domain, like GET /domainEvaluations/{domainName}.
+	EvaluateDomain(ctx context.Context, in *EvaluateDomainRequest, opts ...grpc.CallOption) (*EvaluationResponse, error)
+	// Gets the last stored evaluation of a domain, without starting a new one.
+	GetEvaluation(ctx context.Context, in *GetEvaluationRequest, opts ...grpc.CallOption) (*GetEvaluationResponse, error)
+	// Lists the last evaluation of every domain, like GET /domainEvaluations.
+	ListRecent(ctx context.Context, in *ListRecentRequest, opts ...grpc.CallOption) (*ListRecentResponse, error)
+	// Evaluates a domain every interval, sending the evaluation when it changes,
+	// until the client cancels the call.
+	WatchDomain(ctx context.Context, in *WatchDomainRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[EvaluationResponse], error)
+}
+
+type evaluationsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEvaluationsClient(cc grpc.ClientConnInterface) EvaluationsClient {
+	return &evaluationsClient{cc}
+}
+
+func (c *evaluationsClient) EvaluateDomain(ctx context.Context, in *EvaluateDomainRequest, opts ...grpc.CallOption) (*EvaluationResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EvaluationResponse)
+	err := c.cc.Invoke(ctx, Evaluations_EvaluateDomain_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *evaluationsClient) GetEvaluation(ctx context.Context, in *GetEvaluationRequest, opts ...grpc.CallOption) (*GetEvaluationResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetEvaluationResponse)
+	err := c.cc.Invoke(ctx, Evaluations_GetEvaluation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *evaluationsClient) ListRecent(ctx context.Context, in *ListRecentRequest, opts ...grpc.CallOption) (*ListRecentResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListRecentResponse)
+	err := c.cc.Invoke(ctx, Evaluations_ListRecent_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *evaluationsClient) WatchDomain(ctx context.Context, in *WatchDomainRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[EvaluationResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Evaluations_ServiceDesc.Streams[0], Evaluations_WatchDomain_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchDomainRequest, EvaluationResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Evaluations_WatchDomainClient = grpc.ServerStreamingClient[EvaluationResponse]
+
+// EvaluationsServer is the server API for Evaluations service.
+// All implementations must embed UnimplementedEvaluationsServer
+// for forward compatibility.
+//
+// Service for evaluating the SSL configuration of domains.
+type EvaluationsServer interface {
+	// Evaluates a domain, like GET /domainEvaluations/{domainName}.
+	EvaluateDomain(context.Context, *EvaluateDomainRequest) (*EvaluationResponse, error)
+	// Gets the last stored evaluation of a domain, without starting a new one.
+	GetEvaluation(context.Context, *GetEvaluationRequest) (*GetEvaluationResponse, error)
+	// Lists the last evaluation of every domain, like GET /domainEvaluations.
+	ListRecent(context.Context, *ListRecentRequest) (*ListRecentResponse, error)
+	// Evaluates a domain every interval, sending the evaluation when it changes,
+	// until the client cancels the call.
+	WatchDomain(*WatchDomainRequest, grpc.ServerStreamingServer[EvaluationResponse]) error
+	mustEmbedUnimplementedEvaluationsServer()
+}
+
+// UnimplementedEvaluationsServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedEvaluationsServer struct{}
+
+func (UnimplementedEvaluationsServer) EvaluateDomain(context.Context, *EvaluateDomainRequest) (*EvaluationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EvaluateDomain not implemented")
+}
+func (UnimplementedEvaluationsServer) GetEvaluation(context.Context, *GetEvaluationRequest) (*GetEvaluationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetEvaluation not implemented")
+}
+func (UnimplementedEvaluationsServer) ListRecent(context.Context, *ListRecentRequest) (*ListRecentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRecent not implemented")
+}
+func (UnimplementedEvaluationsServer) WatchDomain(*WatchDomainRequest, grpc.ServerStreamingServer[EvaluationResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchDomain not implemented")
+}
+func (UnimplementedEvaluationsServer) mustEmbedUnimplementedEvaluationsServer() {}
+func (UnimplementedEvaluationsServer) testEmbeddedByValue()                     {}
+
+// UnsafeEvaluationsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EvaluationsServer will
+// result in compilation errors.
+type UnsafeEvaluationsServer interface {
+	mustEmbedUnimplementedEvaluationsServer()
+}
+
+func RegisterEvaluationsServer(s grpc.ServiceRegistrar, srv EvaluationsServer) {
+	// If the following call pancis, it indicates UnimplementedEvaluationsServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Evaluations_ServiceDesc, srv)
+}
+
+func _Evaluations_EvaluateDomain_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EvaluateDomainRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EvaluationsServer).EvaluateDomain(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Evaluations_EvaluateDomain_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EvaluationsServer).EvaluateDomain(ctx, req.(*EvaluateDomainRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Evaluations_GetEvaluation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetEvaluationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EvaluationsServer).GetEvaluation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Evaluations_GetEvaluation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EvaluationsServer).GetEvaluation(ctx, req.(*GetEvaluationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Evaluations_ListRecent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRecentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EvaluationsServer).ListRecent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Evaluations_ListRecent_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EvaluationsServer).ListRecent(ctx, req.(*ListRecentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Evaluations_WatchDomain_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchDomainRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EvaluationsServer).WatchDomain(m, &grpc.GenericServerStream[WatchDomainRequest, EvaluationResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Evaluations_WatchDomainServer = grpc.ServerStreamingServer[EvaluationResponse]
+
+// Evaluations_ServiceDesc is the grpc.ServiceDesc for Evaluations service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Evaluations_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "evaluations.v1.Evaluations",
+	HandlerType: (*EvaluationsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "EvaluateDomain",
+			Handler:    _Evaluations_EvaluateDomain_Handler,
+		},
+		{
+			MethodName: "GetEvaluation",
+			Handler:    _Evaluations_GetEvaluation_Handler,
+		},
+		{
+			MethodName: "ListRecent",
+			Handler:    _Evaluations_ListRecent_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchDomain",
+			Handler:       _Evaluations_WatchDomain_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "evaluationspb/evaluations.proto",
+}
@@ -0,0 +1,132 @@
+// Package for writing the evaluations, joined with their servers, in the
+// export formats: CSV, newline-delimited JSON and XLSX. The writers stream
+// the evaluations, so an export never keeps them in memory together.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+)
+
+// Export formats.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	FormatXLSX   = "xlsx"
+)
+
+// Columns of the CSV and XLSX exports. They have a row per server, repeating
+// the columns of the evaluation, and a row with empty server columns for the
+// evaluations without servers.
+var Columns = []string{"id", "domain", "hour", "in_progress", "ssl_grade", "is_down", "logo", "title",
+	"server_address", "server_ssl_grade", "server_country", "server_owner"}
+
+// Writer interface: Declaration of the writers of an export format.
+type Writer interface {
+	// Write writes an evaluation with its servers.
+	Write(de dao.DomainEvaluation) error
+	// Close writes whatever the format needs after the last evaluation. It
+	// doesn't close the underlying writer.
+	Close() error
+}
+
+// Function for getting the writer of format over w.
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatNDJSON:
+		return &ndjsonWriter{enc: json.NewEncoder(w)}, nil
+	case FormatXLSX:
+		return newXLSXWriter(w)
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+// Function for getting the content type of format, it's empty for the
+// unknown formats.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return ""
+}
+
+// Auxiliar function for the rows of an evaluation in the CSV and XLSX exports.
+func rows(de dao.DomainEvaluation) [][]string {
+	evaluation := []string{strconv.Itoa(de.Id), de.Domain, de.EvaluationHour,
+		strconv.FormatBool(de.EvaluationInProgress), de.SslGrade, strconv.FormatBool(de.IsDown), de.Logo, de.Title}
+	if len(de.Servers) == 0 {
+		return [][]string{append(evaluation, "", "", "", "")}
+	}
+	rows := make([][]string, 0, len(de.Servers))
+	for _, s := range de.Servers {
+		row := append(append(make([]string, 0, len(Columns)), evaluation...), s.Address, s.SslGrade, s.Country, s.Owner)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// csvWriter - Writer of the CSV exports, with a header row.
+type csvWriter struct {
+	w *csv.Writer
+}
+
+// Default constructor for the csvWriter struct.
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	return cw, cw.w.Write(Columns)
+}
+
+// Write
+// Implementation of the method Write from the Writer interface.
+func (cw *csvWriter) Write(de dao.DomainEvaluation) error {
+	// The rows are flushed with every evaluation.
+	return cw.w.WriteAll(rows(de))
+}
+
+// Close
+// Implementation of the method Close from the Writer interface.
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// Evaluation - Struct representing a line of the newline-delimited JSON
+// exports: an evaluation with its id and its servers.
+type Evaluation struct {
+	Id int `json:"id"`
+	dao.DomainEvaluation
+	Servers []dao.Server `json:"servers"`
+}
+
+// ndjsonWriter - Writer of the newline-delimited JSON exports.
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+// Write
+// Implementation of the method Write from the Writer interface.
+func (nw *ndjsonWriter) Write(de dao.DomainEvaluation) error {
+	servers := de.Servers
+	if servers == nil {
+		servers = make([]dao.Server, 0)
+	}
+	return nw.enc.Encode(Evaluation{Id: de.Id, DomainEvaluation: de, Servers: servers})
+}
+
+// Close
+// Implementation of the method Close from the Writer interface.
+func (nw *ndjsonWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,11 @@
+// Package for embedding the frontend in the server binary.
+// The pages read the base URL of the API from config.js, which is generated
+// by the server at runtime (see rest.FrontendHandler).
+package frontend
+
+import "embed"
+
+// Files of the frontend: the pages, their scripts and the vendored assets.
+//
+//go:embed *.html js assets
+var Files embed.FS
@@ -5,21 +5,89 @@ var app2 = new Vue({
     justCreated: true,
     domainEvaluation: {},
     visibleKeys: [],
-    path: 'http://localhost:3000/domainEvaluations/'
+    stage: '',
+    endpoints: [],
+    events: null,
+    path: APP_CONFIG.apiBaseURL + '/domainEvaluations/'
   },
   methods: {
+    showEvaluation: function (result) {
+      app2.justCreated = false;
+      app2.domainEvaluation = result;
+      app2.visibleKeys = Object.keys(app2.domainEvaluation.evaluation);
+      app2.visibleKeys.splice(1,1)
+    },
     evaluateDomain: function () {
       let domain = this.evaluate
+      if (this.events) {
+        this.events.close()
+        this.events = null
+      }
+      if (!window.EventSource) {
+        this.requestEvaluation(domain)
+        return
+      }
+      // Follows the progress of the evaluation, the server polls SSL Labs.
+      // The event streams can't send the API key, they send a stream token.
+      let url = this.path + encodeURIComponent(domain) + '/events'
+      if (APP_CONFIG.apiKey) {
+        $.ajax({
+          url: this.path + 'streamTokens',
+          type: 'POST',
+          dataType: 'text',
+          crossDomain: true,
+          headers: {'X-API-Key': APP_CONFIG.apiKey},
+          success: function(result) {
+            app2.followEvaluation(domain, url + '?stream_token=' + encodeURIComponent(JSON.parse(result).token))
+          },
+          error: function(error) {
+            app2.requestEvaluation(domain)
+          }
+        });
+        return
+      }
+      this.followEvaluation(domain, url)
+    },
+    followEvaluation: function (domain, url) {
+      let events = new EventSource(url)
+      let update = function (e) {
+        let ev = JSON.parse(e.data)
+        app2.stage = ev.stage
+        app2.endpoints = ev.endpoints || []
+        if (ev.evaluation) {
+          app2.showEvaluation({evaluation: ev.evaluation, errors: ev.errors || []})
+        }
+        if (ev.stage == 'ready' || ev.stage == 'error') {
+          events.close()
+          if (!ev.evaluation) {
+            app2.showEvaluation({evaluation: {}, errors: ev.errors || []})
+          }
+        }
+      }
+      let stages = ['dns', 'in_progress', 'enrichment', 'ready', 'error']
+      for (let i = 0; i < stages.length; i++) {
+        events.addEventListener(stages[i], update)
+      }
+      events.onerror = function () {
+        // Without a ready event the stream isn't available, asks once.
+        if (app2.stage != 'ready' && app2.stage != 'error') {
+          events.close()
+          app2.requestEvaluation(domain)
+        }
+      }
+      this.stage = ''
+      this.endpoints = []
+      this.events = events
+    },
+    requestEvaluation: function (domain) {
       $.ajax({
         url: this.path + domain,
         type: 'GET',
         dataType: 'text',
         crossDomain: true,
+        headers: APP_CONFIG.apiKey ? {'X-API-Key': APP_CONFIG.apiKey} : {},
         success: function(result) {
-          app2.justCreated = false;
-          app2.domainEvaluation = JSON.parse(result);
-          app2.visibleKeys = Object.keys(app2.domainEvaluation.evaluation);
-          app2.visibleKeys.splice(1,1)
+          app2.showEvaluation(JSON.parse(result))
         },
         error: function(error) {
         }
@@ -2,10 +2,11 @@ var app = new Vue({
   el: '#app',
   data: {
     domainEvaluations: {},
-    path: 'http://localhost:3000/domainEvaluations/'
+    path: APP_CONFIG.apiBaseURL + '/domainEvaluations/'
   },
   created: function () {
     this.loadTable()
+    this.followEvents()
   },
   methods: {
     loadTable: function () {
@@ -14,12 +15,43 @@ var app = new Vue({
         type: 'GET',
         dataType: 'text',
         crossDomain: true,
+        headers: APP_CONFIG.apiKey ? {'X-API-Key': APP_CONFIG.apiKey} : {},
         success: function(result) {
           app.domainEvaluations = JSON.parse(result)
         },
         error: function (error) {
         }
       });
+    },
+    followEvents: function () {
+      if (!window.EventSource) {
+        return
+      }
+      // Reloads the table whenever an evaluation is ready.
+      // The event streams can't send the API key, they send a stream token.
+      let url = this.path + 'events'
+      if (APP_CONFIG.apiKey) {
+        $.ajax({
+          url: this.path + 'streamTokens',
+          type: 'POST',
+          dataType: 'text',
+          crossDomain: true,
+          headers: {'X-API-Key': APP_CONFIG.apiKey},
+          success: function(result) {
+            app.listenEvents(url + '?stream_token=' + encodeURIComponent(JSON.parse(result).token))
+          },
+          error: function (error) {
+          }
+        });
+        return
+      }
+      this.listenEvents(url)
+    },
+    listenEvents: function (url) {
+      let events = new EventSource(url)
+      events.addEventListener('ready', function () {
+        app.loadTable()
+      })
     }
   }
 })
@@ -0,0 +1,95 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/controller"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+)
+
+// loaders - Struct holding the data loaded by a single GraphQL request.
+// The servers are loaded in batches: the resolvers of a level of the query
+// register the evaluations they need and the first of them to read its
+// servers loads the ones of every registered evaluation with one query.
+// The histories of the domains are loaded once per domain.
+type loaders struct {
+	service *controller.Service
+
+	mu        sync.Mutex
+	pending   []int
+	servers   map[int][]dao.Server
+	errs      map[int]error
+	histories map[string][]dao.DomainEvaluation
+}
+
+// loadersKey - Key of the loaders in the context of a request.
+type loadersKey struct{}
+
+// Auxiliar function for attaching new loaders to the context of a request.
+func withLoaders(ctx context.Context, service *controller.Service) context.Context {
+	return context.WithValue(ctx, loadersKey{}, &loaders{
+		service:   service,
+		servers:   make(map[int][]dao.Server),
+		errs:      make(map[int]error),
+		histories: make(map[string][]dao.DomainEvaluation),
+	})
+}
+
+// Auxiliar function for the loaders of the request.
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+// Method registering the evaluation in the next batch of servers. It returns
+// a thunk, called by the executor once the whole level was resolved.
+func (l *loaders) loadServers(ctx context.Context, id int) func() (interface{}, error) {
+	l.mu.Lock()
+	if _, loaded := l.servers[id]; !loaded {
+		l.pending = append(l.pending, id)
+	}
+	l.mu.Unlock()
+	return func() (interface{}, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if len(l.pending) > 0 {
+			batch := l.pending
+			l.pending = nil
+			servers, appErr := l.service.ListServersByEvaluations(ctx, batch)
+			for _, i := range batch {
+				if appErr.Code != controller.DefaultAPIError().Code {
+					l.errs[i] = apiError(appErr)
+				}
+				l.servers[i] = servers[i]
+			}
+		}
+		if err := l.errs[id]; err != nil {
+			return nil, err
+		}
+		if l.servers[id] == nil {
+			return make([]dao.Server, 0), nil
+		}
+		return l.servers[id], nil
+	}
+}
+
+// Method for the history of a domain, the newest evaluation first.
+func (l *loaders) history(ctx context.Context, domain string) ([]dao.DomainEvaluation, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if history, ok := l.histories[domain]; ok {
+		return history, nil
+	}
+	history, appErr := l.service.DomainHistory(ctx, domain, 0)
+	if appErr.Code != controller.DefaultAPIError().Code {
+		return nil, apiError(appErr)
+	}
+	l.histories[domain] = history
+	return history, nil
+}
+
+// Auxiliar function for reporting an APIError as the error of a field.
+func apiError(appErr controller.APIError) error {
+	return errors.New(appErr.Code + ": " + appErr.Description + " " + appErr.Err)
+}
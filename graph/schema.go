@@ -0,0 +1,284 @@
+// Package for the declaration of the GraphQL API.
+// The package contains the schema over the domains, their evaluations and
+// servers, and the loaders that batch the queries made by its resolvers.
+package graph
+
+import (
+	"context"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/controller"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/validation"
+)
+
+// Number of evaluations and grade changes listed when the query doesn't say it.
+const defaultLast = 10
+
+// Request - Structure representing a GraphQL request, as sent by the clients.
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Schema - Structure holding the GraphQL schema of a Service.
+// The read only schema has no mutations, it's used for the requests that must
+// not change anything (like the GET requests).
+type Schema struct {
+	service  *controller.Service
+	schema   graphql.Schema
+	readOnly graphql.Schema
+}
+
+// domain - Source of the Domain type. The latest evaluation is known when the
+// domain comes from the list of recent evaluations.
+type domain struct {
+	name   string
+	latest *dao.DomainEvaluation
+}
+
+// evaluationResult - Source of the EvaluationResult type.
+type evaluationResult struct {
+	domain string
+	dec    dao.DomainEvaluationComplete
+	errors []controller.APIError
+}
+
+// Default constructor for the Schema struct.
+func NewSchema(service *controller.Service) (*Schema, error) {
+	s := &Schema{service: service}
+	query := s.queryType()
+	var err error
+	if s.schema, err = graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: s.mutationType()}); err != nil {
+		return nil, err
+	}
+	if s.readOnly, err = graphql.NewSchema(graphql.SchemaConfig{Query: query}); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Method for executing a GraphQL request, with its own loaders. When readOnly
+// is true, the mutations are rejected.
+func (s *Schema) Do(ctx context.Context, request Request, readOnly bool) *graphql.Result {
+	schema := s.schema
+	if readOnly {
+		schema = s.readOnly
+	}
+	return graphql.Do(graphql.Params{
+		Schema:         schema,
+		RequestString:  request.Query,
+		OperationName:  request.OperationName,
+		VariableValues: request.Variables,
+		Context:        withLoaders(ctx, s.service),
+	})
+}
+
+// Auxiliar function for a field read from its source with get.
+func field(t graphql.Output, get func(source interface{}) interface{}) *graphql.Field {
+	return &graphql.Field{Type: t, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+		return get(p.Source), nil
+	}}
+}
+
+// Auxiliar function for the last argument of the lists.
+func lastArgument() graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"last": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultLast,
+			Description: "Maximum number of items, the newest first."},
+	}
+}
+
+// Auxiliar function for the newest last items of a list.
+func newest(n int, last interface{}) int {
+	if l, ok := last.(int); ok && l >= 0 && l < n {
+		return l
+	}
+	return n
+}
+
+var serverType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Server",
+	Fields: graphql.Fields{
+		"address":  field(graphql.NewNonNull(graphql.String), func(s interface{}) interface{} { return s.(dao.Server).Address }),
+		"sslGrade": field(graphql.NewNonNull(graphql.String), func(s interface{}) interface{} { return s.(dao.Server).SslGrade }),
+		"country":  field(graphql.NewNonNull(graphql.String), func(s interface{}) interface{} { return s.(dao.Server).Country }),
+		"owner":    field(graphql.NewNonNull(graphql.String), func(s interface{}) interface{} { return s.(dao.Server).Owner }),
+	},
+})
+
+var gradeChangeType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "GradeChange",
+	Fields: graphql.Fields{
+		"hour": field(graphql.NewNonNull(graphql.String), func(s interface{}) interface{} { return s.(controller.GradeChange).Hour }),
+		"from": field(graphql.NewNonNull(graphql.String), func(s interface{}) interface{} { return s.(controller.GradeChange).From }),
+		"to":   field(graphql.NewNonNull(graphql.String), func(s interface{}) interface{} { return s.(controller.GradeChange).To }),
+	},
+})
+
+var errorType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Error",
+	Fields: graphql.Fields{
+		"code":        field(graphql.NewNonNull(graphql.String), func(s interface{}) interface{} { return s.(controller.APIError).Code }),
+		"description": field(graphql.NewNonNull(graphql.String), func(s interface{}) interface{} { return s.(controller.APIError).Description }),
+		"message":     field(graphql.NewNonNull(graphql.String), func(s interface{}) interface{} { return s.(controller.APIError).Err }),
+	},
+})
+
+// The servers of the evaluations are loaded in batches, see loaders.
+var evaluationType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Evaluation",
+	Fields: graphql.Fields{
+		"id":         field(graphql.NewNonNull(graphql.Int), func(s interface{}) interface{} { return s.(dao.DomainEvaluation).Id }),
+		"domain":     field(graphql.NewNonNull(graphql.String), func(s interface{}) interface{} { return s.(dao.DomainEvaluation).Domain }),
+		"hour":       field(graphql.NewNonNull(graphql.String), func(s interface{}) interface{} { return s.(dao.DomainEvaluation).EvaluationHour }),
+		"inProgress": field(graphql.NewNonNull(graphql.Boolean), func(s interface{}) interface{} { return s.(dao.DomainEvaluation).EvaluationInProgress }),
+		"isDown":     field(graphql.NewNonNull(graphql.Boolean), func(s interface{}) interface{} { return s.(dao.DomainEvaluation).IsDown }),
+		"sslGrade":   field(graphql.NewNonNull(graphql.String), func(s interface{}) interface{} { return s.(dao.DomainEvaluation).SslGrade }),
+		"logo":       field(graphql.NewNonNull(graphql.String), func(s interface{}) interface{} { return s.(dao.DomainEvaluation).Logo }),
+		"title":      field(graphql.NewNonNull(graphql.String), func(s interface{}) interface{} { return s.(dao.DomainEvaluation).Title }),
+		"servers": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(serverType))),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return loadersFrom(p.Context).loadServers(p.Context, p.Source.(dao.DomainEvaluation).Id), nil
+			},
+		},
+	},
+})
+
+var domainType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Domain",
+	Fields: graphql.Fields{
+		"name": field(graphql.NewNonNull(graphql.String), func(s interface{}) interface{} { return s.(domain).name }),
+		"latestEvaluation": &graphql.Field{
+			Type: evaluationType,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				d := p.Source.(domain)
+				if d.latest != nil {
+					return *d.latest, nil
+				}
+				history, err := loadersFrom(p.Context).history(p.Context, d.name)
+				if err != nil || len(history) == 0 {
+					return nil, err
+				}
+				return history[0], nil
+			},
+		},
+		"history": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(evaluationType))),
+			Args: lastArgument(),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				history, err := loadersFrom(p.Context).history(p.Context, p.Source.(domain).name)
+				if err != nil {
+					return nil, err
+				}
+				return history[:newest(len(history), p.Args["last"])], nil
+			},
+		},
+		"gradeChanges": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(gradeChangeType))),
+			Args: lastArgument(),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				history, err := loadersFrom(p.Context).history(p.Context, p.Source.(domain).name)
+				if err != nil {
+					return nil, err
+				}
+				changes := controller.GradeChanges(history)
+				return changes[:newest(len(changes), p.Args["last"])], nil
+			},
+		},
+	},
+})
+
+var evaluationResultType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "EvaluationResult",
+	Fields: graphql.Fields{
+		"domain": field(graphql.NewNonNull(domainType), func(s interface{}) interface{} {
+			return domain{name: s.(evaluationResult).domain}
+		}),
+		"inProgress": field(graphql.NewNonNull(graphql.Boolean), func(s interface{}) interface{} {
+			return s.(evaluationResult).dec.EvaluationInProgress
+		}),
+		"serversChanged": field(graphql.NewNonNull(graphql.Boolean), func(s interface{}) interface{} {
+			return s.(evaluationResult).dec.ServersChanged
+		}),
+		"previousSslGrade": field(graphql.NewNonNull(graphql.String), func(s interface{}) interface{} {
+			return s.(evaluationResult).dec.PreviousSslGrade
+		}),
+		"errors": field(graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(errorType))), func(s interface{}) interface{} {
+			return s.(evaluationResult).errors
+		}),
+	},
+})
+
+// Method for the Query type of the schema.
+func (s *Schema) queryType() *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"domain": &graphql.Field{
+				Type: domainType,
+				Args: graphql.FieldConfigArgument{
+					"name": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					name, err := validation.NormalizeDomain(p.Args["name"].(string))
+					if err != nil {
+						return nil, apiError(controller.APIErrors.E901(err))
+					}
+					// The domains never evaluated are null.
+					history, err := loadersFrom(p.Context).history(p.Context, name)
+					if err != nil || len(history) == 0 {
+						return nil, err
+					}
+					return domain{name: name}, nil
+				},
+			},
+			"domains": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(domainType))),
+				Description: "Domains with their last evaluation, as listed by the REST API.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					evaluations, appErrs := s.service.ListRecentEvaluations(p.Context, time.Now())
+					if len(appErrs) > 0 {
+						return nil, apiError(appErrs[0])
+					}
+					domains := make([]domain, len(evaluations))
+					for i := range evaluations {
+						domains[i] = domain{name: evaluations[i].Domain, latest: &evaluations[i]}
+					}
+					return domains, nil
+				},
+			},
+		},
+	})
+}
+
+// Method for the Mutation type of the schema.
+// The evaluations count against the daily quota of the API key of the request.
+func (s *Schema) mutationType() *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"evaluate": &graphql.Field{
+				Type: graphql.NewNonNull(evaluationResultType),
+				Args: graphql.FieldConfigArgument{
+					"domain": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					name, err := validation.NormalizeDomain(p.Args["domain"].(string))
+					if err != nil {
+						return nil, apiError(controller.APIErrors.E901(err))
+					}
+					now := time.Now()
+					if appErr := s.service.ChargeEvaluation(p.Context, now); appErr.Code != controller.DefaultAPIError().Code {
+						return nil, apiError(appErr)
+					}
+					dec, appErrs := s.service.ScraperTestComplete(p.Context, name, now)
+					return evaluationResult{domain: name, dec: dec, errors: appErrs}, nil
+				},
+			},
+		},
+	})
+}
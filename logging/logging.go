@@ -0,0 +1,89 @@
+// Package for the declaration of the structured logger of the server.
+// Every log line written with a context carrying a request ID includes it,
+// so the lines of the controller, the scrapers and the dao can be correlated
+// with the http request that caused them.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Formats accepted by NewLogger.
+const (
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+)
+
+// Key of the request ID in the log lines.
+const RequestIDKey = "request_id"
+
+type requestIDKey struct{}
+
+// Function for attaching a request ID to a context.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// Function for getting the request ID attached to a context, it's empty when
+// the context doesn't belong to a request.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Function for generating a new random request ID.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Default constructor for the logger of the server.
+// format is either FormatJSON or FormatLogfmt and level is the name of a
+// slog level (debug, info, warn or error).
+func NewLogger(w io.Writer, format string, level string) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case FormatJSON:
+		h = slog.NewJSONHandler(w, opts)
+	case FormatLogfmt:
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+	return slog.New(contextHandler{h}), nil
+}
+
+// contextHandler - slog.Handler adding the request ID of the context to every record.
+type contextHandler struct {
+	slog.Handler
+}
+
+// Method for handling a record, adding the request ID of ctx if there is one.
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String(RequestIDKey, id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// Method for keeping the contextHandler when attributes are added to the logger.
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// Method for keeping the contextHandler when a group is added to the logger.
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
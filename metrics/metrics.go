@@ -0,0 +1,126 @@
+// Package for the declaration of the Prometheus metrics of the server.
+// The metrics are registered in the default registry, so they are shared by
+// every Service of the process and exposed by promhttp.Handler.
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Namespace of every metric of the server.
+const namespace = "domain_evaluator"
+
+var (
+	// HTTPRequests counts the http requests by route, method and status code.
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of http requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	// HTTPDuration observes the latency of the http requests by route and method.
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of the http requests by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	// Evaluations counts the domain evaluations by outcome. The code label holds
+	// the APIError code of the evaluations ending in error, and is empty otherwise.
+	Evaluations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "evaluations",
+		Name:      "total",
+		Help:      "Number of domain evaluations by outcome and APIError code.",
+	}, []string{"outcome", "code"})
+
+	// ScraperDuration observes the latency of the calls to every scraper.
+	ScraperDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "scraper",
+		Name:      "duration_seconds",
+		Help:      "Latency of the calls to the scrapers.",
+		Buckets:   []float64{.1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"scraper"})
+
+	// ScraperFailures counts the failed calls to every scraper.
+	ScraperFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "scraper",
+		Name:      "failures_total",
+		Help:      "Number of failed calls to the scrapers.",
+	}, []string{"scraper"})
+
+	// SSLabsMaxAssessments is the number of concurrent assessments SSLabs allows.
+	SSLabsMaxAssessments = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "sslabs",
+		Name:      "max_assessments",
+		Help:      "Maximum number of concurrent assessments allowed by SSLabs.",
+	})
+
+	// SSLabsCurrentAssessments is the number of assessments in progress in SSLabs.
+	SSLabsCurrentAssessments = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "sslabs",
+		Name:      "current_assessments",
+		Help:      "Number of assessments in progress in SSLabs.",
+	})
+
+	// DBQueryDuration observes the latency of the database statements by operation.
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_duration_seconds",
+		Help:      "Latency of the database statements by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	// DomainsByGrade is the number of domains by the grade of their last evaluation.
+	DomainsByGrade = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "domains_by_grade",
+		Help:      "Number of domains by the SSL grade of their last evaluation.",
+	}, []string{"grade"})
+)
+
+func init() {
+	prometheus.MustRegister(HTTPRequests, HTTPDuration, Evaluations, ScraperDuration,
+		ScraperFailures, SSLabsMaxAssessments, SSLabsCurrentAssessments, DBQueryDuration,
+		DomainsByGrade)
+}
+
+// Function for observing a call to the scraper with the given name.
+// It's meant to be deferred at the beginning of the scraper:
+//
+//	defer metrics.ObserveScraper("logo", time.Now(), &err)
+func ObserveScraper(scraper string, start time.Time, err *error) {
+	ScraperDuration.WithLabelValues(scraper).Observe(time.Since(start).Seconds())
+	if *err != nil {
+		ScraperFailures.WithLabelValues(scraper).Inc()
+	}
+}
+
+// Function for observing a database statement by operation (SELECT, INSERT...).
+func ObserveQuery(operation string, start time.Time) {
+	DBQueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// Function for updating the SSLabs capacity gauges.
+func SetSSLabsCapacity(maxAssessments, currentAssessments int) {
+	SSLabsMaxAssessments.Set(float64(maxAssessments))
+	SSLabsCurrentAssessments.Set(float64(currentAssessments))
+}
+
+// Function for replacing the number of domains by grade.
+func SetDomainsByGrade(domainsByGrade map[string]int) {
+	DomainsByGrade.Reset()
+	for grade, n := range domainsByGrade {
+		DomainsByGrade.WithLabelValues(grade).Set(float64(n))
+	}
+}
@@ -0,0 +1,193 @@
+// Package for the declaration of the rate limiters of the server.
+// The limiters implement token buckets: every key has a bucket of Limit
+// tokens which is refilled at a rate of Limit tokens per Per, and every
+// request takes a token from the bucket of its key.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+)
+
+// Rate - Struct representing the number of requests allowed per period.
+type Rate struct {
+	Limit int
+	Per   time.Duration
+}
+
+// Decision - Struct representing the answer of a limiter to a request.
+type Decision struct {
+	Allowed bool
+	// Tokens left in the bucket after the request.
+	Remaining int
+	// Time to wait until the next request is allowed, when it isn't.
+	RetryAfter time.Duration
+}
+
+// Limiter interface: Declaration of the operations of a rate limiter.
+type Limiter interface {
+	// Allow takes a token from the bucket of key, refilled at the given rate.
+	Allow(ctx context.Context, key string, rate Rate) (Decision, error)
+}
+
+// Function for taking a token from a bucket holding tokens at the time last.
+// It returns the decision and the tokens left at the time now.
+func Take(tokens float64, last time.Time, now time.Time, rate Rate) (Decision, float64) {
+	if rate.Limit <= 0 || rate.Per <= 0 {
+		return Decision{Allowed: false, RetryAfter: time.Duration(math.MaxInt64)}, 0
+	}
+	perToken := rate.Per / time.Duration(rate.Limit)
+	if elapsed := now.Sub(last); elapsed > 0 {
+		tokens = math.Min(float64(rate.Limit), tokens+float64(elapsed)/float64(perToken))
+	}
+	if tokens < 1 {
+		return Decision{Allowed: false, RetryAfter: time.Duration((1 - tokens) * float64(perToken))}, tokens
+	}
+	tokens--
+	return Decision{Allowed: true, Remaining: int(tokens)}, tokens
+}
+
+// bucket - Struct representing the bucket of a key in the MemoryLimiter.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// MemoryLimiter - Implementation of the Limiter interface keeping the buckets
+// in memory, so every replica of the server has its own buckets.
+type MemoryLimiter struct {
+	// Time a bucket is kept after its last request.
+	IdleTTL time.Duration
+	// Function for getting the current time, replaced in tests.
+	Now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+// Default constructor for the MemoryLimiter struct.
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{IdleTTL: time.Hour, Now: time.Now, buckets: make(map[string]*bucket)}
+}
+
+// Allow
+// Implementation of the method Allow from the Limiter interface.
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, rate Rate) (Decision, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.Now()
+	if now.Sub(l.lastPrune) >= l.IdleTTL {
+		// Idle buckets are full, so deleting them doesn't change any decision.
+		for k, b := range l.buckets {
+			if now.Sub(b.last) >= l.IdleTTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastPrune = now
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rate.Limit), last: now}
+		l.buckets[key] = b
+	}
+	var decision Decision
+	decision, b.tokens = Take(b.tokens, b.last, now, rate)
+	b.last = now
+	return decision, nil
+}
+
+// LimitError - Struct representing a request rejected by a limiter.
+type LimitError struct {
+	Key        string
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("rate limit of %s exceeded, retry after %v", e.Key, e.RetryAfter.Round(time.Second))
+}
+
+// Function for taking a token from the bucket of key, returning a LimitError
+// when the bucket is empty. A rate without Limit is not limited.
+func Check(ctx context.Context, l Limiter, key string, rate Rate) error {
+	if rate.Limit <= 0 {
+		return nil
+	}
+	decision, err := l.Allow(ctx, key, rate)
+	if err != nil {
+		return err
+	}
+	if !decision.Allowed {
+		return &LimitError{Key: key, RetryAfter: decision.RetryAfter}
+	}
+	return nil
+}
+
+// Key of the client in the context of a request.
+type clientKey struct{}
+
+// Function for storing the client of a request (normally its IP) in ctx, so
+// the limits per client can be applied deep in the controller.
+func WithClient(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// Function for getting the client stored in ctx, "" when there is none.
+func Client(ctx context.Context) string {
+	client, _ := ctx.Value(clientKey{}).(string)
+	return client
+}
+
+// StoreLimiter - Implementation of the Limiter interface keeping the buckets
+// in a dao.BucketStore, so every replica of the server shares them.
+type StoreLimiter struct {
+	Store dao.BucketStore
+	// Time a bucket is kept in the store after its last request.
+	IdleTTL time.Duration
+	// Function for getting the current time, replaced in tests.
+	Now func() time.Time
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+// Default constructor for the StoreLimiter struct.
+func NewStoreLimiter(store dao.BucketStore) *StoreLimiter {
+	return &StoreLimiter{Store: store, IdleTTL: time.Hour, Now: time.Now}
+}
+
+// Allow
+// Implementation of the method Allow from the Limiter interface.
+func (l *StoreLimiter) Allow(ctx context.Context, key string, rate Rate) (decision Decision, err error) {
+	now := l.Now()
+	err = l.Store.UpdateRateLimitBucket(ctx, key, func(b *dao.RateLimitBucket, found bool) {
+		if !found {
+			b.Tokens, b.UpdatedAt = float64(rate.Limit), now
+		}
+		decision, b.Tokens = Take(b.Tokens, b.UpdatedAt, now, rate)
+		b.UpdatedAt = now
+	})
+	if err != nil {
+		return Decision{}, err
+	}
+	l.prune(ctx, now)
+	return
+}
+
+// Auxiliar method for deleting the idle buckets from the store, at most once
+// per IdleTTL. Idle buckets are full, so deleting them doesn't change any decision.
+func (l *StoreLimiter) prune(ctx context.Context, now time.Time) {
+	l.mu.Lock()
+	if now.Sub(l.lastPrune) < l.IdleTTL {
+		l.mu.Unlock()
+		return
+	}
+	l.lastPrune = now
+	l.mu.Unlock()
+	l.Store.DeleteRateLimitBuckets(ctx, now.Add(-l.IdleTTL))
+}
@@ -0,0 +1,59 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/controller"
+)
+
+// ApproveBaselineRequest - Structure representing the body of the
+// ApproveBaselineEndPoint. Both fields are optional: the last ready evaluation
+// is approved, and its grade is the minimum one.
+type ApproveBaselineRequest struct {
+	EvaluationId int    `json:"evaluation_id"`
+	MinGrade     string `json:"min_grade"`
+}
+
+// Endpoint for approving an evaluation of a domain as its baseline. The new
+// evaluations of the domain report their drift from it.
+func (api *API) ApproveBaselineEndPoint(w http.ResponseWriter, r *http.Request) {
+	var req ApproveBaselineRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeProblem(w, r, http.StatusBadRequest, []controller.APIError{controller.APIErrors.E905(err)})
+		return
+	}
+	ab, appErr := api.Service.ApproveBaseline(r.Context(), chi.URLParam(r, "domainName"), req.EvaluationId,
+		req.MinGrade, time.Now())
+	if appErr.Code != controller.DefaultAPIError().Code {
+		writeProblem(w, r, appErr.Status, []controller.APIError{appErr})
+		return
+	}
+	writeJSON(w, r, http.StatusOK, ab)
+}
+
+// Endpoint for reading the approved baseline of a domain.
+func (api *API) ApprovedBaselineEndPoint(w http.ResponseWriter, r *http.Request) {
+	ab, appErr := api.Service.FindApprovedBaseline(r.Context(), chi.URLParam(r, "domainName"))
+	if appErr.Code != controller.DefaultAPIError().Code {
+		writeProblem(w, r, appErr.Status, []controller.APIError{appErr})
+		return
+	}
+	writeJSON(w, r, http.StatusOK, ab)
+}
+
+// Endpoint for clearing the approved baseline of a domain, so its evaluations
+// stop reporting their drift.
+func (api *API) ClearApprovedBaselineEndPoint(w http.ResponseWriter, r *http.Request) {
+	appErr := api.Service.ClearApprovedBaseline(r.Context(), chi.URLParam(r, "domainName"))
+	if appErr.Code != controller.DefaultAPIError().Code {
+		writeProblem(w, r, appErr.Status, []controller.APIError{appErr})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
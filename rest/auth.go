@@ -0,0 +1,157 @@
+package rest
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/controller"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+)
+
+// Header carrying the API key of the client.
+const APIKeyHeader = "X-API-Key"
+
+// Structure representing the body of a request in the CreateAPIKeyEndPoint.
+// The limits take the settings of the service when they are zero.
+type CreateAPIKeyRequest struct {
+	Name       string `json:"name"`
+	RateLimit  int    `json:"rate_limit"`
+	DailyQuota int    `json:"daily_quota"`
+}
+
+// Structure representing a response in the CreateAPIKeyEndPoint.
+// The APIKey is the key in plain text, it can't be recovered afterwards.
+type CreateAPIKeyResponse struct {
+	Key       dao.APIKey            `json:"key"`
+	APIKey    string                `json:"api_key"`
+	APIErrors []controller.APIError `json:"errors"`
+}
+
+// Structure representing a response in the ListAPIKeysEndPoint.
+type APIKeysResponse struct {
+	Keys      []controller.APIKeyStatus `json:"keys"`
+	APIErrors []controller.APIError     `json:"errors"`
+}
+
+// Structure representing a response in the APIKeyUsageEndPoint.
+type APIKeyUsageResponse struct {
+	Usage     []dao.APIKeyUsage     `json:"usage"`
+	APIErrors []controller.APIError `json:"errors"`
+}
+
+// Method returning a middleware that rejects the requests without a valid API
+// key in the X-API-Key header, or over the rate limit of their key. When
+// evaluation is true, every request is also counted against the daily quota
+// of evaluations of the key. The event streams can send a stream token (see
+// StreamTokenEndPoint) in the stream_token query parameter instead of the key.
+// The rejections are problem responses (401 or 429, with a Retry-After header)
+// in every version of the responses. The key of the accepted requests is kept
+// in their context, see controller.WithAPIKey.
+func (api *API) RequireAPIKey(evaluation bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			plain := r.Header.Get(APIKeyHeader)
+			authorize := api.Service.AuthorizeAPIKey
+			if token := r.URL.Query().Get("stream_token"); plain == "" && token != "" &&
+				r.Header.Get("Accept") == EventStreamContentType {
+				// The browsers can't send headers in the event stream requests.
+				plain, authorize = token, api.Service.AuthorizeStreamToken
+			}
+			key, decision, appErr := authorize(r.Context(), plain, evaluation, time.Now())
+			if key.Id != 0 {
+				w.Header().Set("X-RateLimit-Limit", strconv.Itoa(key.RateLimit))
+				w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+			}
+			if appErr.Code != controller.DefaultAPIError().Code {
+				if !decision.Allowed && decision.RetryAfter > 0 {
+					w.Header().Set("Retry-After", retryAfter(decision.RetryAfter))
+				}
+				writeProblem(w, r, appErr.Status, []controller.APIError{appErr})
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(controller.WithAPIKey(r.Context(), key)))
+		})
+	}
+}
+
+// Auxiliar function for the value of the Retry-After header, in whole seconds.
+func retryAfter(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// Middleware for the admin endpoints: the requests must send the AdminToken of
+// the API as a bearer token. Without an AdminToken the admin endpoints are disabled.
+func (api *API) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if api.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(api.AdminToken)) != 1 {
+			appErr := controller.APIErrors.E907(errors.New("the admin endpoints need a valid bearer token"))
+			writeProblem(w, r, appErr.Status, []controller.APIError{appErr})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (api *API) CreateAPIKeyEndPoint(w http.ResponseWriter, r *http.Request) {
+	var request CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, []controller.APIError{controller.APIErrors.E905(err)})
+		return
+	}
+	key, plain, appErr := api.Service.CreateAPIKey(r.Context(), request.Name, request.RateLimit,
+		request.DailyQuota, time.Now())
+	if appErr.Code != controller.DefaultAPIError().Code {
+		writeProblem(w, r, appErr.Status, []controller.APIError{appErr})
+		return
+	}
+	writeJSON(w, r, http.StatusCreated, CreateAPIKeyResponse{Key: key, APIKey: plain,
+		APIErrors: make([]controller.APIError, 0)})
+}
+
+func (api *API) ListAPIKeysEndPoint(w http.ResponseWriter, r *http.Request) {
+	keys, appErrs := api.Service.ListAPIKeys(r.Context(), time.Now())
+	writeAdmin(w, r, APIKeysResponse{Keys: keys, APIErrors: appErrs}, appErrs)
+}
+
+func (api *API) RevokeAPIKeyEndPoint(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, []controller.APIError{controller.APIErrors.E905(err)})
+		return
+	}
+	appErr := api.Service.RevokeAPIKey(r.Context(), id, time.Now())
+	if appErr.Code != controller.DefaultAPIError().Code {
+		writeProblem(w, r, appErr.Status, []controller.APIError{appErr})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *API) APIKeyUsageEndPoint(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, []controller.APIError{controller.APIErrors.E905(err)})
+		return
+	}
+	usage, appErrs := api.Service.ListAPIKeyUsage(r.Context(), id)
+	writeAdmin(w, r, APIKeyUsageResponse{Usage: usage, APIErrors: appErrs}, appErrs)
+}
+
+// Auxiliar function for writing the responses of the admin endpoints. Being
+// new, they always answer with the status mapped from their APIErrors.
+func writeAdmin(w http.ResponseWriter, r *http.Request, body interface{}, appErrs []controller.APIError) {
+	status := controller.HTTPStatus(appErrs, false)
+	if status >= http.StatusBadRequest {
+		writeProblem(w, r, status, appErrs)
+		return
+	}
+	writeJSON(w, r, status, body)
+}
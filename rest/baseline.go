@@ -0,0 +1,40 @@
+package rest
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/controller"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+)
+
+// Auxiliar function for parsing the baseline parameter of the evaluations
+// (see dao.ParseBaseline). It's nil when the parameter is missing, so the
+// baseline of the service is used.
+func parseBaseline(r *http.Request) (*dao.Baseline, error) {
+	v := r.URL.Query().Get("baseline")
+	if v == "" {
+		return nil, nil
+	}
+	baseline, err := dao.ParseBaseline(v)
+	if err != nil {
+		return nil, err
+	}
+	return &baseline, nil
+}
+
+// Auxiliar method for evaluating a domain and, when the evaluation is ready,
+// comparing it with baseline instead of the baseline of the service.
+func (api *API) evaluate(r *http.Request, domain string, baseline *dao.Baseline) (dec dao.DomainEvaluationComplete,
+	appErrs []controller.APIError) {
+	dec, appErrs = api.Service.ScraperTestComplete(r.Context(), domain, time.Now())
+	if baseline == nil || dec.EvaluationInProgress || dec.IsDown ||
+		controller.HTTPStatus(appErrs, false) >= http.StatusBadRequest {
+		return
+	}
+	appErr := api.Service.CompareWithBaseline(r.Context(), domain, &dec, *baseline)
+	if appErr.Code != controller.DefaultAPIError().Code {
+		appErrs = append(appErrs, appErr)
+	}
+	return
+}
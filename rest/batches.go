@@ -0,0 +1,90 @@
+package rest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/controller"
+)
+
+// Maximum size of the body of a batch request.
+const maxBatchBody = 1 << 20
+
+// Auxiliar function for reading the domains of a CSV list. The domain is the
+// first column of every row, and a first row with "domain" is taken as the header.
+func readCSVDomains(r io.Reader) ([]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	domains := make([]string, 0, len(records))
+	for i, record := range records {
+		domain := strings.TrimSpace(record[0])
+		if domain == "" || (i == 0 && strings.EqualFold(domain, "domain")) {
+			continue
+		}
+		domains = append(domains, domain)
+	}
+	return domains, nil
+}
+
+// Auxiliar function for reading the domains of a batch request: a JSON array
+// of domains, a CSV list (text/csv) or a CSV file uploaded in the file field
+// of a multipart form.
+func readBatchDomains(r *http.Request) ([]string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		return readCSVDomains(r.Body)
+	case "multipart/form-data":
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return readCSVDomains(file)
+	case "application/json", "":
+		var domains []string
+		err := json.NewDecoder(r.Body).Decode(&domains)
+		return domains, err
+	}
+	return nil, errors.New("unsupported content type " + mediaType)
+}
+
+// Endpoint for evaluating a list of domains in the background. It answers 202
+// with the batch, whose state is read in the endpoint of the Location header.
+func (api *API) CreateBatchEndPoint(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchBody)
+	domains, err := readBatchDomains(r)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, []controller.APIError{controller.APIErrors.E905(err)})
+		return
+	}
+	batch, appErrs := api.Service.CreateBatch(r.Context(), domains, time.Now())
+	if len(appErrs) > 0 {
+		writeProblem(w, r, controller.HTTPStatus(appErrs, false), appErrs)
+		return
+	}
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+batch.Id)
+	writeJSON(w, r, http.StatusAccepted, batch)
+}
+
+// Endpoint for reading the state of a batch and the results of its domains.
+func (api *API) BatchEndPoint(w http.ResponseWriter, r *http.Request) {
+	batch, appErr := api.Service.FindBatch(r.Context(), chi.URLParam(r, "batchId"))
+	if appErr.Code != controller.DefaultAPIError().Code {
+		writeProblem(w, r, appErr.Status, []controller.APIError{appErr})
+		return
+	}
+	writeJSON(w, r, http.StatusOK, batch)
+}
@@ -0,0 +1,151 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig - Structure holding the CORS policy of the API.
+// An AllowedOrigins of "*" allows every origin, but then the credentials
+// can't be allowed, since browsers reject that combination.
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// Time the browsers can cache the answer to a preflight request.
+	MaxAge time.Duration
+}
+
+// Default constructor for the CORSConfig struct.
+// Every origin is allowed, without credentials, as the frontend is served
+// from a different origin than the API.
+func DefaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodDelete},
+		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", APIKeyHeader, RequestIDHeader,
+			VersionHeader},
+		ExposedHeaders: []string{RequestIDHeader, "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining"},
+		MaxAge:         time.Minute * 10,
+	}
+}
+
+// Method for checking that the CORS policy can be honoured by the browsers.
+func (c CORSConfig) Validate() error {
+	if c.AllowCredentials && c.allowsAnyOrigin() {
+		return errors.New("the credentials can't be allowed for every origin")
+	}
+	return nil
+}
+
+// Auxiliar method telling if the policy allows every origin.
+func (c CORSConfig) allowsAnyOrigin() bool {
+	for _, o := range c.AllowedOrigins {
+		if o == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Auxiliar method telling if the policy allows the given origin.
+func (c CORSConfig) allowsOrigin(origin string) bool {
+	for _, o := range c.AllowedOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Auxiliar function for checking if every value of the comma separated list
+// is in allowed (ignoring the case).
+func allowsAll(allowed []string, list string) bool {
+	for _, v := range strings.Split(list, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		found := false
+		for _, a := range allowed {
+			if strings.EqualFold(a, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Middleware applying the CORS policy to every request.
+// Preflight requests (OPTIONS with Access-Control-Request-Method) are answered
+// here, with a 204 when the origin, the method and the headers are allowed and
+// with a 403 otherwise. Other requests go on, with the CORS headers when their
+// origin is allowed. The responses vary on the headers used for the decision,
+// so caches don't serve the answer for an origin to another one.
+func CORS(c CORSConfig) func(http.Handler) http.Handler {
+	methods := strings.Join(c.AllowedMethods, ", ")
+	headers := strings.Join(c.AllowedHeaders, ", ")
+	exposed := strings.Join(c.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(c.MaxAge.Seconds()))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			w.Header().Add("Vary", "Origin")
+			if preflight {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+			}
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			allowed := c.allowsOrigin(origin)
+			if preflight {
+				if !allowed || !allowsAll(c.AllowedMethods, r.Header.Get("Access-Control-Request-Method")) ||
+					!allowsAll(c.AllowedHeaders, r.Header.Get("Access-Control-Request-Headers")) {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				setAllowOrigin(w, c, origin)
+				w.Header().Set("Access-Control-Allow-Methods", methods)
+				if headers != "" {
+					w.Header().Set("Access-Control-Allow-Headers", headers)
+				}
+				if c.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", maxAge)
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			if allowed {
+				setAllowOrigin(w, c, origin)
+				if exposed != "" {
+					w.Header().Set("Access-Control-Expose-Headers", exposed)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Auxiliar function for the headers telling the browser that the origin is allowed.
+func setAllowOrigin(w http.ResponseWriter, c CORSConfig, origin string) {
+	if c.allowsAnyOrigin() {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if c.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
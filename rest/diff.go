@@ -0,0 +1,37 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/controller"
+)
+
+// Endpoint comparing two evaluations of a domain, given their ids in the from
+// and to parameters (see controller.Service.DiffEvaluations). Without them,
+// the last two ready evaluations are compared.
+func (api *API) DiffEndPoint(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	ids := make(map[string]int, 2)
+	for _, name := range []string{"from", "to"} {
+		if v := q.Get(name); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil || id <= 0 {
+				writeProblem(w, r, http.StatusBadRequest,
+					[]controller.APIError{controller.APIErrors.E905(fmt.Errorf("%s: invalid evaluation id %q", name, v))})
+				return
+			}
+			ids[name] = id
+		}
+	}
+	diff, appErr := api.Service.DiffEvaluations(r.Context(), chi.URLParam(r, "domainName"), ids["from"], ids["to"],
+		time.Now())
+	if appErr.Code != controller.DefaultAPIError().Code {
+		writeProblem(w, r, appErr.Status, []controller.APIError{appErr})
+		return
+	}
+	writeJSON(w, r, http.StatusOK, diff)
+}
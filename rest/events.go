@@ -0,0 +1,162 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/controller"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/validation"
+)
+
+// Content type of the Server-Sent Events responses.
+const EventStreamContentType = "text/event-stream"
+
+// Error writing in a closed event stream.
+var errStreamClosed = errors.New("event stream closed")
+
+// Time between the comments keeping the idle event streams open through the
+// proxies.
+var eventsKeepAlive = time.Second * 15
+
+// eventStream - Structure writing Server-Sent Events in a response.
+// The events and the keep alive comments are written from different goroutines.
+type eventStream struct {
+	mu     sync.Mutex
+	w      http.ResponseWriter
+	rc     *http.ResponseController
+	closed bool
+}
+
+// Auxiliar function for starting a Server-Sent Events response. It sends a
+// keep alive comment every eventsKeepAlive until ctx is done or the stream is
+// closed.
+func startEventStream(ctx context.Context, w http.ResponseWriter) *eventStream {
+	w.Header().Set("Content-Type", EventStreamContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	// Tells nginx not to buffer the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	es := &eventStream{w: w, rc: http.NewResponseController(w)}
+	es.rc.Flush()
+	go func() {
+		ticker := time.NewTicker(eventsKeepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				es.write(": keep-alive\n\n")
+			}
+		}
+	}()
+	return es
+}
+
+// Auxiliar method for writing and flushing a piece of the stream.
+func (es *eventStream) write(s string) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if es.closed {
+		return errStreamClosed
+	}
+	if _, err := fmt.Fprint(es.w, s); err != nil {
+		return err
+	}
+	return es.rc.Flush()
+}
+
+// Method for closing the stream, nothing is written after it. It must be
+// called before the handler returns.
+func (es *eventStream) close() {
+	es.mu.Lock()
+	es.closed = true
+	es.mu.Unlock()
+}
+
+// Method for sending an event, named after its stage. The id lets the
+// browsers tell the events apart when they reconnect.
+func (es *eventStream) send(ev controller.EvaluationEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("event: %s\ndata: %s\n\n", ev.Stage, data)
+	if ev.Id != 0 {
+		msg = fmt.Sprintf("id: %d\n", ev.Id) + msg
+	}
+	return es.write(msg)
+}
+
+// Method for closing the event streams open, and the ones opened afterwards.
+// The streams only end when their clients go away, so the server calls it on
+// shutdown (see http.Server.RegisterOnShutdown).
+func (api *API) CloseStreams() {
+	api.closeStreams()
+}
+
+// Auxiliar method for the context of an event stream: the one of the request,
+// also cancelled by CloseStreams.
+func (api *API) streamContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(r.Context())
+	stop := context.AfterFunc(api.streams, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// Endpoint streaming the evaluation of a domain as Server-Sent Events, from
+// its start until it's ready (see controller.FollowEvaluation). The stream
+// ends after the ready or the error event.
+func (api *API) EvaluationEventsEndPoint(w http.ResponseWriter, r *http.Request) {
+	domain, err := validation.NormalizeDomain(chi.URLParam(r, "domainName"))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, []controller.APIError{controller.APIErrors.E901(err)})
+		return
+	}
+	ctx, cancel := api.streamContext(r)
+	defer cancel()
+	es := startEventStream(ctx, w)
+	defer es.close()
+	api.Service.FollowEvaluation(ctx, domain, es.send)
+}
+
+// Endpoint streaming the events of the evaluations of every domain as
+// Server-Sent Events, until the client disconnects.
+func (api *API) EventsEndPoint(w http.ResponseWriter, r *http.Request) {
+	events, cancel := api.Service.Events.Subscribe("")
+	defer cancel()
+	ctx, cancelStream := api.streamContext(r)
+	defer cancelStream()
+	es := startEventStream(ctx, w)
+	defer es.close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-events:
+			if err := es.send(ev); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Endpoint issuing a stream token for the API key of the request, for
+// authorizing the event streams of the browsers in the stream_token query
+// parameter. Being new, it answers the same in every version of the API.
+func (api *API) StreamTokenEndPoint(w http.ResponseWriter, r *http.Request) {
+	token, appErr := api.Service.IssueStreamToken(r.Context(), time.Now())
+	if appErr.Code != controller.DefaultAPIError().Code {
+		writeProblem(w, r, appErr.Status, []controller.APIError{appErr})
+		return
+	}
+	writeJSON(w, r, http.StatusCreated, token)
+}
@@ -0,0 +1,81 @@
+package rest
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/controller"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/export"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/validation"
+)
+
+// Parameters of the filters of the lists and the exports of evaluations.
+var FilterParams = []string{"domain", "grade", "in_progress", "since", "until"}
+
+// Function for parsing the filters of the lists and the exports of
+// evaluations: domain, grade, in_progress (true or false), and since and
+// until (RFC 3339 times). The missing parameters don't filter.
+func ParseEvaluationFilter(q url.Values) (filter dao.EvaluationFilter, err error) {
+	if v := q.Get("domain"); v != "" {
+		if filter.Domain, err = validation.NormalizeDomain(v); err != nil {
+			return
+		}
+	}
+	filter.SslGrade = q.Get("grade")
+	if v := q.Get("in_progress"); v != "" {
+		inProgress, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, fmt.Errorf("in_progress: %v", err)
+		}
+		filter.InProgress = &inProgress
+	}
+	for name, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := q.Get(name); v != "" {
+			if *t, err = time.Parse(time.RFC3339, v); err != nil {
+				return filter, fmt.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+	return
+}
+
+// Endpoint exporting the stored evaluations, joined with their servers, in
+// the format of the format parameter (csv by default, ndjson or xlsx) and
+// with the filters of the lists (see ParseEvaluationFilter). The evaluations
+// are streamed, so a failure after the first one can only cut the response.
+func (api *API) ExportEndPoint(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+	filter, err := ParseEvaluationFilter(q)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, []controller.APIError{controller.APIErrors.E905(err)})
+		return
+	}
+	contentType := export.ContentType(format)
+	if contentType == "" {
+		writeProblem(w, r, http.StatusBadRequest,
+			[]controller.APIError{controller.APIErrors.E905(fmt.Errorf("unknown export format %q", format))})
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="evaluations.`+format+`"`)
+	ew, err := export.NewWriter(format, w)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "export failed", "format", format, "error", err)
+		return
+	}
+	appErr := api.Service.ExportEvaluations(r.Context(), filter, ew.Write)
+	if appErr.Code != controller.DefaultAPIError().Code {
+		slog.ErrorContext(r.Context(), "export failed", "format", format, "error", appErr.Err)
+		return
+	}
+	ew.Close()
+}
@@ -0,0 +1,83 @@
+package rest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// FrontendConfig - Structure holding the settings injected in the frontend
+// through config.js.
+type FrontendConfig struct {
+	// Base URL of the API used by the pages, relative to the frontend or absolute.
+	APIBaseURL string `json:"apiBaseURL"`
+	// API key sent by the pages, when the API needs one. It's public, so it
+	// should be a key with low limits.
+	APIKey string `json:"apiKey,omitempty"`
+}
+
+// frontendFile - Structure representing a file of the frontend held in memory.
+type frontendFile struct {
+	content []byte
+	etag    string
+}
+
+// Function for building the handler serving the frontend held in files.
+// The pages and their scripts are revalidated on every load, using their ETag,
+// while the vendored libraries under assets/ are cached by the browsers.
+// config.js is generated from cfg, so the same binary can point the pages to
+// any API.
+func FrontendHandler(files fs.FS, cfg FrontendConfig) (http.Handler, error) {
+	contents := make(map[string]frontendFile)
+	err := fs.WalkDir(files, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(files, name)
+		if err != nil {
+			return err
+		}
+		contents[name] = newFrontendFile(content)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	configB, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	contents["config.js"] = newFrontendFile([]byte(fmt.Sprintf("window.APP_CONFIG = %s;\n", configB)))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		if name == "" {
+			name = "index.html"
+		}
+		file, ok := contents[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if strings.HasPrefix(name, "assets/") {
+			w.Header().Set("Cache-Control", "public, max-age=604800")
+		} else {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		w.Header().Set("ETag", file.etag)
+		http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(file.content))
+	}), nil
+}
+
+// Auxiliar function for keeping a file of the frontend together with its ETag.
+func newFrontendFile(content []byte) frontendFile {
+	sum := sha256.Sum256(content)
+	return frontendFile{content: content, etag: `"` + hex.EncodeToString(sum[:8]) + `"`}
+}
@@ -0,0 +1,40 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/controller"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/graph"
+)
+
+// Endpoint of the GraphQL API. The POST requests send the graph.Request as
+// their JSON body, and the GET requests in the query, variables and
+// operationName parameters. The GET requests can't run mutations.
+// Every executed request answers 200, with the errors of the fields in the
+// errors member of the body, as usual in GraphQL.
+func (api *API) GraphQLEndPoint(w http.ResponseWriter, r *http.Request) {
+	var request graph.Request
+	readOnly := r.Method == http.MethodGet
+	if readOnly {
+		q := r.URL.Query()
+		request.Query = q.Get("query")
+		request.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &request.Variables); err != nil {
+				writeProblem(w, r, http.StatusBadRequest, []controller.APIError{controller.APIErrors.E905(err)})
+				return
+			}
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, []controller.APIError{controller.APIErrors.E905(err)})
+		return
+	}
+	if request.Query == "" {
+		writeProblem(w, r, http.StatusBadRequest,
+			[]controller.APIError{controller.APIErrors.E905(errors.New("the request has no query"))})
+		return
+	}
+	writeJSON(w, r, http.StatusOK, api.GraphQL.Do(r.Context(), request, readOnly))
+}
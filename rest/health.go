@@ -0,0 +1,43 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/controller"
+)
+
+// Structure representing a response in the HealthEndPoint and ReadinessEndPoint
+type HealthResponse struct {
+	Status string                   `json:"status"`
+	Checks []controller.HealthCheck `json:"checks,omitempty"`
+}
+
+// Liveness endpoint: it only tells that the process is serving requests.
+func (api *API) HealthEndPoint(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+// Readiness endpoint: it answers 503 while the service can't evaluate domains,
+// so load balancers stop sending traffic to this instance.
+func (api *API) ReadinessEndPoint(w http.ResponseWriter, r *http.Request) {
+	ready, checks := api.Service.Readiness(r.Context())
+	if !ready {
+		writeHealth(w, http.StatusServiceUnavailable, HealthResponse{Status: "unavailable", Checks: checks})
+		return
+	}
+	writeHealth(w, http.StatusOK, HealthResponse{Status: "ok", Checks: checks})
+}
+
+// Auxiliar function for writing the responses of the health endpoints.
+func writeHealth(w http.ResponseWriter, status int, response HealthResponse) {
+	respB, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(respB)
+}
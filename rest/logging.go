@@ -0,0 +1,47 @@
+package rest
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/logging"
+)
+
+// Header carrying the request ID, both in the request and in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// Middleware attaching a request ID to the context of every request and
+// logging the request once it's served.
+// The request ID sent by the client (or a proxy) is kept when it's valid,
+// otherwise a new one is generated. Either way it's returned in the response.
+func RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		ctx := logging.WithRequestID(r.Context(), id)
+
+		sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sr, r.WithContext(ctx))
+		slog.InfoContext(ctx, "http request", "method", r.Method, "path", r.URL.Path,
+			"status", sr.status, "duration", time.Since(start))
+	})
+}
+
+// Auxiliar function for checking a request ID received from the client, so
+// it can be safely written in the logs and in the database.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
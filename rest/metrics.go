@@ -0,0 +1,54 @@
+package rest
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/metrics"
+)
+
+// statusRecorder - http.ResponseWriter remembering the status code of the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// Method for recording the status code before writing it.
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// Method for getting the original http.ResponseWriter, used by http.ResponseController.
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// Middleware counting the requests and observing their latency by route.
+// The route is the chi pattern (/domainEvaluations/{domainName}) instead of the
+// path, so the number of series doesn't grow with the number of domains.
+func Instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sr, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		metrics.HTTPRequests.WithLabelValues(route, r.Method, strconv.Itoa(sr.status)).Inc()
+		metrics.HTTPDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Endpoint exposing the metrics in the Prometheus text format.
+// The number of domains by grade is refreshed from the (cached) list of
+// recent evaluations before the metrics are written.
+func (api *API) MetricsEndPoint(w http.ResponseWriter, r *http.Request) {
+	api.Service.ListRecentEvaluations(r.Context(), time.Now())
+	promhttp.Handler().ServeHTTP(w, r)
+}
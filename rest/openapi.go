@@ -0,0 +1,383 @@
+package rest
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/controller"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/export"
+)
+
+// Operation - Structure describing an endpoint of the API in the OpenAPI document.
+type Operation struct {
+	Method  string
+	Path    string
+	Summary string
+	// Names of the parameters in the path, like domainName.
+	PathParams []string
+	// Names of the optional parameters in the query, like the filters of the lists.
+	QueryParams []string
+	// Bodies of the responses by status: a value of the type written by the
+	// endpoint, or nil for the responses without a body.
+	Responses map[int]interface{}
+	// Content type of the successful responses, application/json when empty.
+	// The bodies of the event streams are the data of each event.
+	ContentType string
+	// Whether the endpoint needs the admin token instead of an API key.
+	Admin bool
+}
+
+// Function listing the operations of the API documented in the OpenAPI
+// document: the ones of the versioned API, GraphQL and the admin endpoints.
+// The types of the responses are the ones written by the endpoints, so the
+// document can't drift from them.
+func Operations() []Operation {
+	problem := Problem{}
+	ops := []Operation{
+		{
+			Method: http.MethodGet, Path: "/api/v1/domainEvaluations/{domainName}",
+			Summary:     "Evaluates a domain. The errors are reported in the body, with a 200 status.",
+			PathParams:  []string{"domainName"},
+			QueryParams: []string{"baseline"},
+			Responses: map[int]interface{}{
+				http.StatusOK: EvaluationResponse{}, http.StatusBadRequest: problem,
+			},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v1/domainEvaluations/",
+			Summary:     "Lists the last evaluation of every domain. The errors are reported in the body, with a 200 status.",
+			QueryParams: FilterParams,
+			Responses:   map[int]interface{}{http.StatusOK: PastEvaluationsResponse{}, http.StatusBadRequest: problem},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/domainEvaluations/{domainName}",
+			Summary:     "Evaluates a domain. The status is 202 while SSLabs is still evaluating it.",
+			PathParams:  []string{"domainName"},
+			QueryParams: []string{"baseline"},
+			Responses: map[int]interface{}{
+				http.StatusOK: EvaluationResponseV2{}, http.StatusAccepted: EvaluationResponseV2{},
+				http.StatusBadRequest: problem, http.StatusBadGateway: problem,
+				http.StatusServiceUnavailable: problem, http.StatusGatewayTimeout: problem,
+			},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/domainEvaluations/",
+			Summary:     "Lists the last evaluation of every domain.",
+			QueryParams: FilterParams,
+			Responses: map[int]interface{}{
+				http.StatusOK: PastEvaluationsResponseV2{}, http.StatusBadRequest: problem,
+				http.StatusServiceUnavailable: problem,
+			},
+		},
+	}
+	// The endpoints answering the same in every version of the API.
+	for _, version := range []string{"v1", "v2"} {
+		evaluations := "/api/" + version + "/domainEvaluations"
+		ops = append(ops, []Operation{
+			{
+				Method: http.MethodGet, Path: evaluations + "/{domainName}/events",
+				Summary: "Streams the evaluation of a domain as Server-Sent Events, until it's ready. " +
+					"The browsers authorize it with the stream_token parameter.",
+				PathParams:  []string{"domainName"},
+				QueryParams: []string{"stream_token"},
+				ContentType: EventStreamContentType,
+				Responses: map[int]interface{}{
+					http.StatusOK: controller.EvaluationEvent{}, http.StatusBadRequest: problem,
+				},
+			},
+			{
+				Method: http.MethodGet, Path: evaluations + "/events",
+				Summary: "Streams the events of the evaluations of every domain as Server-Sent Events. " +
+					"The browsers authorize it with the stream_token parameter.",
+				QueryParams: []string{"stream_token"},
+				ContentType: EventStreamContentType,
+				Responses:   map[int]interface{}{http.StatusOK: controller.EvaluationEvent{}},
+			},
+			{
+				Method: http.MethodPost, Path: evaluations + "/streamTokens",
+				Summary: "Issues a short-lived token for the event streams of the API key of the request.",
+				Responses: map[int]interface{}{
+					http.StatusCreated: controller.StreamToken{},
+				},
+			},
+			{
+				Method: http.MethodGet, Path: evaluations + "/export",
+				Summary: "Exports the stored evaluations with their servers, in the format parameter: " +
+					"csv (the default), ndjson or xlsx.",
+				QueryParams: append([]string{"format"}, FilterParams...),
+				ContentType: export.ContentType(export.FormatCSV),
+				Responses: map[int]interface{}{
+					http.StatusOK: "", http.StatusBadRequest: problem,
+				},
+			},
+			{
+				Method: http.MethodGet, Path: evaluations + "/{domainName}/diff",
+				Summary: "Compares two evaluations of a domain, given their ids. " +
+					"Without them, the last two ready evaluations are compared.",
+				PathParams:  []string{"domainName"},
+				QueryParams: []string{"from", "to"},
+				Responses: map[int]interface{}{
+					http.StatusOK: dao.EvaluationDiff{}, http.StatusBadRequest: problem, http.StatusNotFound: problem,
+					http.StatusServiceUnavailable: problem,
+				},
+			},
+			{
+				Method: http.MethodPut, Path: evaluations + "/{domainName}/approvedBaseline",
+				Summary: "Approves an evaluation of a domain as its baseline, by default the last ready one. " +
+					"The evaluations of the domain report their drift from it. It needs the admin token.",
+				PathParams: []string{"domainName"},
+				Admin:      true,
+				Responses: map[int]interface{}{
+					http.StatusOK: dao.ApprovedBaseline{}, http.StatusBadRequest: problem, http.StatusNotFound: problem,
+					http.StatusServiceUnavailable: problem,
+				},
+			},
+			{
+				Method: http.MethodGet, Path: evaluations + "/{domainName}/approvedBaseline",
+				Summary:    "Reads the approved baseline of a domain.",
+				PathParams: []string{"domainName"},
+				Responses: map[int]interface{}{
+					http.StatusOK: dao.ApprovedBaseline{}, http.StatusBadRequest: problem, http.StatusNotFound: problem,
+					http.StatusServiceUnavailable: problem,
+				},
+			},
+			{
+				Method: http.MethodDelete, Path: evaluations + "/{domainName}/approvedBaseline",
+				Summary:    "Clears the approved baseline of a domain. It needs the admin token.",
+				PathParams: []string{"domainName"},
+				Admin:      true,
+				Responses: map[int]interface{}{
+					http.StatusNoContent: nil, http.StatusBadRequest: problem, http.StatusNotFound: problem,
+					http.StatusServiceUnavailable: problem,
+				},
+			},
+			{
+				Method: http.MethodPost, Path: evaluations + ":batch",
+				Summary: "Evaluates in the background a list of domains, sent as a JSON array or as CSV. " +
+					"The state of the batch is read in the URL of the Location header.",
+				Responses: map[int]interface{}{
+					http.StatusAccepted: controller.BatchResult{}, http.StatusBadRequest: problem,
+					http.StatusServiceUnavailable: problem,
+				},
+			},
+			{
+				Method: http.MethodGet, Path: evaluations + ":batch/{batchId}",
+				Summary:    "Reads the state of a batch and the results of its domains.",
+				PathParams: []string{"batchId"},
+				Responses: map[int]interface{}{
+					http.StatusOK: controller.BatchResult{}, http.StatusNotFound: problem,
+					http.StatusServiceUnavailable: problem,
+				},
+			},
+		}...)
+	}
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		ops = append(ops, Operation{
+			Method: method, Path: "/api/graphql",
+			Summary: "Runs a GraphQL request, sent as JSON in the POST requests and in the query, variables " +
+				"and operationName parameters in the GET ones, which can't run mutations. " +
+				"The errors of the fields are reported in the body, with a 200 status.",
+			Responses: map[int]interface{}{
+				http.StatusOK: graphql.Result{}, http.StatusBadRequest: problem,
+			},
+		})
+	}
+	ops = append(ops, []Operation{
+		{
+			Method: http.MethodPost, Path: "/admin/apiKeys/",
+			Summary: "Creates an API key. The key is only shown in this response.",
+			Admin:   true,
+			Responses: map[int]interface{}{
+				http.StatusCreated: CreateAPIKeyResponse{}, http.StatusBadRequest: problem,
+				http.StatusServiceUnavailable: problem,
+			},
+		},
+		{
+			Method: http.MethodGet, Path: "/admin/apiKeys/",
+			Summary: "Lists the API keys.",
+			Admin:   true,
+			Responses: map[int]interface{}{
+				http.StatusOK: APIKeysResponse{}, http.StatusServiceUnavailable: problem,
+			},
+		},
+		{
+			Method: http.MethodDelete, Path: "/admin/apiKeys/{id}",
+			Summary:    "Revokes an API key.",
+			PathParams: []string{"id"},
+			Admin:      true,
+			Responses: map[int]interface{}{
+				http.StatusNoContent: nil, http.StatusBadRequest: problem, http.StatusNotFound: problem,
+				http.StatusServiceUnavailable: problem,
+			},
+		},
+		{
+			Method: http.MethodGet, Path: "/admin/apiKeys/{id}/usage",
+			Summary:    "Reads the daily usage of an API key.",
+			PathParams: []string{"id"},
+			Admin:      true,
+			Responses: map[int]interface{}{
+				http.StatusOK: APIKeyUsageResponse{}, http.StatusBadRequest: problem, http.StatusNotFound: problem,
+				http.StatusServiceUnavailable: problem,
+			},
+		},
+	}...)
+	for i := range ops {
+		// Rejections of the API keys or the admin token, and of the rate limits.
+		ops[i].Responses[http.StatusUnauthorized] = problem
+		if !strings.HasPrefix(ops[i].Path, "/admin/") {
+			ops[i].Responses[http.StatusTooManyRequests] = problem
+		}
+	}
+	return ops
+}
+
+// Function for building the OpenAPI 3 document of the given operations. The
+// schemas of the bodies are generated from their Go types, using their json tags.
+func OpenAPIDocument(ops []Operation) map[string]interface{} {
+	g := schemaGenerator{schemas: make(map[string]interface{})}
+	paths := make(map[string]interface{})
+	for _, op := range ops {
+		item, ok := paths[op.Path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[op.Path] = item
+		}
+		params := make([]interface{}, 0)
+		for _, name := range op.PathParams {
+			params = append(params, map[string]interface{}{
+				"name": name, "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		for _, name := range op.QueryParams {
+			params = append(params, map[string]interface{}{
+				"name": name, "in": "query", "schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		responses := make(map[string]interface{})
+		for status, body := range op.Responses {
+			response := map[string]interface{}{"description": http.StatusText(status)}
+			responses[strconv.Itoa(status)] = response
+			if body == nil {
+				continue
+			}
+			contentType := "application/json"
+			if _, ok := body.(Problem); ok {
+				contentType = ProblemContentType
+			} else if op.ContentType != "" {
+				contentType = op.ContentType
+			}
+			response["content"] = map[string]interface{}{
+				contentType: map[string]interface{}{"schema": g.schema(reflect.TypeOf(body))},
+			}
+		}
+		// The API key is only needed when the server requires it.
+		security := []interface{}{map[string]interface{}{"apiKey": []string{}}, map[string]interface{}{}}
+		if op.Admin {
+			security = []interface{}{map[string]interface{}{"adminToken": []string{}}}
+		}
+		item[strings.ToLower(op.Method)] = map[string]interface{}{
+			"summary":    op.Summary,
+			"parameters": params,
+			"responses":  responses,
+			"security":   security,
+		}
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    map[string]interface{}{"title": "Domain evaluations API", "version": "2"},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]interface{}{
+				"apiKey":     map[string]interface{}{"type": "apiKey", "in": "header", "name": APIKeyHeader},
+				"adminToken": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+// schemaGenerator - Structure building the schemas of Go types. The named
+// structs are kept in schemas and referenced from the other schemas.
+type schemaGenerator struct {
+	schemas map[string]interface{}
+}
+
+// Method for getting the schema of a Go type.
+func (g *schemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Ptr:
+		s := g.schema(t.Elem())
+		if _, ok := s["$ref"]; ok {
+			// $ref can't have siblings in OpenAPI 3.0.
+			return map[string]interface{}{"allOf": []interface{}{s}, "nullable": true}
+		}
+		s["nullable"] = true
+		return s
+	case t.Kind() == reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case t.Kind() == reflect.Struct:
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := g.schemas[t.Name()]; ok {
+			return ref
+		}
+		s := map[string]interface{}{"type": "object", "additionalProperties": false}
+		g.schemas[t.Name()] = s
+		properties := make(map[string]interface{})
+		required := make([]string, 0)
+		g.fields(t, properties, &required)
+		s["properties"] = properties
+		if len(required) > 0 {
+			s["required"] = required
+		}
+		return ref
+	case t.Kind() == reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case t.Kind() == reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case t.Kind() == reflect.Interface:
+		return map[string]interface{}{"nullable": true}
+	}
+	return map[string]interface{}{}
+}
+
+// Auxiliar method for adding the json fields of a struct to properties,
+// including the fields of its embedded structs.
+func (g *schemaGenerator) fields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.fields(f.Type, properties, required)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = g.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// Endpoint serving the OpenAPI document of the versioned API.
+func (api *API) OpenAPIEndPoint(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, OpenAPIDocument(Operations()))
+}
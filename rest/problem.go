@@ -0,0 +1,125 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/controller"
+)
+
+// Versions of the responses of the API.
+const (
+	// V1 always answers 200 and reports the errors in the errors array of the body.
+	V1 = 1
+	// V2 answers with the http status mapped from the APIErrors, and with a
+	// problem (RFC 7807) body when the request fails.
+	V2 = 2
+)
+
+// Header used by the clients for choosing the version of the responses.
+const VersionHeader = "X-API-Version"
+
+// Content type of the problem responses.
+const ProblemContentType = "application/problem+json"
+
+// Problem - Structure representing a problem response, as described in RFC 7807.
+// The APIErrors of the request are kept in the errors extension member.
+type Problem struct {
+	Type     string                `json:"type"`
+	Title    string                `json:"title"`
+	Status   int                   `json:"status"`
+	Detail   string                `json:"detail,omitempty"`
+	Instance string                `json:"instance,omitempty"`
+	Errors   []controller.APIError `json:"errors,omitempty"`
+}
+
+// Key of the version chosen by the route in the context of a request.
+type versionKey struct{}
+
+// Middleware fixing the version of the responses of a group of routes, like
+// /api/v1 and /api/v2. The headers of the request are ignored then.
+func WithVersion(version int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), versionKey{}, version)))
+		})
+	}
+}
+
+// Method for getting the version of the responses for a request.
+// The version is the one fixed by the route (see WithVersion), otherwise it's
+// taken from the X-API-Version header, then from the Accept header (asking
+// for problem responses means V2), and finally from the DefaultVersion of the API.
+func (api *API) version(r *http.Request) int {
+	if v, ok := r.Context().Value(versionKey{}).(int); ok {
+		return v
+	}
+	if v, err := strconv.Atoi(r.Header.Get(VersionHeader)); err == nil && (v == V1 || v == V2) {
+		return v
+	}
+	if strings.Contains(r.Header.Get("Accept"), ProblemContentType) {
+		return V2
+	}
+	if api.DefaultVersion == V2 {
+		return V2
+	}
+	return V1
+}
+
+// Method for writing the response of an endpoint according to its APIErrors.
+// In V1 the body is always written with a 200 status. In V2 the status is
+// mapped from the APIErrors and, when it's an error status, a problem is
+// written instead of the body. In both versions, the rate limit errors set
+// the Retry-After header.
+func (api *API) respond(w http.ResponseWriter, r *http.Request, body interface{},
+	appErrs []controller.APIError, inProgress bool) {
+	setRetryAfter(w, appErrs)
+	if api.version(r) == V1 {
+		writeJSON(w, r, http.StatusOK, body)
+		return
+	}
+	status := controller.HTTPStatus(appErrs, inProgress)
+	if status >= http.StatusBadRequest {
+		writeProblem(w, r, status, appErrs)
+		return
+	}
+	writeJSON(w, r, status, body)
+}
+
+// Auxiliar function for writing a json body with the given status. A body
+// that can't be encoded is reported as a 500 problem.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, body interface{}) {
+	respB, err := json.Marshal(body)
+	if err != nil {
+		writeProblem(w, r, http.StatusInternalServerError, nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(respB)
+}
+
+// Auxiliar function for writing a problem response. The detail of the problem
+// is the description of the most severe APIError.
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, appErrs []controller.APIError) {
+	problem := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Instance: r.URL.Path,
+		Errors:   appErrs,
+	}
+	for _, appErr := range appErrs {
+		if appErr.Status == status {
+			problem.Detail = appErr.Description + " " + appErr.Err
+			break
+		}
+	}
+	respB, _ := json.Marshal(problem)
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(status)
+	w.Write(respB)
+}
@@ -0,0 +1,98 @@
+package rest
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/controller"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/ratelimit"
+)
+
+// Function for getting the IP of the client of a request.
+// The X-Forwarded-For header is only honoured when the request comes from one
+// of the trusted proxies: the header is read from right to left, skipping the
+// trusted proxies, and the first address left is the client. Otherwise the
+// client is the remote address of the connection.
+func ClientIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	remote = remote.Unmap()
+	if !trusted(remote, trustedProxies) {
+		return remote.String()
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// A malformed hop can't be trusted, neither the ones before it.
+			break
+		}
+		addr = addr.Unmap()
+		if !trusted(addr, trustedProxies) {
+			return addr.String()
+		}
+		remote = addr
+	}
+	return remote.String()
+}
+
+// Auxiliar function telling if addr is in one of the prefixes.
+func trusted(addr netip.Addr, prefixes []netip.Prefix) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware limiting the requests of every client (by IP, see ClientIP) to
+// ClientRateLimit requests per minute. The client is stored in the context of
+// the request, so the controller can limit the new evaluations per client.
+// The rejections are 429 problems with a Retry-After header in every version
+// of the responses.
+func (api *API) RateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := ClientIP(r, api.TrustedProxies)
+		ctx := ratelimit.WithClient(r.Context(), client)
+		err := ratelimit.Check(ctx, api.Service.Limiter, "requests:"+client,
+			ratelimit.Rate{Limit: api.ClientRateLimit, Per: time.Minute})
+		var limitErr *ratelimit.LimitError
+		if errors.As(err, &limitErr) {
+			appErrs := []controller.APIError{controller.APIErrors.E908(limitErr)}
+			setRetryAfter(w, appErrs)
+			writeProblem(w, r, http.StatusTooManyRequests, appErrs)
+			return
+		}
+		if err != nil {
+			// A failing limiter doesn't take the API down.
+			slog.WarnContext(ctx, "rate limiter failed", "error", err)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Auxiliar function for setting the Retry-After header from the rate limit
+// errors of a response.
+func setRetryAfter(w http.ResponseWriter, appErrs []controller.APIError) {
+	var wait time.Duration
+	for _, appErr := range appErrs {
+		if appErr.RetryAfter > wait {
+			wait = appErr.RetryAfter
+		}
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", retryAfter(wait))
+	}
+}
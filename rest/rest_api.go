@@ -3,12 +3,15 @@
 package rest
 
 import (
-	"encoding/json"
+	"context"
 	"net/http"
+	"net/netip"
 	"time"
 	"github.com/go-chi/chi"
 	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
 	"github.com/trotsdeveloper/truora_test/truora_test_golang/controller"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/graph"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/validation"
 )
 
 // Structure representing a response in the EvaluateDomainEndpoint
@@ -23,28 +26,57 @@ type PastEvaluationsResponse struct {
 	APIErrors []controller.APIError `json:"errors"`
 }
 
-func EvaluateDomainEndPoint(w http.ResponseWriter, r *http.Request) {
-	domain := chi.URLParam(r, "domainName")
-	currentHour := time.Now()
-	sec, apiErrs := controller.ScraperTestComplete(domain, currentHour, dao.DBConf)
-	response := EvaluationResponse{Evaluation:sec, APIErrors:apiErrs}
-	respB, _ := json.Marshal(response)
-	w.Header().Set("Access-Control-Allow-Credentials", "true")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Content-Type", "application/json; charset=utf-8") // normal header
-	w.WriteHeader(http.StatusOK)
-	w.Write(respB[:])
+// API - Structure holding the dependencies of the endpoints.
+// DefaultVersion is the version of the responses for the clients that don't
+// choose one, V1 when it's zero. AdminToken is the bearer token of the admin
+// endpoints, they are disabled when it's empty. ClientRateLimit is the number
+// of requests per minute of every client (zero means no limit), and
+// TrustedProxies are the proxies whose X-Forwarded-For header is honoured.
+// GraphQL is the schema of the GraphQL endpoint.
+type API struct {
+	Service *controller.Service
+	DefaultVersion int
+	AdminToken string
+	ClientRateLimit int
+	TrustedProxies []netip.Prefix
+	GraphQL *graph.Schema
+
+	// Context of the event streams, cancelled by CloseStreams.
+	streams context.Context
+	closeStreams context.CancelFunc
 }
 
-func ViewPastEvaluationsEndPoint(w http.ResponseWriter, r *http.Request) {
+// Default constructor for the API struct.
+func NewAPI(service *controller.Service) *API {
+	streams, closeStreams := context.WithCancel(context.Background())
+	return &API{Service: service, DefaultVersion: V1, streams: streams, closeStreams: closeStreams}
+}
+
+func (api *API) EvaluateDomainEndPoint(w http.ResponseWriter, r *http.Request) {
+	domain, err := validation.NormalizeDomain(chi.URLParam(r, "domainName"))
+	if err != nil {
+		// Invalid input is a 400 in every version of the responses.
+		writeProblem(w, r, http.StatusBadRequest, []controller.APIError{controller.APIErrors.E901(err)})
+		return
+	}
+	baseline, err := parseBaseline(r)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, []controller.APIError{controller.APIErrors.E905(err)})
+		return
+	}
+	sec, apiErrs := api.evaluate(r, domain, baseline)
+	response := EvaluationResponse{Evaluation:sec, APIErrors:apiErrs}
+	api.respond(w, r, response, apiErrs, sec.EvaluationInProgress)
+}
 
+func (api *API) ViewPastEvaluationsEndPoint(w http.ResponseWriter, r *http.Request) {
+	filter, err := ParseEvaluationFilter(r.URL.Query())
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, []controller.APIError{controller.APIErrors.E905(err)})
+		return
+	}
 	currentHour := time.Now()
-	apiErrs := controller.ListRecentEvaluations(currentHour, dao.DBConf)
-	response := PastEvaluationsResponse{Evaluations: controller.RecentEvaluations, APIErrors:apiErrs}
-	respB, _ := json.Marshal(response)
-	w.Header().Set("Access-Control-Allow-Credentials", "true")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Content-Type", "application/json; charset=utf-8") // normal header
-	w.WriteHeader(http.StatusOK)
-	w.Write(respB[:])
+	evaluations, apiErrs := api.Service.ListRecentEvaluations(r.Context(), currentHour)
+	response := PastEvaluationsResponse{Evaluations: filter.Filter(evaluations), APIErrors:apiErrs}
+	api.respond(w, r, response, apiErrs, false)
 }
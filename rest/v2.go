@@ -0,0 +1,116 @@
+package rest
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/controller"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/validation"
+)
+
+// EvaluationV2 - Structure representing the evaluation of a domain in the v2
+// API. It uses the same names as EvaluationSummaryV2 for the same fields.
+type EvaluationV2 struct {
+	Domain           string             `json:"domain"`
+	InProgress       bool               `json:"in_progress"`
+	IsDown           bool               `json:"is_down"`
+	SslGrade         string             `json:"ssl_grade"`
+	PreviousSslGrade string             `json:"previous_ssl_grade"`
+	ServersChanged   bool               `json:"servers_changed"`
+	Baseline         *dao.EvaluationRef `json:"baseline"`
+	Drift            *dao.Drift         `json:"drift"`
+	Logo             string             `json:"logo"`
+	Title            string             `json:"title"`
+	Servers          []dao.Server       `json:"servers"`
+}
+
+// EvaluationSummaryV2 - Structure representing a past evaluation of a domain
+// in the v2 API, without its servers.
+type EvaluationSummaryV2 struct {
+	Domain      string `json:"domain"`
+	EvaluatedAt string `json:"evaluated_at"`
+	InProgress  bool   `json:"in_progress"`
+	IsDown      bool   `json:"is_down"`
+	SslGrade    string `json:"ssl_grade"`
+	Logo        string `json:"logo"`
+	Title       string `json:"title"`
+}
+
+// Structure representing a response in the EvaluateDomainV2EndPoint
+type EvaluationResponseV2 struct {
+	Evaluation EvaluationV2          `json:"evaluation"`
+	APIErrors  []controller.APIError `json:"errors"`
+}
+
+// Structure representing a response in the ViewPastEvaluationsV2EndPoint
+type PastEvaluationsResponseV2 struct {
+	Evaluations []EvaluationSummaryV2 `json:"evaluations"`
+	APIErrors   []controller.APIError `json:"errors"`
+}
+
+// Function for building the v2 representation of a complete evaluation.
+func NewEvaluationV2(domain string, dec dao.DomainEvaluationComplete) EvaluationV2 {
+	servers := dec.Servers
+	if servers == nil {
+		servers = make([]dao.Server, 0)
+	}
+	return EvaluationV2{
+		Domain:           domain,
+		InProgress:       dec.EvaluationInProgress,
+		IsDown:           dec.IsDown,
+		SslGrade:         dec.SslGrade,
+		PreviousSslGrade: dec.PreviousSslGrade,
+		ServersChanged:   dec.ServersChanged,
+		Baseline:         dec.Baseline,
+		Drift:            dec.Drift,
+		Logo:             dec.Logo,
+		Title:            dec.Title,
+		Servers:          servers,
+	}
+}
+
+// Function for building the v2 representation of a past evaluation.
+func NewEvaluationSummaryV2(de dao.DomainEvaluation) EvaluationSummaryV2 {
+	return EvaluationSummaryV2{
+		Domain:      de.Domain,
+		EvaluatedAt: de.EvaluationHour,
+		InProgress:  de.EvaluationInProgress,
+		IsDown:      de.IsDown,
+		SslGrade:    de.SslGrade,
+		Logo:        de.Logo,
+		Title:       de.Title,
+	}
+}
+
+func (api *API) EvaluateDomainV2EndPoint(w http.ResponseWriter, r *http.Request) {
+	domain, err := validation.NormalizeDomain(chi.URLParam(r, "domainName"))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, []controller.APIError{controller.APIErrors.E901(err)})
+		return
+	}
+	baseline, err := parseBaseline(r)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, []controller.APIError{controller.APIErrors.E905(err)})
+		return
+	}
+	dec, appErrs := api.evaluate(r, domain, baseline)
+	response := EvaluationResponseV2{Evaluation: NewEvaluationV2(domain, dec), APIErrors: appErrs}
+	api.respond(w, r, response, appErrs, dec.EvaluationInProgress)
+}
+
+func (api *API) ViewPastEvaluationsV2EndPoint(w http.ResponseWriter, r *http.Request) {
+	filter, err := ParseEvaluationFilter(r.URL.Query())
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, []controller.APIError{controller.APIErrors.E905(err)})
+		return
+	}
+	evaluations, appErrs := api.Service.ListRecentEvaluations(r.Context(), time.Now())
+	response := PastEvaluationsResponseV2{Evaluations: make([]EvaluationSummaryV2, 0, len(evaluations)),
+		APIErrors: appErrs}
+	for _, de := range filter.Filter(evaluations) {
+		response.Evaluations = append(response.Evaluations, NewEvaluationSummaryV2(de))
+	}
+	api.respond(w, r, response, appErrs, false)
+}
@@ -0,0 +1,322 @@
+// Package for the declaration of the gRPC API
+// The package implements the Evaluations service of the evaluationspb package
+// on top of the controller, for the internal services.
+package rpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/controller"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+	pb "github.com/trotsdeveloper/truora_test/truora_test_golang/evaluationspb"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/logging"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/ratelimit"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/validation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Metadata keys of the API key and of the request ID, the same as the
+// headers of the REST API.
+const (
+	APIKeyMetadata    = "x-api-key"
+	RequestIDMetadata = "x-request-id"
+)
+
+// Server - Structure implementing the Evaluations service.
+// When RequireAPIKey is true, the calls need a valid API key in their metadata,
+// and EvaluateDomain and WatchDomain count against its daily quota.
+// WatchInterval is the time between the evaluations of WatchDomain when the
+// client doesn't choose it, and also the shortest one allowed.
+type Server struct {
+	pb.UnimplementedEvaluationsServer
+	Service       *controller.Service
+	RequireAPIKey bool
+	WatchInterval time.Duration
+	streams       context.Context // cancelled by CloseStreams
+	closeStreams  context.CancelFunc
+}
+
+// Default constructor for the Server struct.
+func NewServer(service *controller.Service) *Server {
+	streams, closeStreams := context.WithCancel(context.Background())
+	return &Server{Service: service, RequireAPIKey: true, WatchInterval: time.Second * 5,
+		streams: streams, closeStreams: closeStreams}
+}
+
+// Method for ending the WatchDomain calls open, and the ones opened afterwards.
+// The calls only end when their clients go away, so it must be called before
+// grpc.Server.GracefulStop.
+func (s *Server) CloseStreams() {
+	s.closeStreams()
+}
+
+// Method for building a grpc.Server serving the Evaluations service, with the
+// interceptors for the request IDs, the clients and the API keys.
+func (s *Server) GRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.UnaryInterceptor(s.unaryInterceptor), grpc.StreamInterceptor(s.streamInterceptor))
+	srv := grpc.NewServer(opts...)
+	pb.RegisterEvaluationsServer(srv, s)
+	return srv
+}
+
+// Auxiliar method for preparing the context of a call: it attaches the request
+// ID, the client (for the limits of new evaluations) and the API key.
+func (s *Server) authorize(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	id := first(RequestIDMetadata)
+	if id == "" || len(id) > 64 {
+		id = logging.NewRequestID()
+	}
+	ctx = logging.WithRequestID(ctx, id)
+	if p, ok := peer.FromContext(ctx); ok {
+		client := p.Addr.String()
+		if host, _, err := net.SplitHostPort(client); err == nil {
+			client = host
+		}
+		ctx = ratelimit.WithClient(ctx, client)
+	}
+	if !s.RequireAPIKey {
+		return ctx, nil
+	}
+	// The watch streams count each new evaluation they start instead.
+	watch := strings.HasSuffix(method, "/WatchDomain")
+	evaluation := strings.HasSuffix(method, "/EvaluateDomain")
+	key, _, appErr := s.Service.AuthorizeAPIKey(ctx, first(APIKeyMetadata), evaluation, time.Now())
+	if appErr.Code != controller.DefaultAPIError().Code {
+		return ctx, statusError(appErr)
+	}
+	ctx = controller.WithAPIKey(ctx, key)
+	if watch {
+		ctx = controller.WithEvaluationCharges(ctx)
+	}
+	return ctx, nil
+}
+
+func (s *Server) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	ctx, err := s.authorize(ctx, info.FullMethod)
+	var resp interface{}
+	if err == nil {
+		resp, err = handler(ctx, req)
+	}
+	slog.InfoContext(ctx, "grpc request", "method", info.FullMethod, "code", status.Code(err).String(),
+		"duration", time.Since(start))
+	return resp, err
+}
+
+func (s *Server) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	start := time.Now()
+	ctx, err := s.authorize(ss.Context(), info.FullMethod)
+	if err == nil {
+		err = handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+	slog.InfoContext(ctx, "grpc stream", "method", info.FullMethod, "code", status.Code(err).String(),
+		"duration", time.Since(start))
+	return err
+}
+
+// serverStream - Structure replacing the context of a grpc.ServerStream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
+
+// Auxiliar function for the status of the calls rejected with an APIError,
+// from its http status.
+func statusError(appErr controller.APIError) error {
+	code := codes.Internal
+	switch appErr.Status {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	case http.StatusServiceUnavailable, http.StatusBadGateway:
+		code = codes.Unavailable
+	case http.StatusGatewayTimeout:
+		code = codes.DeadlineExceeded
+	}
+	return status.Error(code, appErr.Code+": "+appErr.Description+" "+appErr.Err)
+}
+
+// Auxiliar function for the domain of a request, invalid domains are
+// rejected with InvalidArgument.
+func normalize(domain string) (string, error) {
+	domain, err := validation.NormalizeDomain(domain)
+	if err != nil {
+		return "", statusError(controller.APIErrors.E901(err))
+	}
+	return domain, nil
+}
+
+func (s *Server) EvaluateDomain(ctx context.Context, req *pb.EvaluateDomainRequest) (*pb.EvaluationResponse, error) {
+	domain, err := normalize(req.GetDomain())
+	if err != nil {
+		return nil, err
+	}
+	dec, appErrs := s.Service.ScraperTestComplete(ctx, domain, time.Now())
+	return &pb.EvaluationResponse{Domain: domain, Evaluation: toComplete(dec), Errors: toAPIErrors(appErrs)}, nil
+}
+
+func (s *Server) GetEvaluation(ctx context.Context, req *pb.GetEvaluationRequest) (*pb.GetEvaluationResponse, error) {
+	domain, err := normalize(req.GetDomain())
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.GetEvaluationResponse{}
+	history, appErr := s.Service.DomainHistory(ctx, domain, 1)
+	if appErr.Code != controller.DefaultAPIError().Code {
+		resp.Errors = toAPIErrors([]controller.APIError{appErr})
+		return resp, nil
+	}
+	evaluations, appErr := s.withServers(ctx, history)
+	if appErr.Code != controller.DefaultAPIError().Code {
+		resp.Errors = toAPIErrors([]controller.APIError{appErr})
+	}
+	if len(evaluations) > 0 {
+		resp.Evaluation = evaluations[0]
+	}
+	return resp, nil
+}
+
+func (s *Server) ListRecent(ctx context.Context, req *pb.ListRecentRequest) (*pb.ListRecentResponse, error) {
+	recent, appErrs := s.Service.ListRecentEvaluations(ctx, time.Now())
+	evaluations, appErr := s.withServers(ctx, recent)
+	if appErr.Code != controller.DefaultAPIError().Code {
+		appErrs = append(appErrs, appErr)
+	}
+	return &pb.ListRecentResponse{Evaluations: evaluations, Errors: toAPIErrors(appErrs)}, nil
+}
+
+// WatchDomain
+// The domain is evaluated every interval (see EvaluateDomainTW for when a new
+// evaluation really starts) and the response is sent the first time and then
+// every time it changes, until the client cancels the call or the streams are
+// closed. Each new evaluation counts against the daily quota of the API key,
+// and the call ends with ResourceExhausted once it's spent.
+func (s *Server) WatchDomain(req *pb.WatchDomainRequest, stream pb.Evaluations_WatchDomainServer) error {
+	domain, err := normalize(req.GetDomain())
+	if err != nil {
+		return err
+	}
+	interval := time.Duration(req.GetIntervalSeconds()) * time.Second
+	if interval < s.WatchInterval {
+		interval = s.WatchInterval
+	}
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	stop := context.AfterFunc(s.streams, cancel)
+	defer stop()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last *pb.EvaluationResponse
+	for {
+		dec, appErrs := s.Service.ScraperTestComplete(ctx, domain, time.Now())
+		for _, appErr := range appErrs {
+			if appErr.Code == "904" {
+				return statusError(appErr)
+			}
+		}
+		resp := &pb.EvaluationResponse{Domain: domain, Evaluation: toComplete(dec), Errors: toAPIErrors(appErrs)}
+		if ctx.Err() == nil && !proto.Equal(resp, last) {
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+			last = resp
+		}
+		select {
+		case <-ctx.Done():
+			if s.streams.Err() != nil {
+				return status.Error(codes.Unavailable, "the server is shutting down")
+			}
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return nil
+			}
+			return status.FromContextError(ctx.Err()).Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Auxiliar method for the messages of a list of evaluations, with their
+// servers loaded in a single query.
+func (s *Server) withServers(ctx context.Context, del []dao.DomainEvaluation) ([]*pb.DomainEvaluation,
+	controller.APIError) {
+	ids := make([]int, len(del))
+	for i := range del {
+		ids[i] = del[i].Id
+	}
+	servers, appErr := s.Service.ListServersByEvaluations(ctx, ids)
+	evaluations := make([]*pb.DomainEvaluation, len(del))
+	for i, de := range del {
+		evaluations[i] = &pb.DomainEvaluation{
+			Domain:     de.Domain,
+			Hour:       de.EvaluationHour,
+			InProgress: de.EvaluationInProgress,
+			SslGrade:   de.SslGrade,
+			Logo:       de.Logo,
+			Title:      de.Title,
+			IsDown:     de.IsDown,
+			Servers:    toServers(servers[de.Id]),
+		}
+	}
+	return evaluations, appErr
+}
+
+// Auxiliar function for the message of a DomainEvaluationComplete.
+func toComplete(dec dao.DomainEvaluationComplete) *pb.DomainEvaluationComplete {
+	return &pb.DomainEvaluationComplete{
+		EvaluationInProgress: dec.EvaluationInProgress,
+		Servers:              toServers(dec.Servers),
+		ServersChanged:       dec.ServersChanged,
+		SslGrade:             dec.SslGrade,
+		PreviousSslGrade:     dec.PreviousSslGrade,
+		Logo:                 dec.Logo,
+		Title:                dec.Title,
+		IsDown:               dec.IsDown,
+	}
+}
+
+// Auxiliar function for the messages of a list of servers.
+func toServers(servers []dao.Server) []*pb.Server {
+	messages := make([]*pb.Server, len(servers))
+	for i, sv := range servers {
+		messages[i] = &pb.Server{Address: sv.Address, SslGrade: sv.SslGrade, Country: sv.Country, Owner: sv.Owner}
+	}
+	return messages
+}
+
+// Auxiliar function for the messages of a list of APIErrors.
+func toAPIErrors(appErrs []controller.APIError) []*pb.APIError {
+	messages := make([]*pb.APIError, len(appErrs))
+	for i, appErr := range appErrs {
+		messages[i] = &pb.APIError{Code: appErr.Code, Description: appErr.Description, ErrorMessage: appErr.Err}
+	}
+	return messages
+}
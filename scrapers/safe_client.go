@@ -0,0 +1,174 @@
+package scrapers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// SafeClientConfig - Struct holding the settings of the http client used for
+// fetching the homepages of the evaluated domains.
+type SafeClientConfig struct {
+	// Ranges allowed even if they are private, loopback or link-local.
+	Allowlist []netip.Prefix
+	// Maximum number of redirects followed by a request.
+	MaxRedirects int
+	// Maximum size of a response body, bigger bodies fail the request.
+	MaxBodySize int64
+	// Time to wait for the connection to a server.
+	DialTimeout time.Duration
+}
+
+// Default constructor for the SafeClientConfig struct.
+func DefaultSafeClientConfig() SafeClientConfig {
+	return SafeClientConfig{
+		MaxRedirects: 3,
+		MaxBodySize:  2 << 20,
+		DialTimeout:  time.Second * 5,
+	}
+}
+
+// BlockedError - Error returned when a request is blocked because it would
+// connect to an address that must not be reached from the scrapers.
+type BlockedError struct {
+	Address netip.Addr
+	Reason  string
+}
+
+// Method for implementing the error interface.
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("Connection to %v blocked: %v.", e.Address, e.Reason)
+}
+
+// Ranges blocked by default, together with the reason used in BlockedError.
+// Loopback, private and link-local ranges are checked with the netip methods.
+var blockedRanges = map[string]netip.Prefix{
+	"this network":          netip.MustParsePrefix("0.0.0.0/8"),
+	"shared address space":  netip.MustParsePrefix("100.64.0.0/10"),
+	"reserved address":      netip.MustParsePrefix("240.0.0.0/4"),
+	"benchmarking address":  netip.MustParsePrefix("198.18.0.0/15"),
+	"IPv4/IPv6 translation": netip.MustParsePrefix("64:ff9b::/96"),
+	"documentation address": netip.MustParsePrefix("2001:db8::/32"),
+	"IETF protocol address": netip.MustParsePrefix("192.0.0.0/24"),
+}
+
+// Function for checking if an address can be reached by the scrapers.
+// It returns the reason why the address is blocked, or an empty string.
+func blockedReason(addr netip.Addr, allowlist []netip.Prefix) string {
+	addr = addr.Unmap()
+	for _, p := range allowlist {
+		if p.Contains(addr) {
+			return ""
+		}
+	}
+	switch {
+	case addr.IsLoopback():
+		return "loopback address"
+	case addr.IsPrivate():
+		return "private address"
+	case addr.IsLinkLocalUnicast(), addr.IsLinkLocalMulticast():
+		return "link-local address"
+	case addr.IsUnspecified():
+		return "unspecified address"
+	case addr.IsMulticast(), addr.IsInterfaceLocalMulticast():
+		return "multicast address"
+	}
+	for reason, p := range blockedRanges {
+		if p.Contains(addr) {
+			return reason
+		}
+	}
+	return ""
+}
+
+// Default constructor for the http client used for fetching the homepages.
+// The client checks every address right before connecting to it, that is,
+// after the name was resolved, so a DNS answer changing between the check
+// and the connection can't be used for reaching a blocked address. Proxies
+// are ignored for the same reason.
+func NewSafeClient(cfg SafeClientConfig) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: cfg.DialTimeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if reason := blockedReason(addrPort.Addr(), cfg.Allowlist); reason != "" {
+				return &BlockedError{Address: addrPort.Addr().Unmap(), Reason: reason}
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       time.Second * 30,
+		TLSHandshakeTimeout:   time.Second * 5,
+		ResponseHeaderTimeout: time.Second * 10,
+	}
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > cfg.MaxRedirects {
+				return fmt.Errorf("stopped after %v redirects", cfg.MaxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// Error returned when a response body is bigger than the MaxBodySize.
+var ErrBodyTooLarge = errors.New("response body too large")
+
+// Auxiliar function for reading a response body of at most maxSize bytes.
+func readLimited(body io.Reader, maxSize int64) ([]byte, error) {
+	b, err := io.ReadAll(io.LimitReader(body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > maxSize {
+		return nil, ErrBodyTooLarge
+	}
+	return b, nil
+}
+
+// HomepageScraper - Scraper of the logo and the title in the homepage of a
+// domain, fetched with a safe client.
+type HomepageScraper struct {
+	Client      *http.Client
+	MaxBodySize int64
+}
+
+// Default constructor for the HomepageScraper struct.
+func NewHomepageScraper(cfg SafeClientConfig) *HomepageScraper {
+	return &HomepageScraper{Client: NewSafeClient(cfg), MaxBodySize: cfg.MaxBodySize}
+}
+
+// HomepageScraper used by ScraperLogo and ScraperTitle.
+var defaultHomepageScraper = NewHomepageScraper(DefaultSafeClientConfig())
+
+// Method for getting the html in the homepage of a domain.
+func (h *HomepageScraper) getHTML(ctx context.Context, domain string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%v/", domain), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return readLimited(resp.Body, h.MaxBodySize)
+}
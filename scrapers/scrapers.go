@@ -3,14 +3,17 @@
 package scrapers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 	"github.com/trotsdeveloper/truora_test/truora_test_golang/dao"
+	"github.com/trotsdeveloper/truora_test/truora_test_golang/metrics"
 	"golang.org/x/net/html"
 )
 
@@ -22,11 +25,12 @@ const (
 // Function for getting the country from a specific ip.
 // The function connects to the WHOISXMLAPI Geopify App in order to extract
 // the information
-func ScraperCountry(ip string) (country string, err error) {
+func ScraperCountry(ctx context.Context, ip string) (country string, err error) {
+	defer observe(ctx, "country", time.Now(), &err)
 	url := "https://geoipify.whoisxmlapi.com/api/v1?apiKey="+WHOISXMLAPI_KEY+"&ipAddress="+ip+"&outputFormat=json"
 	var apiInfo map[string]interface{}
 
-	r, err := http.Get(url)
+	r, err := httpGet(ctx, url)
 	if err != nil {
 		return
 	}
@@ -49,11 +53,12 @@ func ScraperCountry(ip string) (country string, err error) {
 // Function for getting the owner from a specific ip.
 // The function connects to the WHOISXMLAPI WhoisService App in order
 // to extract the information.
-func ScraperOwner(ip string) (owner string, err error) {
+func ScraperOwner(ctx context.Context, ip string) (owner string, err error) {
+	defer observe(ctx, "owner", time.Now(), &err)
 	url := "https://www.whoisxmlapi.com/whoisserver/WhoisService?apiKey="+WHOISXMLAPI_KEY+"&domainName="+ip+"&outputFormat=json"
 	var apiInfo map[string]interface{}
 
-	r, err := http.Get(url)
+	r, err := httpGet(ctx, url)
 	if err != nil {
 		return
 	}
@@ -63,7 +68,6 @@ func ScraperOwner(ip string) (owner string, err error) {
 	}
 	whoisRecord, ok := apiInfo["WhoisRecord"]
 	if !ok {
-		fmt.Println()
 		err = errors.New("Error getting owner from IP "+ip+" in WHOISXML API")
 		return
 	}
@@ -77,11 +81,32 @@ func ScraperOwner(ip string) (owner string, err error) {
 	return
 }
 
+// Function for observing a call to a scraper: its latency goes to the metrics
+// and its failures to the logs, together with the request ID of ctx.
+func observe(ctx context.Context, scraper string, start time.Time, err *error) {
+	metrics.ObserveScraper(scraper, start, err)
+	if *err != nil {
+		slog.WarnContext(ctx, "scraper failed", "scraper", scraper, "error", *err)
+		return
+	}
+	slog.DebugContext(ctx, "scraper call", "scraper", scraper, "duration", time.Since(start))
+}
+
+// Function for issuing a GET request bound to the given context, so the
+// request is aborted as soon as the context is cancelled or its deadline expires.
+func httpGet(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return http.DefaultClient.Do(req)
+}
+
 // Function for getting the html of a specific domain.
 // The function is used to avoid code repetition.
-func getHTMLinDomain(domain string) (htmlB []byte, err error) {
+func getHTMLinDomain(ctx context.Context, domain string) (htmlB []byte, err error) {
 	var resp *http.Response
-	resp, err = http.Get(domain)
+	resp, err = httpGet(ctx, domain)
 	if err != nil {
 		return
 	}
@@ -91,11 +116,18 @@ func getHTMLinDomain(domain string) (htmlB []byte, err error) {
 }
 
 // Function for getting the logo given a specific domain name.
+// The homepage is fetched with the default safe client, see HomepageScraper.
+func ScraperLogo(ctx context.Context, domain string) (logo string, err error) {
+	return defaultHomepageScraper.Logo(ctx, domain)
+}
+
+// Method for getting the logo given a specific domain name.
 // The scraper use the tokenizer library for navigating into the html of
 // the given domain
-func ScraperLogo(domain string) (logo string, err error) {
+func (h *HomepageScraper) Logo(ctx context.Context, domain string) (logo string, err error) {
+	defer observe(ctx, "logo", time.Now(), &err)
 	var htmlB []byte
-	htmlB, err = getHTMLinDomain(fmt.Sprintf("http://%v/", domain))
+	htmlB, err = h.getHTML(ctx, domain)
 	if err != nil {
 		return
 	}
@@ -135,11 +167,18 @@ func ScraperLogo(domain string) (logo string, err error) {
 }
 
 // Function for getting the title given a specific domain name.
+// The homepage is fetched with the default safe client, see HomepageScraper.
+func ScraperTitle(ctx context.Context, domain string) (s string, err error) {
+	return defaultHomepageScraper.Title(ctx, domain)
+}
+
+// Method for getting the title given a specific domain name.
 // The scraper use the tokenizer library for navigating into the html
 // of the domain with the given name.
-func ScraperTitle(domain string) (s string, err error) {
+func (h *HomepageScraper) Title(ctx context.Context, domain string) (s string, err error) {
+	defer observe(ctx, "title", time.Now(), &err)
 	var htmlB []byte
-	htmlB, err = getHTMLinDomain(fmt.Sprintf("http://%v/", domain))
+	htmlB, err = h.getHTML(ctx, domain)
 	if err != nil {
 		return
 	}
@@ -154,7 +193,7 @@ func ScraperTitle(domain string) (s string, err error) {
 	var f func(*html.Node) string
 	f = func(n *html.Node) string {
 		title := ""
-		if n.Type == html.ElementNode && n.Data == "title" {
+		if n.Type == html.ElementNode && n.Data == "title" && n.FirstChild != nil {
 			return n.FirstChild.Data
 		}
 		for c := n.FirstChild; c != nil; c = c.NextSibling {
@@ -168,12 +207,43 @@ func ScraperTitle(domain string) (s string, err error) {
 	return f(doc), nil
 }
 
+// Ranks of the grades of SSLabs: A+, A, A-, B to F, T (no trust) and M
+// (certificate name mismatch).
+var gradeRanks = map[string]int{
+	"M": 0, "T": 1, "F": 2, "E": 3, "D": 4, "C": 5, "B": 6, "A-": 7, "A": 8, "A+": 9,
+}
+
+// Function for comparing the grades of SSLabs, the higher rank the better the
+// grade. Unknown grades, like the NaN of the servers without a grade, rank -1.
+func GradeRank(grade string) int {
+	if rank, ok := gradeRanks[grade]; ok {
+		return rank
+	}
+	return -1
+}
+
+// Function for getting the SSL grade of a domain, that is, the lowest grade
+// of its servers (A- is lower than A), or NaN when a server has no grade.
+func LowestGrade(servers []dao.Server) string {
+	lowestGrade := "A+"
+	for _, server := range servers {
+		if server.SslGrade == "" {
+			return "NaN"
+		}
+		if GradeRank(server.SslGrade) < GradeRank(lowestGrade) {
+			lowestGrade = server.SslGrade
+		}
+	}
+	return lowestGrade
+}
+
 // Main scraper.
 // Given a time representing in the current hour and a domain name. The scraper
 // extract the info from SSLabs and store it into a DomainEvaluation structure.
 
-func ScraperSSLabs(currentHour time.Time, domain string) (de dao.DomainEvaluation, err error) {
-	byt, err := getHTMLinDomain(fmt.Sprintf("https://api.ssllabs.com/api/v3/analyze?host=%v/", domain))
+func ScraperSSLabs(ctx context.Context, currentHour time.Time, domain string) (de dao.DomainEvaluation, err error) {
+	defer observe(ctx, "sslabs", time.Now(), &err)
+	byt, err := getHTMLinDomain(ctx, fmt.Sprintf("https://api.ssllabs.com/api/v3/analyze?host=%v/", domain))
 	if err != nil {
 		return
 	}
@@ -200,6 +270,7 @@ func ScraperSSLabs(currentHour time.Time, domain string) (de dao.DomainEvaluatio
 	} else if status == "ERROR" {
 		de.IsDown = true
 	}
+	reportProgress(ctx, dat)
 
 	servers := make([]dao.Server, 0)
 
@@ -210,23 +281,6 @@ func ScraperSSLabs(currentHour time.Time, domain string) (de dao.DomainEvaluatio
 			de.Servers = servers
 			return
 		}
-		califications := make(map[string]int)
-		// A+, A-, A-F, T (no trust) and M
-		califications["NaN"] = -1
-		califications["M"] = 0
-		califications["T"] = 1
-		califications["F"] = 2
-		califications["E"] = 3
-		califications["D"] = 4
-		califications["C"] = 5
-		califications["B"] = 6
-		califications["A"] = 7
-		califications["A-"] = 8
-		califications["A+"] = 9
-
-		lowest := califications["A+"]
-		lowestGrade := "A+"
-
 		for _, v := range endpoints {
 			castV := v.(map[string]interface{})
 			server := dao.Server{}
@@ -237,24 +291,95 @@ func ScraperSSLabs(currentHour time.Time, domain string) (de dao.DomainEvaluatio
 				server.Address = ipI.(string)
 				gradeI, ok = castV["grade"]
 				if ok {
-					grade := gradeI.(string)
-					server.SslGrade = grade
-					servers = append(servers, server)
-					if califications[grade] < lowest {
-						lowest = califications[grade]
-						lowestGrade = grade
-					}
-				} else {
-					servers = append(servers, server)
-					lowest = califications["NaN"]
-					lowestGrade = "NaN"
+					server.SslGrade = gradeI.(string)
 				}
+				servers = append(servers, server)
 			}
 		}
-		de.SslGrade = lowestGrade
+		de.SslGrade = LowestGrade(servers)
 	}
 	de.Servers = servers
 
 
 	return
 }
+
+// SSLabsProgress - Struct representing the progress of an assessment in
+// SSLabs: its status (DNS, IN_PROGRESS, READY or ERROR) and the progress of
+// every endpoint (server) of the domain.
+type SSLabsProgress struct {
+	Status        string             `json:"status"`
+	StatusMessage string             `json:"status_message,omitempty"`
+	Endpoints     []EndpointProgress `json:"endpoints"`
+}
+
+// EndpointProgress - Struct representing the progress of the assessment of
+// an endpoint, Progress is a percent (-1 while the endpoint is waiting).
+type EndpointProgress struct {
+	Address       string `json:"address"`
+	Progress      int    `json:"progress"`
+	StatusMessage string `json:"status_message,omitempty"`
+}
+
+// progressKey - Key of the progress reporter in the context of a request.
+type progressKey struct{}
+
+// Function for attaching a progress reporter to ctx. ScraperSSLabs calls it
+// with the progress of the assessment every time it asks SSLabs about it.
+func WithProgressReporter(ctx context.Context, report func(SSLabsProgress)) context.Context {
+	return context.WithValue(ctx, progressKey{}, report)
+}
+
+// Auxiliar function for sending the progress of the answer of SSLabs to the
+// reporter of ctx, if any.
+func reportProgress(ctx context.Context, dat map[string]interface{}) {
+	report, ok := ctx.Value(progressKey{}).(func(SSLabsProgress))
+	if !ok {
+		return
+	}
+	progress := SSLabsProgress{Endpoints: make([]EndpointProgress, 0)}
+	progress.Status, _ = dat["status"].(string)
+	progress.StatusMessage, _ = dat["statusMessage"].(string)
+	endpoints, _ := dat["endpoints"].([]interface{})
+	for _, v := range endpoints {
+		castV, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		endpoint := EndpointProgress{Progress: -1}
+		endpoint.Address, _ = castV["ipAddress"].(string)
+		endpoint.StatusMessage, _ = castV["statusMessage"].(string)
+		if p, ok := castV["progress"].(float64); ok {
+			endpoint.Progress = int(p)
+		}
+		progress.Endpoints = append(progress.Endpoints, endpoint)
+	}
+	report(progress)
+}
+
+// SSLabsInfo - Struct representing the status of the SSLabs API, as returned
+// by its info endpoint.
+type SSLabsInfo struct {
+	EngineVersion        string   `json:"engineVersion"`
+	CriteriaVersion      string   `json:"criteriaVersion"`
+	MaxAssessments       int      `json:"maxAssessments"`
+	CurrentAssessments   int      `json:"currentAssessments"`
+	NewAssessmentCoolOff int      `json:"newAssessmentCoolOff"`
+	Messages             []string `json:"messages"`
+}
+
+// Function for getting the status of the SSLabs API.
+// It's used for knowing if new evaluations can be started.
+func ScraperSSLabsInfo(ctx context.Context) (info SSLabsInfo, err error) {
+	defer observe(ctx, "sslabs_info", time.Now(), &err)
+	var byt []byte
+	byt, err = getHTMLinDomain(ctx, "https://api.ssllabs.com/api/v3/info")
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(byt, &info); err != nil {
+		return
+	}
+	metrics.SetSSLabsCapacity(info.MaxAssessments, info.CurrentAssessments)
+	return
+}
@@ -0,0 +1,74 @@
+// Package for the declaration of the OpenTelemetry tracing of the server.
+// The spans are created with the global TracerProvider, which is a no-op one
+// until NewProvider is installed with otel.SetTracerProvider.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name of the tracer of the server.
+const tracerName = "github.com/trotsdeveloper/truora_test/truora_test_golang"
+
+// Exporters accepted by NewProvider.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// Attributes shared by the spans of the different layers.
+const (
+	DomainKey   = attribute.Key("domain")
+	ServerIPKey = attribute.Key("server.ip")
+)
+
+// Default constructor for the TracerProvider of the server.
+// The OTLP exporter is configured with the standard OTEL_EXPORTER_OTLP_*
+// environment variables. It returns nil for ExporterNone.
+func NewProvider(ctx context.Context, exporter string) (*sdktrace.TracerProvider, error) {
+	var exp sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case ExporterNone, "":
+		return nil, nil
+	case ExporterStdout:
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		exp, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unknown traces exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp)), nil
+}
+
+// Function for starting a span as a child of the span in ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// Function for ending a span, marking it as failed when *err isn't nil.
+// It's meant to be deferred right after Start:
+//
+//	ctx, span := tracing.Start(ctx, "name")
+//	defer tracing.End(span, &err)
+func End(span trace.Span, err *error) {
+	if err != nil && *err != nil {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+	span.End()
+}
@@ -0,0 +1,71 @@
+// Package for the validation and normalization of the domain names received
+// from the clients, before they are evaluated, scraped or stored.
+package validation
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// Maximum length of a normalized domain name, given by the domain column
+// of the domainEvaluation table.
+const MaxDomainLength = 100
+
+// DomainError - Error describing why a domain name was rejected.
+type DomainError struct {
+	Domain string
+	Reason string
+}
+
+// Method for implementing the error interface.
+func (e *DomainError) Error() string {
+	return fmt.Sprintf("Invalid domain name %q: %v.", e.Domain, e.Reason)
+}
+
+// Function for getting the canonical form of a domain name: lowercase,
+// in ASCII (IDN Unicode names are converted to punycode) and without the
+// trailing dot. Two names evaluating the same domain always have the same
+// canonical form, so they share their rows in the database.
+
+// The function rejects IP addresses, ports, paths, queries and credentials,
+// names that are a public suffix themselves (com, co.uk...) and names under
+// an unknown top-level domain.
+func NormalizeDomain(domain string) (string, error) {
+	reject := func(reason string) (string, error) {
+		return "", &DomainError{Domain: domain, Reason: reason}
+	}
+	name := strings.TrimSuffix(domain, ".")
+	switch {
+	case name == "":
+		return reject("the name is empty")
+	case strings.ContainsAny(name, "/\\?#"):
+		return reject("paths and queries are not allowed")
+	case strings.Contains(name, "@"):
+		return reject("credentials are not allowed")
+	case net.ParseIP(strings.Trim(name, "[]")) != nil:
+		return reject("IP addresses are not allowed")
+	case strings.Contains(name, ":"):
+		return reject("ports are not allowed")
+	}
+
+	ascii, err := idna.Lookup.ToASCII(name)
+	if err != nil {
+		return reject(err.Error())
+	}
+	if len(ascii) > MaxDomainLength {
+		return reject(fmt.Sprintf("the name is longer than %v characters", MaxDomainLength))
+	}
+
+	if _, err = publicsuffix.EffectiveTLDPlusOne(ascii); err != nil {
+		return reject("the name is a public suffix")
+	}
+	tld := ascii[strings.LastIndex(ascii, ".")+1:]
+	if _, icann := publicsuffix.PublicSuffix(tld); !icann {
+		return reject(fmt.Sprintf("the top-level domain %q is unknown", tld))
+	}
+	return ascii, nil
+}